@@ -1,10 +1,15 @@
 package common
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"math/rand"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,15 +28,235 @@ const (
 	TERABYTE
 )
 
+// random is the source of all random decisions of the distributions.
+// It is not safe for concurrent use.
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
 // S3Configuration contains all information to connect to a certain S3 endpoint
 type S3Configuration struct {
-	AccessKey     string        `yaml:"access_key" json:"access_key"`
-	SecretKey     string        `yaml:"secret_key" json:"secret_key"`
-	Region        string        `yaml:"region" json:"region"`
-	Endpoint      string        `yaml:"endpoint" json:"endpoint"`
-	Timeout       time.Duration `yaml:"timeout" json:"timeout"`
-	SkipSSLVerify bool          `yaml:"skipSSLverify" json:"skipSSLverify"`
-	ProxyHost     string        `yaml:"proxyHost" json:"proxyHost"`
+	AccessKey     string   `yaml:"access_key" json:"access_key"`
+	SecretKey     string   `yaml:"secret_key" json:"secret_key"`
+	Region        string   `yaml:"region" json:"region"`
+	Endpoint      string   `yaml:"endpoint" json:"endpoint"`
+	Timeout       Duration `yaml:"timeout" json:"timeout"`
+	SkipSSLVerify bool     `yaml:"skipSSLverify" json:"skipSSLverify"`
+	ProxyHost     string   `yaml:"proxyHost" json:"proxyHost"`
+	SessionToken  string   `yaml:"session_token" json:"session_token"`
+	// CredentialsSource is one of static (default), env, shared, chain or web_identity
+	CredentialsSource     string `yaml:"credentials_source" json:"credentials_source"`
+	SharedCredentialsFile string `yaml:"shared_credentials_file" json:"shared_credentials_file"`
+	Profile               string `yaml:"profile" json:"profile"`
+	// RoleARN is assumed with the credentials of the CredentialsSource
+	RoleARN              string   `yaml:"role_arn" json:"role_arn"`
+	RoleSessionName      string   `yaml:"role_session_name" json:"role_session_name"`
+	ExternalID           string   `yaml:"external_id" json:"external_id"`
+	RoleDuration         Duration `yaml:"role_duration" json:"role_duration"`
+	STSEndpoint          string   `yaml:"sts_endpoint" json:"sts_endpoint"`
+	WebIdentityTokenFile string   `yaml:"web_identity_token_file" json:"web_identity_token_file"`
+	// CredentialsRefreshInterval forces a refresh of the credentials after the interval
+	CredentialsRefreshInterval Duration `yaml:"credentials_refresh_interval" json:"credentials_refresh_interval"`
+	// Endpoints replaces Endpoint to spread the operations of a driver over several endpoints
+	Endpoints []string `yaml:"endpoints" json:"endpoints"`
+	// EndpointBalancing is one of round_robin (default), random or least_outstanding
+	EndpointBalancing string `yaml:"endpoint_balancing" json:"endpoint_balancing"`
+	// MaxRetries is the number of retries of a failed request.
+	// Unset uses the SDK default of 3, 0 disables retries.
+	MaxRetries            *int     `yaml:"max_retries" json:"max_retries"`
+	RetryMinDelay         Duration `yaml:"retry_min_delay" json:"retry_min_delay"`
+	RetryMaxDelay         Duration `yaml:"retry_max_delay" json:"retry_max_delay"`
+	RetryMinThrottleDelay Duration `yaml:"retry_min_throttle_delay" json:"retry_min_throttle_delay"`
+	RetryMaxThrottleDelay Duration `yaml:"retry_max_throttle_delay" json:"retry_max_throttle_delay"`
+	// AddressingStyle is either path (default) or virtual for virtual-hosted-style requests
+	AddressingStyle string `yaml:"addressing_style" json:"addressing_style"`
+	Use100Continue  bool   `yaml:"use_100_continue" json:"use_100_continue"`
+	// PayloadSigning is unsigned_put (default) to send UNSIGNED-PAYLOAD with single-part
+	// PutObject requests only, unsigned to send it with all requests or signed
+	PayloadSigning    string `yaml:"payload_signing" json:"payload_signing"`
+	ValidateChecksums bool   `yaml:"validate_checksums" json:"validate_checksums"`
+	// IPFamily is dual_stack (default) to connect via IPv4 and IPv6, or ipv4 or ipv6 only
+	IPFamily string `yaml:"ip_family" json:"ip_family"`
+	// MaxIdleConns is the size of the connection pool per host - 100 by default
+	MaxIdleConns int `yaml:"max_idle_conns" json:"max_idle_conns"`
+	// MaxConnsPerHost limits the connections per host - 0 means no limit
+	MaxConnsPerHost     int      `yaml:"max_conns_per_host" json:"max_conns_per_host"`
+	IdleConnTimeout     Duration `yaml:"idle_conn_timeout" json:"idle_conn_timeout"`
+	TLSHandshakeTimeout Duration `yaml:"tls_handshake_timeout" json:"tls_handshake_timeout"`
+	// DialTimeout is 5s by default
+	DialTimeout Duration `yaml:"dial_timeout" json:"dial_timeout"`
+	// TCPKeepAlive is 15s by default
+	TCPKeepAlive      Duration `yaml:"tcp_keepalive" json:"tcp_keepalive"`
+	ReadBufferSize    ByteSize `yaml:"read_buffer_size" json:"read_buffer_size"`
+	WriteBufferSize   ByteSize `yaml:"write_buffer_size" json:"write_buffer_size"`
+	DisableKeepAlives bool     `yaml:"disable_keep_alives" json:"disable_keep_alives"`
+	HTTP2             bool     `yaml:"http2" json:"http2"`
+	// The TLS files are read on the driver hosts
+	CACertFile     string `yaml:"ca_cert_file" json:"ca_cert_file"`
+	ClientCertFile string `yaml:"client_cert_file" json:"client_cert_file"`
+	ClientKeyFile  string `yaml:"client_key_file" json:"client_key_file"`
+	// MinTLSVersion is one of 1.0, 1.1, 1.2 or 1.3
+	MinTLSVersion string   `yaml:"min_tls_version" json:"min_tls_version"`
+	CipherSuites  []string `yaml:"cipher_suites" json:"cipher_suites"`
+	// TLSServerName overrides the server name that is sent via SNI
+	// and used to verify the certificate of the endpoint
+	TLSServerName string `yaml:"tls_server_name" json:"tls_server_name"`
+	// Backend is the storage system under test: s3 (default), filesystem, azure, gcs, swift or null
+	Backend    string                  `yaml:"backend" json:"backend"`
+	Filesystem FilesystemConfiguration `yaml:"filesystem" json:"filesystem"`
+	Azure      AzureConfiguration      `yaml:"azure" json:"azure"`
+	GCS        GCSConfiguration        `yaml:"gcs" json:"gcs"`
+	Swift      SwiftConfiguration      `yaml:"swift" json:"swift"`
+	Null       NullConfiguration       `yaml:"null" json:"null"`
+}
+
+// FilesystemConfiguration maps buckets to directories and objects to
+// files below the root directory of the filesystem backend
+type FilesystemConfiguration struct {
+	Root string `yaml:"root" json:"root"`
+	// DirectIO opens all files with O_DIRECT to bypass the page cache
+	DirectIO bool `yaml:"direct_io" json:"direct_io"`
+	// Fsync syncs every written file to the disk before it is closed
+	Fsync bool `yaml:"fsync" json:"fsync"`
+}
+
+// AzureConfiguration contains the storage account of the azure backend
+type AzureConfiguration struct {
+	AccountName string `yaml:"account_name" json:"account_name"`
+	// AccountKey is the base64 encoded key for SharedKey authorization
+	AccountKey string `yaml:"account_key" json:"account_key"`
+	// Endpoint is https://<account_name>.blob.core.windows.net by default.
+	// Azurite uses http://127.0.0.1:10000/<account_name>
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+}
+
+// GCSConfiguration contains the project and authorization of the gcs backend
+type GCSConfiguration struct {
+	// Project is needed to create buckets
+	Project string `yaml:"project" json:"project"`
+	// Endpoint is https://storage.googleapis.com by default
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Auth is one of none (default), token or service_account
+	Auth  string `yaml:"auth" json:"auth"`
+	Token string `yaml:"token" json:"token"`
+	// CredentialsFile is the JSON key of a service account - read on the driver hosts
+	CredentialsFile string `yaml:"credentials_file" json:"credentials_file"`
+}
+
+// Authorizations of the gcs backend
+const (
+	GCSAuthNone           = "none"
+	GCSAuthToken          = "token"
+	GCSAuthServiceAccount = "service_account"
+)
+
+// SwiftConfiguration contains the authorization of the swift backend
+type SwiftConfiguration struct {
+	// Auth is one of tempauth (default) or keystone for Keystone v3
+	Auth    string `yaml:"auth" json:"auth"`
+	AuthURL string `yaml:"auth_url" json:"auth_url"`
+	User    string `yaml:"user" json:"user"`
+	// Key is the TempAuth key or the Keystone password
+	Key string `yaml:"key" json:"key"`
+	// The domains are Default by default
+	UserDomain    string `yaml:"user_domain" json:"user_domain"`
+	Project       string `yaml:"project" json:"project"`
+	ProjectDomain string `yaml:"project_domain" json:"project_domain"`
+	// Region picks the object-store endpoint of the Keystone catalog
+	Region string `yaml:"region" json:"region"`
+	// StorageURL overrides the storage URL of the auth response
+	StorageURL string `yaml:"storage_url" json:"storage_url"`
+	// LargeObjects is one of slo (default) or dlo
+	LargeObjects string `yaml:"large_objects" json:"large_objects"`
+}
+
+// Authorizations of the swift backend
+const (
+	SwiftAuthTempAuth = "tempauth"
+	SwiftAuthKeystone = "keystone"
+)
+
+// Static and dynamic large objects of the swift backend
+const (
+	SwiftLargeObjectsStatic  = "slo"
+	SwiftLargeObjectsDynamic = "dlo"
+)
+
+// NullConfiguration contains the artificial latency of the null backend
+type NullConfiguration struct {
+	Latency Duration `yaml:"latency" json:"latency"`
+	// LatencyJitter adds a random latency of up to this duration
+	LatencyJitter Duration `yaml:"latency_jitter" json:"latency_jitter"`
+}
+
+// Storage systems that can be tested
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+	BackendAzure      = "azure"
+	BackendGCS        = "gcs"
+	BackendSwift      = "swift"
+	BackendNull       = "null"
+)
+
+// Addressing styles of S3 requests
+const (
+	AddressingStylePath    = "path"
+	AddressingStyleVirtual = "virtual"
+)
+
+// Sources of the credentials of the S3 requests
+const (
+	CredentialsSourceStatic      = "static"
+	CredentialsSourceEnv         = "env"
+	CredentialsSourceShared      = "shared"
+	CredentialsSourceChain       = "chain"
+	CredentialsSourceWebIdentity = "web_identity"
+)
+
+// Balancing strategies across the endpoints of a driver
+const (
+	EndpointBalancingRoundRobin       = "round_robin"
+	EndpointBalancingRandom           = "random"
+	EndpointBalancingLeastOutstanding = "least_outstanding"
+)
+
+// Address families of the connections to the endpoints
+const (
+	IPFamilyDualStack = "dual_stack"
+	IPFamilyIPv4      = "ipv4"
+	IPFamilyIPv6      = "ipv6"
+)
+
+// Payload signing modes of S3 requests
+const (
+	PayloadSigningUnsignedPut = "unsigned_put"
+	PayloadSigningUnsigned    = "unsigned"
+	PayloadSigningSigned      = "signed"
+)
+
+// Modes of the multipart uploads of the writes
+const (
+	MultipartModeSDK      = "sdk"
+	MultipartModeExplicit = "explicit"
+)
+
+// Orders in which the parts of an explicit multipart upload are sent
+const (
+	PartOrderSequential = "sequential"
+	PartOrderReverse    = "reverse"
+	PartOrderRandom     = "random"
+)
+
+// ObjectSizeConfiguration overrides the object sizes of a test case
+// for a single operation
+type ObjectSizeConfiguration struct {
+	SizeMin          uint64 `yaml:"size_min" json:"size_min"`
+	SizeMax          uint64 `yaml:"size_max" json:"size_max"`
+	SizeLast         uint64
+	SizeDistribution string        `yaml:"size_distribution" json:"size_distribution"`
+	SizeHistogram    SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+	SizeFile         string        `yaml:"size_file" json:"size_file"`
+	SizeBuckets      []SizeBucket
+	Unit             string `yaml:"unit" json:"unit"`
 }
 
 // GrafanaConfiguration contains all information necessary to add annotations
@@ -48,13 +273,24 @@ type TestCaseConfiguration struct {
 		SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 		SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 		SizeLast           uint64
-		SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+		SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+		SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+		SizeFile           string        `yaml:"size_file" json:"size_file"`
+		SizeBuckets        []SizeBucket
 		NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 		NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 		NumberLast         uint64
 		NumberDistribution string `yaml:"number_distribution" json:"number_distribution"`
 		Unit               string `yaml:"unit" json:"unit"`
 	} `yaml:"objects" json:"objects"`
+	// ObjectsPerOperation optionally overrides the object sizes of Objects
+	// for a single operation
+	ObjectsPerOperation struct {
+		Read   *ObjectSizeConfiguration `yaml:"read" json:"read"`
+		Write  *ObjectSizeConfiguration `yaml:"write" json:"write"`
+		List   *ObjectSizeConfiguration `yaml:"list" json:"list"`
+		Delete *ObjectSizeConfiguration `yaml:"delete" json:"delete"`
+	} `yaml:"objects_per_operation" json:"objects_per_operation"`
 	Buckets struct {
 		NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 		NumberMax          uint64 `yaml:"number_max" json:"number_max"`
@@ -70,12 +306,19 @@ type TestCaseConfiguration struct {
 		ReadPartSize     uint64 `yaml:"read_part_size" json:"read_part_size"`
 		ReadConcurrency  int    `yaml:"read_concurrency" json:"read_concurrency"`
 		ReadUnit         string `yaml:"read_unit" json:"read_unit"`
+		// The lifecycle of the multipart uploads of the writes
+		MultipartLifecycleConfiguration `yaml:",inline"`
 	} `yaml:"multipart" json:"multipart"`
 	Name                string   `yaml:"name" json:"name"`
 	BucketPrefix        string   `yaml:"bucket_prefix" json:"bucket_prefix"`
 	ObjectPrefix        string   `yaml:"object_prefix" json:"object_prefix"`
 	Runtime             Duration `yaml:"stop_with_runtime" json:"stop_with_runtime"`
 	OpsDeadline         uint64   `yaml:"stop_with_ops" json:"stop_with_ops"`
+	OpsDeadlineGlobal   bool     `yaml:"stop_with_ops_global" json:"stop_with_ops_global"`
+	OpsLeaseSize        uint64   `yaml:"ops_lease_size" json:"ops_lease_size"`
+	BytesDeadline       ByteSize `yaml:"stop_with_bytes" json:"stop_with_bytes"`
+	MaxErrorRatio       float64  `yaml:"stop_on_error_ratio" json:"stop_on_error_ratio"`
+	MaxLatencyP99       Duration `yaml:"stop_on_latency_p99" json:"stop_on_latency_p99"`
 	Drivers             int      `yaml:"drivers" json:"drivers"`
 	DriversShareBuckets bool     `yaml:"drivers_share_buckets" json:"drivers_share_buckets"`
 	Workers             int      `yaml:"workers" json:"workers"`
@@ -85,11 +328,103 @@ type TestCaseConfiguration struct {
 	WriteWeight         int      `yaml:"write_weight" json:"write_weight"`
 	ListWeight          int      `yaml:"list_weight" json:"list_weight"`
 	DeleteWeight        int      `yaml:"delete_weight" json:"delete_weight"`
+	// Seed is the base of all random decisions of the test, every driver
+	// derives its own seed from it with DriverSeed
+	Seed       int64                   `yaml:"seed" json:"seed"`
+	Encryption EncryptionConfiguration `yaml:"encryption" json:"encryption"`
+	// WriteOptions are sent with every PUT - including multipart uploads
+	// and the objects written during the preparation
+	WriteOptions WriteOptionsConfiguration `yaml:"write_options" json:"write_options"`
+	Versioning   VersioningConfiguration   `yaml:"versioning" json:"versioning"`
+	ObjectLock   ObjectLockConfiguration   `yaml:"object_lock" json:"object_lock"`
+}
+
+// WriteOptionsConfiguration contains the optional headers of the objects of a test case
+type WriteOptionsConfiguration struct {
+	StorageClass string `yaml:"storage_class" json:"storage_class"`
+	// MetadataCount user metadata headers with values of MetadataSize bytes are generated
+	MetadataCount int               `yaml:"metadata_count" json:"metadata_count"`
+	MetadataSize  ByteSize          `yaml:"metadata_size" json:"metadata_size"`
+	Tags          map[string]string `yaml:"tags" json:"tags"`
+	// ACL is a canned ACL like private or public-read
+	ACL         string `yaml:"acl" json:"acl"`
+	ContentType string `yaml:"content_type" json:"content_type"`
+}
+
+// MultipartLifecycleConfiguration contains how the steps of the multipart
+// uploads of the writes are sent
+type MultipartLifecycleConfiguration struct {
+	// WriteMPUMode is sdk to leave the upload to the SDK or explicit to send
+	// CreateMultipartUpload, UploadPart and CompleteMultipartUpload on their own
+	WriteMPUMode string `yaml:"write_mpu_mode" json:"write_mpu_mode"`
+	// WritePartOrder is sequential, reverse or random
+	WritePartOrder string `yaml:"write_part_order" json:"write_part_order"`
+	// WriteAbortRatio is the share of the uploads that are aborted after their parts were sent
+	WriteAbortRatio float64 `yaml:"write_abort_ratio" json:"write_abort_ratio"`
+	// WritePartCopy copies the parts from a source object with UploadPartCopy
+	WritePartCopy bool `yaml:"write_part_copy" json:"write_part_copy"`
+}
+
+// VersioningConfiguration contains the versioning of the buckets of a test case
+type VersioningConfiguration struct {
+	// Enabled turns on the versioning of the buckets when they are created
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Versions is the number of versions that are written of every key - 1 by default
+	Versions int `yaml:"versions" json:"versions"`
+	// Read is latest to read the latest versions or specific to read random versions by their ID
+	Read string `yaml:"read" json:"read"`
+	// Delete is marker to leave delete markers or specific to delete random versions by their ID
+	Delete string `yaml:"delete" json:"delete"`
 }
 
+// Versions that reads and deletes target
+const (
+	VersionLatest   = "latest"
+	VersionSpecific = "specific"
+	VersionMarker   = "marker"
+)
+
+// ObjectLockConfiguration contains the Object Lock (WORM) protection of the
+// objects of a test case
+type ObjectLockConfiguration struct {
+	// Enabled creates the buckets with Object Lock - which also enables their versioning
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Mode is governance or compliance - empty writes objects without retention
+	Mode string `yaml:"mode" json:"mode"`
+	// Retention is how long every object is retained after it was written
+	Retention Duration `yaml:"retention" json:"retention"`
+	// LegalHold puts a legal hold on every object that is written
+	LegalHold bool `yaml:"legal_hold" json:"legal_hold"`
+}
+
+// Object Lock retention modes
+const (
+	ObjectLockGovernance = "governance"
+	ObjectLockCompliance = "compliance"
+)
+
+// EncryptionConfiguration contains the server-side encryption
+// of the objects of a test case
+type EncryptionConfiguration struct {
+	// Type is one of sse-s3, sse-kms or sse-c - empty disables encryption
+	Type     string `yaml:"type" json:"type"`
+	KMSKeyID string `yaml:"kms_key_id" json:"kms_key_id"`
+	// CustomerKeys is the number of SSE-C keys that are generated from the
+	// test's seed - 1 by default. Every object always uses the same key.
+	CustomerKeys int `yaml:"customer_keys" json:"customer_keys"`
+}
+
+// Server-side encryption types
+const (
+	EncryptionSSES3  = "sse-s3"
+	EncryptionSSEKMS = "sse-kms"
+	EncryptionSSEC   = "sse-c"
+)
+
 // Workloadconf the Grafana and test configuration
 type Workloadconf struct {
 	GrafanaConfig *GrafanaConfiguration    `yaml:"grafana_config" json:"grafana_config"`
+	Seed          int64                    `yaml:"seed" json:"seed"`
 	Tests         []*TestCaseConfiguration `yaml:"tests" json:"tests"`
 }
 
@@ -97,6 +432,7 @@ type Workloadconf struct {
 type Testconf struct {
 	S3Config      []*S3Configuration       `yaml:"s3_config" json:"s3_config"`
 	GrafanaConfig *GrafanaConfiguration    `yaml:"grafana_config" json:"grafana_config"`
+	Seed          int64                    `yaml:"seed" json:"seed"`
 	Tests         []*TestCaseConfiguration `yaml:"tests" json:"tests"`
 }
 
@@ -117,9 +453,15 @@ type BenchmarkResult struct {
 	ObjectSize       float64
 	Operations       float64
 	FailedOperations float64
-	OpsPerSecond     float64
-	Workers          int
-	Bytes            float64
+	// TimedOutOperations are not included in the FailedOperations
+	TimedOutOperations float64
+	// Retries is the number of requests the SDK retried transparently
+	Retries float64
+	// ErrorClasses counts the failed and timed out operations per error class
+	ErrorClasses map[string]float64
+	OpsPerSecond float64
+	Workers      int
+	Bytes        float64
 	// Bandwidth is the amount of Bytes per second of runtime
 	Bandwidth    float64
 	LatencyAvg   float64
@@ -128,6 +470,30 @@ type BenchmarkResult struct {
 	StopTime     time.Time
 	Duration     time.Duration
 	Options      string
+	// StopReason tells why the test stopped: runtime, ops, bytes,
+	// error_ratio or latency_p99
+	StopReason string
+	// Seed is the effective random seed - for the results of a single driver
+	// this is the driver's seed, for the summed results the test's seed
+	Seed int64
+	// OperationResults contains the results broken down per S3 method
+	OperationResults []OperationResult
+}
+
+// OperationResult contains the benchmark results of a single S3 method
+// (GET, PUT, LIST, DELETE) of a test
+type OperationResult struct {
+	Method             string
+	ObjectSizeMin      uint64
+	ObjectSizeMax      uint64
+	SizeDistribution   string
+	ObjectSize         float64
+	Operations         float64
+	FailedOperations   float64
+	TimedOutOperations float64
+	Retries            float64
+	Bytes              float64
+	LatencyAvg         float64
 }
 
 // DriverMessage is the struct that is exchanged in the communication between
@@ -137,22 +503,273 @@ type DriverMessage struct {
 	Message     string
 	Config      *DriverConf
 	BenchResult BenchmarkResult
+	// StopReason is set when a driver aborts a test because of a breached
+	// stop condition - and when the server tells the other drivers to stop
+	StopReason string
+	// OpsLease is the number of operations the server grants a driver
+	// from the global ops budget. 0 means that the budget is used up.
+	OpsLease uint64
+	// BytesLease is the number of bytes the server grants a driver
+	// from the global byte budget. 0 means that the budget is used up.
+	BytesLease uint64
 }
 
 // CheckConfig checks the global config
 func CheckConfig(config Testconf) {
-	for _, testcase := range config.Tests {
+	for _, s3Config := range config.S3Config {
+		err := checkS3Config(s3Config)
+		if err != nil {
+			log.WithError(err).Fatalf("Issue detected when scanning through the S3 config file:")
+		}
+	}
+	for testNumber, testcase := range config.Tests {
+		setTestSeed(testcase, config.Seed, testNumber)
 		// log.Debugf("Checking testcase with prefix %s", testcase.BucketPrefix)
 		err := checkTestCase(testcase)
+		if err == nil {
+			err = checkBackendFeatures(testcase, config.S3Config)
+		}
 		if err != nil {
 			log.WithError(err).Fatalf("Issue detected when scanning through the config file:")
 		}
 	}
 }
 
+// checkBackendFeatures checks that all backends support the features of the
+// test case that can not just be ignored by the other backends
+func checkBackendFeatures(testcase *TestCaseConfiguration, s3Configs []*S3Configuration) error {
+	for _, s3Config := range s3Configs {
+		if testcase.Versioning.Enabled && s3Config.Backend != BackendS3 {
+			return fmt.Errorf("versioning is not supported by the %s backend", s3Config.Backend)
+		}
+		if testcase.ObjectLock.Enabled && s3Config.Backend != BackendS3 {
+			return fmt.Errorf("object_lock is not supported by the %s backend", s3Config.Backend)
+		}
+	}
+	return nil
+}
+
+// setTestSeed sets the seed of test cases that do not have their own seed.
+// They are derived from the workload's seed if there is one - otherwise
+// a random seed is used, which is then recorded in the results.
+func setTestSeed(testcase *TestCaseConfiguration, workloadSeed int64, testNumber int) {
+	if testcase.Seed != 0 {
+		return
+	}
+	if workloadSeed != 0 {
+		testcase.Seed = workloadSeed + int64(testNumber)
+		return
+	}
+	testcase.Seed = time.Now().UnixNano()
+}
+
+// DriverSeed derives the seed of a single driver from the test's seed,
+// so that drivers do not all make the same random decisions
+func DriverSeed(testSeed int64, driverID string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(driverID))
+	return testSeed ^ int64(hash.Sum64())
+}
+
+// SeedRandom reseeds the source of all random decisions of the distributions
+func SeedRandom(seed int64) {
+	random = rand.New(rand.NewSource(seed))
+}
+
+func checkAzureConfig(azure *AzureConfiguration) error {
+	if azure.AccountName == "" || azure.AccountKey == "" {
+		return fmt.Errorf("The %s backend needs an account_name and account_key", BackendAzure)
+	}
+	if _, err := base64.StdEncoding.DecodeString(azure.AccountKey); err != nil {
+		return fmt.Errorf("The account_key is not base64 encoded: %v", err)
+	}
+	if azure.Endpoint == "" {
+		azure.Endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", azure.AccountName)
+	}
+	if endpoint, err := url.Parse(azure.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("The azure endpoint %s is no full URL", azure.Endpoint)
+	}
+	return nil
+}
+
+func checkGCSConfig(gcs *GCSConfiguration) error {
+	switch gcs.Auth {
+	case "":
+		gcs.Auth = GCSAuthNone
+	case GCSAuthNone:
+	case GCSAuthToken:
+		if gcs.Token == "" {
+			return fmt.Errorf("The gcs auth %s needs a token", GCSAuthToken)
+		}
+	case GCSAuthServiceAccount:
+		if gcs.CredentialsFile == "" {
+			return fmt.Errorf("The gcs auth %s needs a credentials_file", GCSAuthServiceAccount)
+		}
+	default:
+		return fmt.Errorf("%s is not a valid gcs auth. Allowed options are %s, %s, %s", gcs.Auth, GCSAuthNone, GCSAuthToken, GCSAuthServiceAccount)
+	}
+	if gcs.Endpoint == "" {
+		gcs.Endpoint = "https://storage.googleapis.com"
+	}
+	if endpoint, err := url.Parse(gcs.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("The gcs endpoint %s is no full URL", gcs.Endpoint)
+	}
+	return nil
+}
+
+func checkSwiftConfig(swift *SwiftConfiguration) error {
+	switch swift.Auth {
+	case "":
+		swift.Auth = SwiftAuthTempAuth
+	case SwiftAuthTempAuth:
+	case SwiftAuthKeystone:
+		if swift.Project == "" {
+			return fmt.Errorf("The swift auth %s needs a project", SwiftAuthKeystone)
+		}
+		if swift.UserDomain == "" {
+			swift.UserDomain = "Default"
+		}
+		if swift.ProjectDomain == "" {
+			swift.ProjectDomain = "Default"
+		}
+	default:
+		return fmt.Errorf("%s is not a valid swift auth. Allowed options are %s, %s", swift.Auth, SwiftAuthTempAuth, SwiftAuthKeystone)
+	}
+	if swift.AuthURL == "" || swift.User == "" || swift.Key == "" {
+		return fmt.Errorf("The %s backend needs an auth_url, user and key", BackendSwift)
+	}
+	switch swift.LargeObjects {
+	case "":
+		swift.LargeObjects = SwiftLargeObjectsStatic
+	case SwiftLargeObjectsStatic, SwiftLargeObjectsDynamic:
+	default:
+		return fmt.Errorf("%s is not a valid large_objects option. Allowed options are %s, %s", swift.LargeObjects, SwiftLargeObjectsStatic, SwiftLargeObjectsDynamic)
+	}
+	return nil
+}
+
+func checkS3Config(s3Config *S3Configuration) error {
+	switch s3Config.Backend {
+	case "":
+		s3Config.Backend = BackendS3
+	case BackendS3:
+	case BackendFilesystem:
+		if s3Config.Filesystem.Root == "" {
+			return fmt.Errorf("The %s backend needs a root directory", BackendFilesystem)
+		}
+	case BackendAzure:
+		if err := checkAzureConfig(&s3Config.Azure); err != nil {
+			return err
+		}
+	case BackendGCS:
+		if err := checkGCSConfig(&s3Config.GCS); err != nil {
+			return err
+		}
+	case BackendSwift:
+		if err := checkSwiftConfig(&s3Config.Swift); err != nil {
+			return err
+		}
+	case BackendNull:
+		if s3Config.Null.Latency < 0 || s3Config.Null.LatencyJitter < 0 {
+			return fmt.Errorf("The latency of the %s backend must not be negative", BackendNull)
+		}
+	default:
+		return fmt.Errorf("%s is not a valid backend. Allowed options are %s, %s, %s, %s, %s, %s", s3Config.Backend, BackendS3, BackendFilesystem, BackendAzure, BackendGCS, BackendSwift, BackendNull)
+	}
+	switch s3Config.CredentialsSource {
+	case "":
+		s3Config.CredentialsSource = CredentialsSourceStatic
+	case CredentialsSourceStatic, CredentialsSourceEnv, CredentialsSourceShared, CredentialsSourceChain:
+	case CredentialsSourceWebIdentity:
+		if s3Config.RoleARN == "" || s3Config.WebIdentityTokenFile == "" {
+			return fmt.Errorf("credentials_source %s needs role_arn and web_identity_token_file", CredentialsSourceWebIdentity)
+		}
+	default:
+		return fmt.Errorf("%s is not a valid credentials_source. Allowed options are %s, %s, %s, %s, %s", s3Config.CredentialsSource,
+			CredentialsSourceStatic, CredentialsSourceEnv, CredentialsSourceShared, CredentialsSourceChain, CredentialsSourceWebIdentity)
+	}
+	if s3Config.RoleDuration < 0 || s3Config.CredentialsRefreshInterval < 0 {
+		return fmt.Errorf("role_duration and credentials_refresh_interval must not be negative")
+	}
+	if s3Config.Endpoint != "" && len(s3Config.Endpoints) != 0 {
+		return fmt.Errorf("Only one of endpoint %s and endpoints %v may be set", s3Config.Endpoint, s3Config.Endpoints)
+	}
+	for _, endpoint := range s3Config.Endpoints {
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil || endpointURL.Scheme == "" || endpointURL.Host == "" {
+			return fmt.Errorf("%s in endpoints is not a full HTTP(S) URL like https://my.rgw.endpoint:8080", endpoint)
+		}
+	}
+	switch s3Config.EndpointBalancing {
+	case "":
+		s3Config.EndpointBalancing = EndpointBalancingRoundRobin
+	case EndpointBalancingRoundRobin, EndpointBalancingRandom, EndpointBalancingLeastOutstanding:
+	default:
+		return fmt.Errorf("endpoint_balancing must be %s, %s or %s", EndpointBalancingRoundRobin, EndpointBalancingRandom, EndpointBalancingLeastOutstanding)
+	}
+	switch s3Config.AddressingStyle {
+	case "":
+		s3Config.AddressingStyle = AddressingStylePath
+	case AddressingStylePath, AddressingStyleVirtual:
+	default:
+		return fmt.Errorf("addressing_style of endpoint %s must be %s or %s", s3Config.Endpoint, AddressingStylePath, AddressingStyleVirtual)
+	}
+	switch s3Config.PayloadSigning {
+	case "":
+		s3Config.PayloadSigning = PayloadSigningUnsignedPut
+	case PayloadSigningUnsignedPut, PayloadSigningUnsigned, PayloadSigningSigned:
+	default:
+		return fmt.Errorf("payload_signing of endpoint %s must be %s, %s or %s", s3Config.Endpoint, PayloadSigningUnsignedPut, PayloadSigningUnsigned, PayloadSigningSigned)
+	}
+	switch s3Config.IPFamily {
+	case "":
+		s3Config.IPFamily = IPFamilyDualStack
+	case IPFamilyDualStack, IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return fmt.Errorf("ip_family of endpoint %s must be %s, %s or %s", s3Config.Endpoint, IPFamilyDualStack, IPFamilyIPv4, IPFamilyIPv6)
+	}
+	if s3Config.MaxIdleConns < 0 || s3Config.MaxConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns and max_conns_per_host of endpoint %s must not be negative", s3Config.Endpoint)
+	}
+	if s3Config.MaxIdleConns == 0 {
+		s3Config.MaxIdleConns = 100
+	}
+	if s3Config.DialTimeout == 0 {
+		s3Config.DialTimeout = Duration(5 * time.Second)
+	}
+	if s3Config.TCPKeepAlive == 0 {
+		s3Config.TCPKeepAlive = Duration(15 * time.Second)
+	}
+	if (s3Config.ClientCertFile == "") != (s3Config.ClientKeyFile == "") {
+		return fmt.Errorf("client_cert_file and client_key_file of endpoint %s must be set together", s3Config.Endpoint)
+	}
+	if _, err := ParseTLSVersion(s3Config.MinTLSVersion); err != nil {
+		return fmt.Errorf("Invalid min_tls_version of endpoint %s: %v", s3Config.Endpoint, err)
+	}
+	if _, err := ParseCipherSuites(s3Config.CipherSuites); err != nil {
+		return fmt.Errorf("Invalid cipher_suites of endpoint %s: %v", s3Config.Endpoint, err)
+	}
+	if s3Config.MaxRetries != nil && *s3Config.MaxRetries < 0 {
+		return fmt.Errorf("max_retries of endpoint %s must not be negative", s3Config.Endpoint)
+	}
+	if s3Config.RetryMaxDelay != 0 && s3Config.RetryMinDelay > s3Config.RetryMaxDelay {
+		return fmt.Errorf("retry_min_delay of endpoint %s is greater than its retry_max_delay", s3Config.Endpoint)
+	}
+	if s3Config.RetryMaxThrottleDelay != 0 && s3Config.RetryMinThrottleDelay > s3Config.RetryMaxThrottleDelay {
+		return fmt.Errorf("retry_min_throttle_delay of endpoint %s is greater than its retry_max_throttle_delay", s3Config.Endpoint)
+	}
+	return nil
+}
+
 func checkTestCase(testcase *TestCaseConfiguration) error {
-	if testcase.Runtime == 0 && testcase.OpsDeadline == 0 {
-		return fmt.Errorf("Either stop_with_runtime or stop_with_ops needs to be set")
+	if testcase.Runtime == 0 && testcase.OpsDeadline == 0 && testcase.BytesDeadline == 0 {
+		return fmt.Errorf("Either stop_with_runtime, stop_with_ops or stop_with_bytes needs to be set")
+	}
+	if testcase.OpsDeadlineGlobal && testcase.OpsDeadline == 0 {
+		return fmt.Errorf("stop_with_ops_global needs stop_with_ops to be set")
+	}
+	if testcase.MaxErrorRatio < 0 || testcase.MaxErrorRatio > 1 {
+		return fmt.Errorf("stop_on_error_ratio needs to be between 0 and 1")
 	}
 	if testcase.ReadWeight == 0 && testcase.WriteWeight == 0 && testcase.ListWeight == 0 && testcase.DeleteWeight == 0 && testcase.ExistingReadWeight == 0 {
 		return fmt.Errorf("At least one weight needs to be set - Read / Write / List / Delete")
@@ -163,16 +780,29 @@ func checkTestCase(testcase *TestCaseConfiguration) error {
 	if testcase.Buckets.NumberMin == 0 {
 		return fmt.Errorf("Please set minimum number of Buckets")
 	}
-	if testcase.Objects.SizeMin == 0 {
+	if err := checkEncryption(&testcase.Encryption); err != nil {
+		return err
+	}
+	if err := checkWriteOptions(&testcase.WriteOptions); err != nil {
+		return err
+	}
+	if err := checkVersioning(&testcase.Versioning); err != nil {
+		return err
+	}
+	if err := checkObjectLock(&testcase.ObjectLock, testcase.CleanAfter); err != nil {
+		return err
+	}
+	sampledSizes := isSampledDistribution(testcase.Objects.SizeDistribution)
+	if testcase.Objects.SizeMin == 0 && !sampledSizes {
 		return fmt.Errorf("Please set minimum size of Objects")
 	}
-	if testcase.Objects.SizeMax == 0 {
+	if testcase.Objects.SizeMax == 0 && !sampledSizes {
 		return fmt.Errorf("Please set maximum size of Objects")
 	}
 	if testcase.Objects.NumberMin == 0 {
 		return fmt.Errorf("Please set minimum number of Objects")
 	}
-	if err := checkDistribution(testcase.Objects.SizeDistribution, "Object size_distribution"); err != nil {
+	if err := checkSizeDistribution(testcase.Objects.SizeDistribution, "Object size_distribution"); err != nil {
 		return err
 	}
 	if err := checkDistribution(testcase.Objects.NumberDistribution, "Object number_distribution"); err != nil {
@@ -191,21 +821,228 @@ func checkTestCase(testcase *TestCaseConfiguration) error {
 	}
 	testcase.Objects.SizeMin = testcase.Objects.SizeMin * toByteMultiplicator
 	testcase.Objects.SizeMax = testcase.Objects.SizeMax * toByteMultiplicator
+	if sampledSizes {
+		testcase.Objects.SizeBuckets, err = loadSizeBuckets(testcase.Objects.SizeDistribution, testcase.Objects.SizeHistogram, testcase.Objects.SizeFile, testcase.Objects.Unit)
+		if err != nil {
+			return err
+		}
+		testcase.Objects.SizeMin, testcase.Objects.SizeMax = sizeBucketRange(testcase.Objects.SizeBuckets)
+	}
 
-	toByteMultiplicator, err = getByteMultiplier(testcase.Multipart.WriteUnit)
-	if err != nil {
+	for _, operation := range []string{"read", "write", "list", "delete"} {
+		sizes := testcase.ObjectSizeOverride(operation)
+		if sizes == nil {
+			continue
+		}
+		if err := checkObjectSizes(sizes, operation, testcase.Objects.Unit); err != nil {
+			return err
+		}
+	}
+
+	// The part size is only relevant when multipart is in use
+	if testcase.Multipart.WriteUnit != "" || testcase.Multipart.WriteMPUEnabled {
+		toByteMultiplicator, err = getByteMultiplier(testcase.Multipart.WriteUnit)
+		if err != nil {
+			return err
+		}
+		testcase.Multipart.WritePartSize = testcase.Multipart.WritePartSize * toByteMultiplicator
+	}
+	if err := checkMultipartLifecycle(&testcase.Multipart.MultipartLifecycleConfiguration, testcase.Multipart.WriteMPUEnabled); err != nil {
 		return err
 	}
-	testcase.Multipart.WritePartSize = testcase.Multipart.WritePartSize * toByteMultiplicator
 
-	toByteMultiplicator, err = getByteMultiplier(testcase.Multipart.ReadUnit)
+	if testcase.Multipart.ReadUnit != "" || testcase.Multipart.ReadMPUEnabled {
+		toByteMultiplicator, err = getByteMultiplier(testcase.Multipart.ReadUnit)
+		if err != nil {
+			return err
+		}
+		testcase.Multipart.ReadPartSize = testcase.Multipart.ReadPartSize * toByteMultiplicator
+	}
+	return nil
+}
+
+// checkMultipartLifecycle sets the defaults of the multipart lifecycle and
+// checks that its options are only used with explicit multipart uploads
+func checkMultipartLifecycle(lifecycle *MultipartLifecycleConfiguration, mpuEnabled bool) error {
+	switch lifecycle.WriteMPUMode {
+	case "":
+		lifecycle.WriteMPUMode = MultipartModeSDK
+	case MultipartModeSDK, MultipartModeExplicit:
+	default:
+		return fmt.Errorf("%s is not a valid write_mpu_mode. Allowed options are %s, %s", lifecycle.WriteMPUMode, MultipartModeSDK, MultipartModeExplicit)
+	}
+	switch lifecycle.WritePartOrder {
+	case "":
+		lifecycle.WritePartOrder = PartOrderSequential
+	case PartOrderSequential, PartOrderReverse, PartOrderRandom:
+	default:
+		return fmt.Errorf("%s is not a valid write_part_order. Allowed options are %s, %s, %s", lifecycle.WritePartOrder, PartOrderSequential, PartOrderReverse, PartOrderRandom)
+	}
+	if lifecycle.WriteAbortRatio < 0 || lifecycle.WriteAbortRatio > 1 {
+		return fmt.Errorf("write_abort_ratio needs to be between 0 and 1")
+	}
+	if lifecycle.WriteMPUMode == MultipartModeExplicit && !mpuEnabled {
+		return fmt.Errorf("write_mpu_mode %s needs write_mpu_enabled", MultipartModeExplicit)
+	}
+	if lifecycle.WriteMPUMode != MultipartModeExplicit &&
+		(lifecycle.WritePartOrder != PartOrderSequential || lifecycle.WriteAbortRatio != 0 || lifecycle.WritePartCopy) {
+		return fmt.Errorf("write_part_order, write_abort_ratio and write_part_copy need write_mpu_mode %s", MultipartModeExplicit)
+	}
+	return nil
+}
+
+// checkVersioning sets the defaults of the versioning and checks that
+// its options are only used with versioned buckets
+func checkVersioning(versioning *VersioningConfiguration) error {
+	if versioning.Versions < 0 {
+		return fmt.Errorf("versioning versions must not be negative")
+	}
+	if versioning.Versions == 0 {
+		versioning.Versions = 1
+	}
+	switch versioning.Read {
+	case "":
+		versioning.Read = VersionLatest
+	case VersionLatest, VersionSpecific:
+	default:
+		return fmt.Errorf("%s is not a valid versioning read. Allowed options are %s, %s", versioning.Read, VersionLatest, VersionSpecific)
+	}
+	switch versioning.Delete {
+	case "":
+		versioning.Delete = VersionMarker
+	case VersionMarker, VersionSpecific:
+	default:
+		return fmt.Errorf("%s is not a valid versioning delete. Allowed options are %s, %s", versioning.Delete, VersionMarker, VersionSpecific)
+	}
+	if !versioning.Enabled && (versioning.Versions != 1 || versioning.Read != VersionLatest || versioning.Delete != VersionMarker) {
+		return fmt.Errorf("versioning versions, read and delete need versioning to be enabled")
+	}
+	return nil
+}
+
+// checkObjectLock checks that the retention has a mode and a duration and
+// that the buckets can still be cleaned up after the test
+func checkObjectLock(objectLock *ObjectLockConfiguration, cleanAfter bool) error {
+	switch objectLock.Mode {
+	case "", ObjectLockGovernance, ObjectLockCompliance:
+	default:
+		return fmt.Errorf("%s is not a valid object_lock mode. Allowed options are %s, %s", objectLock.Mode, ObjectLockGovernance, ObjectLockCompliance)
+	}
+	if objectLock.Retention < 0 {
+		return fmt.Errorf("object_lock retention must not be negative")
+	}
+	if (objectLock.Mode == "") != (objectLock.Retention == 0) {
+		return fmt.Errorf("object_lock mode and retention need to be set together")
+	}
+	if !objectLock.Enabled && (objectLock.Mode != "" || objectLock.LegalHold) {
+		return fmt.Errorf("object_lock mode, retention and legal_hold need object_lock to be enabled")
+	}
+	// Not even the cleanup can delete objects under compliance retention
+	if objectLock.Mode == ObjectLockCompliance && cleanAfter {
+		return fmt.Errorf("clean_after can not delete objects under compliance retention - use the governance mode or disable clean_after")
+	}
+	return nil
+}
+
+// checkEncryption checks the encryption of a test case and uses a single SSE-C key by default
+func checkEncryption(encryption *EncryptionConfiguration) error {
+	switch encryption.Type {
+	case "", EncryptionSSES3:
+	case EncryptionSSEKMS:
+	case EncryptionSSEC:
+		if encryption.CustomerKeys < 0 {
+			return fmt.Errorf("encryption customer_keys must not be negative")
+		}
+		if encryption.CustomerKeys == 0 {
+			encryption.CustomerKeys = 1
+		}
+	default:
+		return fmt.Errorf("%s is not a valid encryption type. Allowed options are %s, %s, %s", encryption.Type, EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC)
+	}
+	if encryption.KMSKeyID != "" && encryption.Type != EncryptionSSEKMS {
+		return fmt.Errorf("encryption kms_key_id can only be used with %s", EncryptionSSEKMS)
+	}
+	return nil
+}
+
+// checkWriteOptions checks the metadata and canned ACL that are sent with every written object
+func checkWriteOptions(writeOptions *WriteOptionsConfiguration) error {
+	if writeOptions.MetadataCount < 0 {
+		return fmt.Errorf("write_options metadata_count must not be negative")
+	}
+	if writeOptions.MetadataCount > 0 && writeOptions.MetadataSize == 0 {
+		return fmt.Errorf("write_options metadata_size needs to be set together with metadata_count")
+	}
+	switch writeOptions.ACL {
+	case "", "private", "public-read", "public-read-write", "authenticated-read",
+		"aws-exec-read", "bucket-owner-read", "bucket-owner-full-control":
+	default:
+		return fmt.Errorf("%s is not a valid canned ACL", writeOptions.ACL)
+	}
+	return nil
+}
+
+// checkObjectSizes checks the object size override of a single operation
+// and converts its sizes to bytes. The unit of the test case's objects is
+// used when the override does not set its own unit.
+func checkObjectSizes(sizes *ObjectSizeConfiguration, operation string, defaultUnit string) error {
+	sampledSizes := isSampledDistribution(sizes.SizeDistribution)
+	if sizes.SizeMin == 0 && !sampledSizes {
+		return fmt.Errorf("Please set minimum size of Objects for %s operations", operation)
+	}
+	if sizes.SizeMax == 0 && !sampledSizes {
+		return fmt.Errorf("Please set maximum size of Objects for %s operations", operation)
+	}
+	if err := checkSizeDistribution(sizes.SizeDistribution, fmt.Sprintf("Object size_distribution for %s operations", operation)); err != nil {
+		return err
+	}
+	if sizes.Unit == "" {
+		sizes.Unit = defaultUnit
+	}
+	toByteMultiplicator, err := getByteMultiplier(sizes.Unit)
 	if err != nil {
 		return err
 	}
-	testcase.Multipart.ReadPartSize = testcase.Multipart.ReadPartSize * toByteMultiplicator
+	sizes.SizeMin = sizes.SizeMin * toByteMultiplicator
+	sizes.SizeMax = sizes.SizeMax * toByteMultiplicator
+	if sampledSizes {
+		sizes.SizeBuckets, err = loadSizeBuckets(sizes.SizeDistribution, sizes.SizeHistogram, sizes.SizeFile, sizes.Unit)
+		if err != nil {
+			return err
+		}
+		sizes.SizeMin, sizes.SizeMax = sizeBucketRange(sizes.SizeBuckets)
+	}
 	return nil
 }
 
+// ObjectSizeOverride returns the object size override of the given operation
+// (read, write, list or delete) or nil if the operation uses the sizes of
+// the test case's objects
+func (testcase *TestCaseConfiguration) ObjectSizeOverride(operation string) *ObjectSizeConfiguration {
+	switch operation {
+	case "read":
+		return testcase.ObjectsPerOperation.Read
+	case "write":
+		return testcase.ObjectsPerOperation.Write
+	case "list":
+		return testcase.ObjectsPerOperation.List
+	case "delete":
+		return testcase.ObjectsPerOperation.Delete
+	}
+	return nil
+}
+
+// MaxObjectSize returns the largest object size any operation of the test case may use
+func (testcase *TestCaseConfiguration) MaxObjectSize() uint64 {
+	maxSize := testcase.Objects.SizeMax
+	for _, operation := range []string{"read", "write", "list", "delete"} {
+		if sizes := testcase.ObjectSizeOverride(operation); sizes != nil && sizes.SizeMax > maxSize {
+			maxSize = sizes.SizeMax
+		}
+	}
+	return maxSize
+}
+
 // Checks if a given string is of type distribution
 func checkDistribution(distribution string, keyname string) error {
 	switch distribution {
@@ -221,19 +1058,45 @@ func EvaluateDistribution(min uint64, max uint64, lastNumber *uint64, increment
 	case "constant":
 		return min
 	case "random":
-		rand.Seed(time.Now().UnixNano())
 		validSize := max - min
-		return ((rand.Uint64() % validSize) + min)
+		return ((random.Uint64() % validSize) + min)
 	case "sequential":
 		if *lastNumber+increment > max {
 			return max
 		}
 		*lastNumber = *lastNumber + increment
 		return *lastNumber
+	case "normal":
+		// Centered between min and max with 99.7% of all values within the range
+		mean := (float64(min) + float64(max)) / 2
+		stddev := (float64(max) - float64(min)) / 6
+		return clamp(random.NormFloat64()*stddev+mean, min, max)
+	case "lognormal":
+		// Same as normal, but in log space - most values are small with a long tail towards max
+		logMin := math.Log(math.Max(float64(min), 1))
+		logMax := math.Log(math.Max(float64(max), 1))
+		mean := (logMin + logMax) / 2
+		stddev := (logMax - logMin) / 6
+		return clamp(math.Exp(random.NormFloat64()*stddev+mean), min, max)
+	case "exponential":
+		// Starts at min with a mean of a fifth of the range - less than 1% of the values are cut off at max
+		mean := (float64(max) - float64(min)) / 5
+		return clamp(float64(min)+random.ExpFloat64()*mean, min, max)
 	}
 	return 0
 }
 
+// clamp rounds the given value and restricts it to the range of min to max
+func clamp(value float64, min uint64, max uint64) uint64 {
+	if value <= float64(min) {
+		return min
+	}
+	if value >= float64(max) {
+		return max
+	}
+	return uint64(math.Round(value))
+}
+
 func getByteMultiplier(unit string) (uint64, error) {
 	switch strings.ToUpper(unit) {
 	case "B":
@@ -284,7 +1147,7 @@ func (d Duration) MarshalYAML() ([]byte, error) {
 
 func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var yamlDuration time.Duration
-	err := unmarshal(yamlDuration)
+	err := unmarshal(&yamlDuration)
 	if err != nil {
 		return err
 	}
@@ -292,3 +1155,66 @@ func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*d = Duration(yamlDuration)
 	return nil
 }
+
+// SizeHistogram maps object sizes to their weights. A weight can be
+// given as number or as string, like 60 or 60%
+type SizeHistogram map[string]string
+
+func (h *SizeHistogram) UnmarshalJSON(data []byte) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	histogram := make(SizeHistogram, len(v))
+	for size, weight := range v {
+		switch value := weight.(type) {
+		case float64:
+			histogram[size] = strconv.FormatFloat(value, 'f', -1, 64)
+		case string:
+			histogram[size] = value
+		default:
+			return fmt.Errorf("invalid weight %v for size %s in size_histogram", weight, size)
+		}
+	}
+	*h = histogram
+	return nil
+}
+
+// ByteSize is an amount of bytes that can be given as plain number
+// or with a unit, like 10GB
+type ByteSize uint64
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*b = ByteSize(value)
+		return nil
+	case string:
+		size, err := parseSize(value, "B")
+		if err != nil {
+			return err
+		}
+		*b = ByteSize(size)
+		return nil
+	default:
+		return errors.New("invalid byte size")
+	}
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var yamlSize string
+	err := unmarshal(&yamlSize)
+	if err != nil {
+		return err
+	}
+	size, err := parseSize(yamlSize, "B")
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
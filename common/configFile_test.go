@@ -1,8 +1,12 @@
 package common
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 func Test_checkTestCase(t *testing.T) {
@@ -39,7 +43,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -61,7 +68,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -84,7 +94,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -108,7 +121,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -133,7 +149,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -160,7 +179,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -187,7 +209,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -215,7 +240,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -243,7 +271,10 @@ func Test_checkTestCase(t *testing.T) {
 				SizeMin            uint64 `yaml:"size_min" json:"size_min"`
 				SizeMax            uint64 `yaml:"size_max" json:"size_max"`
 				SizeLast           uint64
-				SizeDistribution   string `yaml:"size_distribution" json:"size_distribution"`
+				SizeDistribution   string        `yaml:"size_distribution" json:"size_distribution"`
+				SizeHistogram      SizeHistogram `yaml:"size_histogram" json:"size_histogram"`
+				SizeFile           string        `yaml:"size_file" json:"size_file"`
+				SizeBuckets        []SizeBucket
 				NumberMin          uint64 `yaml:"number_min" json:"number_min"`
 				NumberMax          uint64 `yaml:"number_max" json:"number_max"`
 				NumberLast         uint64
@@ -267,6 +298,246 @@ func Test_checkTestCase(t *testing.T) {
 	}
 }
 
+func Test_checkS3Config(t *testing.T) {
+	noRetries := 0
+	negativeRetries := -1
+	tests := []struct {
+		name     string
+		s3Config S3Configuration
+		wantErr  bool
+	}{
+		{"SDK default retries", S3Configuration{}, false},
+		{"No retries", S3Configuration{MaxRetries: &noRetries}, false},
+		{"Negative retries", S3Configuration{MaxRetries: &negativeRetries}, true},
+		{"Valid retry delays", S3Configuration{RetryMinDelay: Duration(time.Millisecond), RetryMaxDelay: Duration(time.Second)}, false},
+		{"Only min retry delay", S3Configuration{RetryMinDelay: Duration(time.Second)}, false},
+		{"Min retry delay greater than max", S3Configuration{RetryMinDelay: Duration(time.Minute), RetryMaxDelay: Duration(time.Second)}, true},
+		{"Min throttle delay greater than max", S3Configuration{RetryMinThrottleDelay: Duration(time.Minute), RetryMaxThrottleDelay: Duration(time.Second)}, true},
+		{"Virtual-hosted-style", S3Configuration{AddressingStyle: AddressingStyleVirtual}, false},
+		{"Wrong addressing style", S3Configuration{AddressingStyle: "dns"}, true},
+		{"Signed payload", S3Configuration{PayloadSigning: PayloadSigningSigned}, false},
+		{"Unsigned payload", S3Configuration{PayloadSigning: PayloadSigningUnsigned}, false},
+		{"IPv6 only", S3Configuration{IPFamily: IPFamilyIPv6}, false},
+		{"Wrong IP family", S3Configuration{IPFamily: "ipv5"}, true},
+		{"Wrong payload signing", S3Configuration{PayloadSigning: "streaming"}, true},
+		{"Bigger connection pool", S3Configuration{MaxIdleConns: 500, MaxConnsPerHost: 500}, false},
+		{"Negative connection pool", S3Configuration{MaxIdleConns: -1}, true},
+		{"Client certificate", S3Configuration{ClientCertFile: "client.crt", ClientKeyFile: "client.key"}, false},
+		{"Client certificate without key", S3Configuration{ClientCertFile: "client.crt"}, true},
+		{"Wrong TLS version", S3Configuration{MinTLSVersion: "1.4"}, true},
+		{"Wrong cipher suite", S3Configuration{CipherSuites: []string{"TLS_MADE_UP"}}, true},
+		{"Endpoints", S3Configuration{Endpoints: []string{"http://node1:8080", "http://node2:8080"}, EndpointBalancing: EndpointBalancingLeastOutstanding}, false},
+		{"Endpoint and endpoints", S3Configuration{Endpoint: "http://node1:8080", Endpoints: []string{"http://node2:8080"}}, true},
+		{"Endpoints without scheme", S3Configuration{Endpoints: []string{"node1:8080"}}, true},
+		{"Wrong endpoint balancing", S3Configuration{EndpointBalancing: "weighted"}, true},
+		{"Assume role", S3Configuration{CredentialsSource: CredentialsSourceChain, RoleARN: "arn:aws:iam::123456789012:role/bench", RoleDuration: Duration(time.Hour)}, false},
+		{"Web identity", S3Configuration{CredentialsSource: CredentialsSourceWebIdentity, RoleARN: "arn:aws:iam::123456789012:role/bench", WebIdentityTokenFile: "token"}, false},
+		{"Web identity without token file", S3Configuration{CredentialsSource: CredentialsSourceWebIdentity, RoleARN: "arn:aws:iam::123456789012:role/bench"}, true},
+		{"Wrong credentials source", S3Configuration{CredentialsSource: "vault"}, true},
+		{"Filesystem backend", S3Configuration{Backend: BackendFilesystem, Filesystem: FilesystemConfiguration{Root: "/mnt/cephfs", Fsync: true}}, false},
+		{"Filesystem backend without root", S3Configuration{Backend: BackendFilesystem}, true},
+		{"Wrong backend", S3Configuration{Backend: "ftp"}, true},
+		{"Azure backend", S3Configuration{Backend: BackendAzure, Azure: AzureConfiguration{AccountName: "devstoreaccount1", AccountKey: "a2V5", Endpoint: "http://127.0.0.1:10000/devstoreaccount1"}}, false},
+		{"Azure backend with default endpoint", S3Configuration{Backend: BackendAzure, Azure: AzureConfiguration{AccountName: "account", AccountKey: "a2V5"}}, false},
+		{"Azure backend without key", S3Configuration{Backend: BackendAzure, Azure: AzureConfiguration{AccountName: "account"}}, true},
+		{"Azure backend with wrong key", S3Configuration{Backend: BackendAzure, Azure: AzureConfiguration{AccountName: "account", AccountKey: "no base64!"}}, true},
+		{"GCS backend for emulators", S3Configuration{Backend: BackendGCS, GCS: GCSConfiguration{Endpoint: "http://localhost:4443"}}, false},
+		{"GCS backend with service account", S3Configuration{Backend: BackendGCS, GCS: GCSConfiguration{Project: "bench", Auth: GCSAuthServiceAccount, CredentialsFile: "key.json"}}, false},
+		{"GCS backend without token", S3Configuration{Backend: BackendGCS, GCS: GCSConfiguration{Auth: GCSAuthToken}}, true},
+		{"GCS backend with wrong auth", S3Configuration{Backend: BackendGCS, GCS: GCSConfiguration{Auth: "hmac"}}, true},
+		{"Swift backend with TempAuth", S3Configuration{Backend: BackendSwift, Swift: SwiftConfiguration{AuthURL: "http://swift:8080/auth/v1.0", User: "test:tester", Key: "testing"}}, false},
+		{"Swift backend with Keystone", S3Configuration{Backend: BackendSwift, Swift: SwiftConfiguration{Auth: SwiftAuthKeystone, AuthURL: "http://keystone:5000/v3", User: "bench", Key: "secret", Project: "bench", LargeObjects: SwiftLargeObjectsDynamic}}, false},
+		{"Swift backend with Keystone without project", S3Configuration{Backend: BackendSwift, Swift: SwiftConfiguration{Auth: SwiftAuthKeystone, AuthURL: "http://keystone:5000/v3", User: "bench", Key: "secret"}}, true},
+		{"Swift backend without key", S3Configuration{Backend: BackendSwift, Swift: SwiftConfiguration{AuthURL: "http://swift:8080/auth/v1.0", User: "test:tester"}}, true},
+		{"Swift backend with wrong large objects", S3Configuration{Backend: BackendSwift, Swift: SwiftConfiguration{AuthURL: "http://swift:8080/auth/v1.0", User: "test:tester", Key: "testing", LargeObjects: "xlo"}}, true},
+		{"Null backend", S3Configuration{Backend: BackendNull, Null: NullConfiguration{Latency: Duration(time.Millisecond), LatencyJitter: Duration(time.Millisecond)}}, false},
+		{"Null backend with negative latency", S3Configuration{Backend: BackendNull, Null: NullConfiguration{Latency: Duration(-time.Millisecond)}}, true},
+		{"Azure backend with wrong endpoint", S3Configuration{Backend: BackendAzure, Azure: AzureConfiguration{AccountName: "account", AccountKey: "a2V5", Endpoint: "127.0.0.1:10000"}}, true},
+		{"Negative refresh interval", S3Configuration{CredentialsRefreshInterval: Duration(-time.Second)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkS3Config(&tt.s3Config); (err != nil) != tt.wantErr {
+				t.Errorf("checkS3Config() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (tt.s3Config.AddressingStyle == "" || tt.s3Config.PayloadSigning == "" || tt.s3Config.IPFamily == "" ||
+				tt.s3Config.MaxIdleConns == 0 || tt.s3Config.DialTimeout == 0 || tt.s3Config.TCPKeepAlive == 0 || tt.s3Config.EndpointBalancing == "" ||
+				tt.s3Config.CredentialsSource == "" || tt.s3Config.Backend == "") {
+				t.Errorf("checkS3Config() did not set the defaults, got %+v", tt.s3Config)
+			}
+		})
+	}
+}
+
+func Test_checkEncryption(t *testing.T) {
+	tests := []struct {
+		name             string
+		encryption       EncryptionConfiguration
+		wantCustomerKeys int
+		wantErr          bool
+	}{
+		{"No encryption", EncryptionConfiguration{}, 0, false},
+		{"SSE-S3", EncryptionConfiguration{Type: EncryptionSSES3}, 0, false},
+		{"SSE-KMS with key", EncryptionConfiguration{Type: EncryptionSSEKMS, KMSKeyID: "arn:aws:kms:key"}, 0, false},
+		{"SSE-C with default keys", EncryptionConfiguration{Type: EncryptionSSEC}, 1, false},
+		{"SSE-C with many keys", EncryptionConfiguration{Type: EncryptionSSEC, CustomerKeys: 16}, 16, false},
+		{"SSE-C with negative keys", EncryptionConfiguration{Type: EncryptionSSEC, CustomerKeys: -1}, 0, true},
+		{"KMS key without SSE-KMS", EncryptionConfiguration{Type: EncryptionSSES3, KMSKeyID: "arn:aws:kms:key"}, 0, true},
+		{"Wrong type", EncryptionConfiguration{Type: "sse-x"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEncryption(&tt.encryption)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkEncryption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tt.encryption.CustomerKeys != tt.wantCustomerKeys {
+				t.Errorf("checkEncryption() CustomerKeys = %v, want %v", tt.encryption.CustomerKeys, tt.wantCustomerKeys)
+			}
+		})
+	}
+}
+
+func Test_checkWriteOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		writeOptions WriteOptionsConfiguration
+		wantErr      bool
+	}{
+		{"No options", WriteOptionsConfiguration{}, false},
+		{"All options", WriteOptionsConfiguration{StorageClass: "GLACIER", MetadataCount: 10, MetadataSize: 64,
+			Tags: map[string]string{"a": "b"}, ACL: "public-read", ContentType: "text/plain"}, false},
+		{"Metadata without size", WriteOptionsConfiguration{MetadataCount: 10}, true},
+		{"Negative metadata count", WriteOptionsConfiguration{MetadataCount: -1, MetadataSize: 64}, true},
+		{"Wrong ACL", WriteOptionsConfiguration{ACL: "everyone"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkWriteOptions(&tt.writeOptions); (err != nil) != tt.wantErr {
+				t.Errorf("checkWriteOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkMultipartLifecycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		lifecycle  MultipartLifecycleConfiguration
+		mpuEnabled bool
+		want       MultipartLifecycleConfiguration
+		wantErr    bool
+	}{
+		{"Defaults", MultipartLifecycleConfiguration{}, false,
+			MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeSDK, WritePartOrder: PartOrderSequential}, false},
+		{"All options", MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeExplicit, WritePartOrder: PartOrderRandom, WriteAbortRatio: 0.1, WritePartCopy: true}, true,
+			MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeExplicit, WritePartOrder: PartOrderRandom, WriteAbortRatio: 0.1, WritePartCopy: true}, false},
+		{"Wrong mode", MultipartLifecycleConfiguration{WriteMPUMode: "manual"}, true, MultipartLifecycleConfiguration{}, true},
+		{"Wrong part order", MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeExplicit, WritePartOrder: "backwards"}, true, MultipartLifecycleConfiguration{}, true},
+		{"Abort ratio above 1", MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeExplicit, WriteAbortRatio: 1.5}, true, MultipartLifecycleConfiguration{}, true},
+		{"Explicit without multipart", MultipartLifecycleConfiguration{WriteMPUMode: MultipartModeExplicit}, false, MultipartLifecycleConfiguration{}, true},
+		{"Part copy with the SDK", MultipartLifecycleConfiguration{WritePartCopy: true}, true, MultipartLifecycleConfiguration{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMultipartLifecycle(&tt.lifecycle, tt.mpuEnabled)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkMultipartLifecycle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.lifecycle != tt.want {
+				t.Errorf("checkMultipartLifecycle() = %+v, want %+v", tt.lifecycle, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkVersioning(t *testing.T) {
+	tests := []struct {
+		name       string
+		versioning VersioningConfiguration
+		want       VersioningConfiguration
+		wantErr    bool
+	}{
+		{"Defaults", VersioningConfiguration{},
+			VersioningConfiguration{Versions: 1, Read: VersionLatest, Delete: VersionMarker}, false},
+		{"All options", VersioningConfiguration{Enabled: true, Versions: 3, Read: VersionSpecific, Delete: VersionSpecific},
+			VersioningConfiguration{Enabled: true, Versions: 3, Read: VersionSpecific, Delete: VersionSpecific}, false},
+		{"Negative versions", VersioningConfiguration{Enabled: true, Versions: -1}, VersioningConfiguration{}, true},
+		{"Wrong read", VersioningConfiguration{Enabled: true, Read: VersionMarker}, VersioningConfiguration{}, true},
+		{"Wrong delete", VersioningConfiguration{Enabled: true, Delete: "purge"}, VersioningConfiguration{}, true},
+		{"Versions without versioning", VersioningConfiguration{Versions: 2}, VersioningConfiguration{}, true},
+		{"Specific reads without versioning", VersioningConfiguration{Read: VersionSpecific}, VersioningConfiguration{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVersioning(&tt.versioning)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkVersioning() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.versioning != tt.want {
+				t.Errorf("checkVersioning() = %+v, want %+v", tt.versioning, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkObjectLock(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectLock ObjectLockConfiguration
+		cleanAfter bool
+		wantErr    bool
+	}{
+		{"Disabled", ObjectLockConfiguration{}, true, false},
+		{"Lock without retention", ObjectLockConfiguration{Enabled: true}, true, false},
+		{"Governance with cleanup", ObjectLockConfiguration{Enabled: true, Mode: ObjectLockGovernance, Retention: Duration(time.Hour), LegalHold: true}, true, false},
+		{"Compliance without cleanup", ObjectLockConfiguration{Enabled: true, Mode: ObjectLockCompliance, Retention: Duration(time.Hour)}, false, false},
+		{"Compliance with cleanup", ObjectLockConfiguration{Enabled: true, Mode: ObjectLockCompliance, Retention: Duration(time.Hour)}, true, true},
+		{"Wrong mode", ObjectLockConfiguration{Enabled: true, Mode: "worm", Retention: Duration(time.Hour)}, false, true},
+		{"Mode without retention", ObjectLockConfiguration{Enabled: true, Mode: ObjectLockGovernance}, false, true},
+		{"Retention without mode", ObjectLockConfiguration{Enabled: true, Retention: Duration(time.Hour)}, false, true},
+		{"Negative retention", ObjectLockConfiguration{Enabled: true, Mode: ObjectLockGovernance, Retention: Duration(-time.Hour)}, false, true},
+		{"Legal hold without lock", ObjectLockConfiguration{LegalHold: true}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkObjectLock(&tt.objectLock, tt.cleanAfter); (err != nil) != tt.wantErr {
+				t.Errorf("checkObjectLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkBackendFeatures(t *testing.T) {
+	versioned := &TestCaseConfiguration{}
+	versioned.Versioning.Enabled = true
+	locked := &TestCaseConfiguration{}
+	locked.ObjectLock.Enabled = true
+	tests := []struct {
+		name     string
+		testcase *TestCaseConfiguration
+		backends []string
+		wantErr  bool
+	}{
+		{"Versioning with S3", versioned, []string{BackendS3, BackendS3}, false},
+		{"Versioning with swift", versioned, []string{BackendS3, BackendSwift}, true},
+		{"No versioning", &TestCaseConfiguration{}, []string{BackendFilesystem}, false},
+		{"Object Lock with S3", locked, []string{BackendS3}, false},
+		{"Object Lock with the null backend", locked, []string{BackendNull}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configs []*S3Configuration
+			for _, backend := range tt.backends {
+				configs = append(configs, &S3Configuration{Backend: backend})
+			}
+			if err := checkBackendFeatures(tt.testcase, configs); (err != nil) != tt.wantErr {
+				t.Errorf("checkBackendFeatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_checkDistribution(t *testing.T) {
 	type args struct {
 		distribution string
@@ -280,6 +551,10 @@ func Test_checkDistribution(t *testing.T) {
 		{"constant distribution", args{"constant", "test"}, false},
 		{"random distribution", args{"random", "test"}, false},
 		{"sequential distribution", args{"sequential", "test"}, false},
+		{"normal is only a size distribution", args{"normal", "test"}, true},
+		{"lognormal is only a size distribution", args{"lognormal", "test"}, true},
+		{"exponential is only a size distribution", args{"exponential", "test"}, true},
+		{"histogram is only a size distribution", args{"histogram", "test"}, true},
 		{"wrong distribution", args{"wrong", "test"}, true},
 	}
 	for _, tt := range tests {
@@ -319,3 +594,157 @@ func TestEvaluateDistribution(t *testing.T) {
 		})
 	}
 }
+
+func Test_checkObjectSizes(t *testing.T) {
+	type args struct {
+		sizes       *ObjectSizeConfiguration
+		defaultUnit string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *ObjectSizeConfiguration
+		wantErr bool
+	}{
+		{"No size min defined", args{&ObjectSizeConfiguration{SizeMax: 2, SizeDistribution: "constant"}, "KB"}, nil, true},
+		{"No size max defined", args{&ObjectSizeConfiguration{SizeMin: 1, SizeDistribution: "constant"}, "KB"}, nil, true},
+		{"Wrong distribution", args{&ObjectSizeConfiguration{SizeMin: 1, SizeMax: 2, SizeDistribution: "wrong"}, "KB"}, nil, true},
+		{"Default unit", args{&ObjectSizeConfiguration{SizeMin: 1, SizeMax: 2, SizeDistribution: "random"}, "KB"},
+			&ObjectSizeConfiguration{SizeMin: 1024, SizeMax: 2048, SizeDistribution: "random", Unit: "KB"}, false},
+		{"Own unit", args{&ObjectSizeConfiguration{SizeMin: 1, SizeMax: 2, SizeDistribution: "random", Unit: "MB"}, "KB"},
+			&ObjectSizeConfiguration{SizeMin: MEGABYTE, SizeMax: 2 * MEGABYTE, SizeDistribution: "random", Unit: "MB"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkObjectSizes(tt.args.sizes, "read", tt.args.defaultUnit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkObjectSizes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !reflect.DeepEqual(tt.args.sizes, tt.want) {
+				t.Errorf("checkObjectSizes() = %v, want %v", *tt.args.sizes, *tt.want)
+			}
+		})
+	}
+}
+
+func TestTestCaseConfiguration_MaxObjectSize(t *testing.T) {
+	testcase := &TestCaseConfiguration{}
+	testcase.Objects.SizeMax = 100
+	if got := testcase.MaxObjectSize(); got != 100 {
+		t.Errorf("MaxObjectSize() = %v, want %v", got, 100)
+	}
+	testcase.ObjectsPerOperation.Read = &ObjectSizeConfiguration{SizeMax: 1000}
+	if got := testcase.MaxObjectSize(); got != 1000 {
+		t.Errorf("MaxObjectSize() = %v, want %v", got, 1000)
+	}
+}
+
+func Test_setTestSeed(t *testing.T) {
+	tests := []struct {
+		name         string
+		testSeed     int64
+		workloadSeed int64
+		testNumber   int
+		want         int64
+	}{
+		{"own seed", 42, 1, 3, 42},
+		{"derived from workload seed", 0, 100, 3, 103},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testcase := &TestCaseConfiguration{Seed: tt.testSeed}
+			setTestSeed(testcase, tt.workloadSeed, tt.testNumber)
+			if testcase.Seed != tt.want {
+				t.Errorf("setTestSeed() = %v, want %v", testcase.Seed, tt.want)
+			}
+		})
+	}
+	testcase := &TestCaseConfiguration{}
+	setTestSeed(testcase, 0, 0)
+	if testcase.Seed == 0 {
+		t.Errorf("setTestSeed() did not set a random seed")
+	}
+}
+
+func TestDriverSeed(t *testing.T) {
+	if DriverSeed(42, "d0") != DriverSeed(42, "d0") {
+		t.Errorf("DriverSeed() is not reproducible")
+	}
+	if DriverSeed(42, "d0") == DriverSeed(42, "d1") {
+		t.Errorf("DriverSeed() returns the same seed for different drivers")
+	}
+}
+
+func TestSeedRandom(t *testing.T) {
+	draw := func() []uint64 {
+		SeedRandom(42)
+		var numbers []uint64
+		for i := 0; i < 10; i++ {
+			numbers = append(numbers, EvaluateDistribution(1, 1000, nil, 1, "random"))
+		}
+		return numbers
+	}
+	if first, second := draw(), draw(); !reflect.DeepEqual(first, second) {
+		t.Errorf("EvaluateDistribution() after SeedRandom() = %v, want %v", second, first)
+	}
+}
+
+func TestTestCaseConfiguration_UnmarshalYAML(t *testing.T) {
+	var testcase TestCaseConfiguration
+	err := yaml.Unmarshal([]byte(`stop_with_runtime: 60s
+stop_with_bytes: 10GB
+stop_on_error_ratio: 0.05
+stop_on_latency_p99: 500ms
+multipart:
+  write_mpu_enabled: true
+  write_mpu_mode: explicit
+  write_part_order: reverse`), &testcase)
+	if err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	if testcase.Runtime != Duration(time.Minute) {
+		t.Errorf("Runtime = %v, want %v", testcase.Runtime, time.Minute)
+	}
+	if testcase.BytesDeadline != 10*GIGABYTE {
+		t.Errorf("BytesDeadline = %v, want %v", testcase.BytesDeadline, 10*GIGABYTE)
+	}
+	if testcase.MaxErrorRatio != 0.05 {
+		t.Errorf("MaxErrorRatio = %v, want %v", testcase.MaxErrorRatio, 0.05)
+	}
+	if testcase.MaxLatencyP99 != Duration(500*time.Millisecond) {
+		t.Errorf("MaxLatencyP99 = %v, want %v", testcase.MaxLatencyP99, 500*time.Millisecond)
+	}
+	if testcase.Multipart.WriteMPUMode != MultipartModeExplicit || testcase.Multipart.WritePartOrder != PartOrderReverse {
+		t.Errorf("Multipart = %+v, want the inline lifecycle options", testcase.Multipart)
+	}
+}
+
+func TestByteSize_UnmarshalJSON(t *testing.T) {
+	var sizes []ByteSize
+	if err := json.Unmarshal([]byte(`[1024, "4KB"]`), &sizes); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(sizes, []ByteSize{KILOBYTE, 4 * KILOBYTE}) {
+		t.Errorf("json.Unmarshal() = %v, want %v", sizes, []ByteSize{KILOBYTE, 4 * KILOBYTE})
+	}
+}
+
+func TestSizeHistogram_Unmarshal(t *testing.T) {
+	want := []SizeBucket{{4 * KILOBYTE, 60}, {MEGABYTE, 30.5}, {64 * MEGABYTE, 10}}
+	var fromJSON ObjectSizeConfiguration
+	if err := json.Unmarshal([]byte(`{"size_histogram": {"4KB": 60, "1MB": 30.5, "64MB": "10%"}}`), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	var fromYAML ObjectSizeConfiguration
+	if err := yaml.Unmarshal([]byte(`size_histogram: {4KB: 60, 1MB: 30.5, 64MB: 10%}`), &fromYAML); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	for _, histogram := range []SizeHistogram{fromJSON.SizeHistogram, fromYAML.SizeHistogram} {
+		if got, err := loadSizeBuckets("histogram", histogram, "", "B"); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("loadSizeBuckets() = %v, %v, want %v", got, err, want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"size_histogram": {"4KB": true}}`), &fromJSON); err == nil {
+		t.Errorf("json.Unmarshal() of a boolean weight succeeded")
+	}
+}
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SizeBucket is a single object size of a histogram or file based
+// size distribution together with its relative weight
+type SizeBucket struct {
+	Size   uint64
+	Weight float64
+}
+
+// isSampledDistribution checks if the object sizes of the given distribution
+// are sampled from size buckets instead of being derived from size_min and size_max
+func isSampledDistribution(distribution string) bool {
+	return distribution == "histogram" || distribution == "file"
+}
+
+// Checks if a given string is a valid distribution for object sizes
+func checkSizeDistribution(distribution string, keyname string) error {
+	switch distribution {
+	case "normal", "lognormal", "exponential":
+		return nil
+	}
+	if isSampledDistribution(distribution) || checkDistribution(distribution, keyname) == nil {
+		return nil
+	}
+	return fmt.Errorf("%s is not a valid distribution. Allowed options are constant, random, sequential, normal, lognormal, exponential, histogram, file", keyname)
+}
+
+// loadSizeBuckets converts the size_histogram or the content of size_file
+// into size buckets, depending on the given distribution. Sizes without a
+// unit are interpreted in the given unit for histograms and in bytes for files.
+func loadSizeBuckets(distribution string, histogram map[string]string, file string, unit string) ([]SizeBucket, error) {
+	var buckets []SizeBucket
+	var err error
+	switch distribution {
+	case "histogram":
+		buckets, err = parseSizeHistogram(histogram, unit)
+	case "file":
+		buckets, err = readSizeFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("The %s size distribution does not contain any object sizes", distribution)
+	}
+	return buckets, nil
+}
+
+// parseSizeHistogram parses a histogram like {4KB: 60%, 1MB: 30%, 64MB: 10%}
+func parseSizeHistogram(histogram map[string]string, unit string) ([]SizeBucket, error) {
+	buckets := make([]SizeBucket, 0, len(histogram))
+	for size, weight := range histogram {
+		bucket := SizeBucket{}
+		var err error
+		bucket.Size, err = parseSize(size, unit)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid size %s in size_histogram: %v", size, err)
+		}
+		bucket.Weight, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(weight), "%")), 64)
+		if err != nil || bucket.Weight < 0 {
+			return nil, fmt.Errorf("Invalid weight %s for size %s in size_histogram", weight, size)
+		}
+		buckets = append(buckets, bucket)
+	}
+	// Map iteration is random - sort to get the same buckets on every run
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Size < buckets[j].Size
+	})
+	return buckets, nil
+}
+
+// readSizeFile reads object sizes from a CSV file. The first column contains
+// the object size, an optional second column its weight. Lines with the same
+// size are merged into one bucket. A header line is skipped.
+func readSizeFile(file string) ([]SizeBucket, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open size_file: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	weights := map[uint64]float64{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read size_file %s: %v", file, err)
+		}
+		if len(record) == 0 || record[0] == "" {
+			continue
+		}
+		size, err := parseSize(record[0], "B")
+		if err != nil {
+			if line == 1 {
+				// Header line
+				continue
+			}
+			return nil, fmt.Errorf("Invalid size %s in line %d of size_file %s", record[0], line, file)
+		}
+		weight := float64(1)
+		if len(record) > 1 && record[1] != "" {
+			weight, err = strconv.ParseFloat(strings.TrimSuffix(record[1], "%"), 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("Invalid weight %s in line %d of size_file %s", record[1], line, file)
+			}
+		}
+		weights[size] += weight
+	}
+	buckets := make([]SizeBucket, 0, len(weights))
+	for size, weight := range weights {
+		buckets = append(buckets, SizeBucket{Size: size, Weight: weight})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Size < buckets[j].Size
+	})
+	return buckets, nil
+}
+
+// parseSize parses sizes like 4KB or 64 M into bytes. Sizes without
+// a unit are interpreted in the given default unit.
+func parseSize(size string, defaultUnit string) (uint64, error) {
+	size = strings.TrimSpace(size)
+	numberEnd := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := defaultUnit
+	if numberEnd != -1 {
+		unit = strings.TrimSpace(size[numberEnd:])
+		size = size[:numberEnd]
+	}
+	number, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, err
+	}
+	toByteMultiplicator, err := getByteMultiplier(unit)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(number * float64(toByteMultiplicator)), nil
+}
+
+// sizeBucketRange returns the smallest and largest size of the buckets
+func sizeBucketRange(buckets []SizeBucket) (uint64, uint64) {
+	min, max := buckets[0].Size, buckets[0].Size
+	for _, bucket := range buckets {
+		if bucket.Size < min {
+			min = bucket.Size
+		}
+		if bucket.Size > max {
+			max = bucket.Size
+		}
+	}
+	return min, max
+}
+
+// EvaluateSizeDistribution returns the next object size. Histogram and file
+// based distributions sample from the given size buckets, all others are
+// handled by EvaluateDistribution.
+func EvaluateSizeDistribution(min uint64, max uint64, lastNumber *uint64, distribution string, buckets []SizeBucket) uint64 {
+	if !isSampledDistribution(distribution) {
+		return EvaluateDistribution(min, max, lastNumber, 1, distribution)
+	}
+	if len(buckets) == 0 {
+		return min
+	}
+	totalWeight := float64(0)
+	for _, bucket := range buckets {
+		totalWeight += bucket.Weight
+	}
+	pick := random.Float64() * totalWeight
+	for _, bucket := range buckets {
+		if pick < bucket.Weight {
+			return bucket.Size
+		}
+		pick -= bucket.Weight
+	}
+	return buckets[len(buckets)-1].Size
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSize(t *testing.T) {
+	type args struct {
+		size        string
+		defaultUnit string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    uint64
+		wantErr bool
+	}{
+		{"size with unit", args{"4KB", "B"}, 4 * KILOBYTE, false},
+		{"size with short unit and space", args{"64 M", "B"}, 64 * MEGABYTE, false},
+		{"fractional size", args{"1.5KB", "B"}, 1536, false},
+		{"size without unit", args{"10", "KB"}, 10 * KILOBYTE, false},
+		{"wrong unit", args{"10XB", "KB"}, 0, true},
+		{"no number", args{"KB", "KB"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSize(tt.args.size, tt.args.defaultUnit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSizeHistogram(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram map[string]string
+		want      []SizeBucket
+		wantErr   bool
+	}{
+		{"percentages", map[string]string{"64MB": "10%", "4KB": "60%", "1MB": "30%"},
+			[]SizeBucket{{4 * KILOBYTE, 60}, {MEGABYTE, 30}, {64 * MEGABYTE, 10}}, false},
+		{"plain weights in default unit", map[string]string{"1": "1", "2": "3"},
+			[]SizeBucket{{KILOBYTE, 1}, {2 * KILOBYTE, 3}}, false},
+		{"wrong weight", map[string]string{"1": "a lot"}, nil, true},
+		{"negative weight", map[string]string{"1": "-1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSizeHistogram(tt.histogram, "KB")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSizeHistogram() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSizeHistogram() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readSizeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosbench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name    string
+		content string
+		want    []SizeBucket
+		wantErr bool
+	}{
+		{"sizes with header", "size\n100\n200\n100\n", []SizeBucket{{100, 2}, {200, 1}}, false},
+		{"sizes with weights", "4KB,60\n1MB,40\n", []SizeBucket{{4 * KILOBYTE, 60}, {MEGABYTE, 40}}, false},
+		{"empty file", "", nil, false},
+		{"broken size", "100\nabc\n", nil, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, string(rune('a'+i)))
+			if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readSizeFile(file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readSizeFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("readSizeFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := readSizeFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("readSizeFile() of missing file did not return an error")
+	}
+}
+
+func Test_checkSizeDistribution(t *testing.T) {
+	tests := []struct {
+		distribution string
+		wantErr      bool
+	}{
+		{"constant", false},
+		{"sequential", false},
+		{"normal", false},
+		{"lognormal", false},
+		{"exponential", false},
+		{"histogram", false},
+		{"file", false},
+		{"wrong", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.distribution, func(t *testing.T) {
+			if err := checkSizeDistribution(tt.distribution, "test"); (err != nil) != tt.wantErr {
+				t.Errorf("checkSizeDistribution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateSizeDistribution(t *testing.T) {
+	lastNumber := uint64(0)
+	buckets := []SizeBucket{{100, 0}, {200, 1}, {300, 0}}
+	for i := 0; i < 100; i++ {
+		if got := EvaluateSizeDistribution(100, 300, &lastNumber, "histogram", buckets); got != 200 {
+			t.Fatalf("EvaluateSizeDistribution() = %v, want %v", got, 200)
+		}
+	}
+	for _, distribution := range []string{"normal", "lognormal", "exponential"} {
+		for i := 0; i < 1000; i++ {
+			if got := EvaluateSizeDistribution(100, 300, &lastNumber, distribution, nil); got < 100 || got > 300 {
+				t.Fatalf("EvaluateSizeDistribution() with %s distribution = %v, want value between 100 and 300", distribution, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions maps the allowed values of min_tls_version to their TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion converts a TLS version like 1.2 into its crypto/tls constant.
+// An empty version returns 0, which leaves the choice to crypto/tls.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	tlsVersion, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(version), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("%s is not a valid TLS version. Allowed options are 1.0, 1.1, 1.2, 1.3", version)
+	}
+	return tlsVersion, nil
+}
+
+// ParseCipherSuites converts cipher suite names like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+// into their IDs. No names return nil, which leaves the choice to crypto/tls.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	available := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		available[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid cipher suite", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
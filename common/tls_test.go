@@ -0,0 +1,60 @@
+package common
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{"Unset", "", 0, false},
+		{"TLS 1.2", "1.2", tls.VersionTLS12, false},
+		{"TLS 1.3 with prefix", "TLS1.3", tls.VersionTLS13, false},
+		{"Unknown version", "2.0", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTLSVersion(tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTLSVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseTLSVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []uint16
+		wantErr bool
+	}{
+		{"Unset", nil, nil, false},
+		{"Secure suites", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+			[]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, false},
+		{"Insecure suite", []string{"TLS_RSA_WITH_RC4_128_SHA"}, []uint16{tls.TLS_RSA_WITH_RC4_128_SHA}, false},
+		{"Unknown suite", []string{"TLS_MADE_UP"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCipherSuites(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCipherSuites() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCipherSuites() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// azureAPIVersion is the version of the Blob REST API - supported by Azure and Azurite
+const azureAPIVersion = "2019-12-12"
+
+// azureBackend is the Backend of the Azure Blob REST API with SharedKey
+// authorization. Containers are buckets and block blobs are objects.
+// Multipart uploads are done with block lists.
+type azureBackend struct {
+	client      *http.Client
+	endpoint    *url.URL
+	accountName string
+	accountKey  []byte
+	timeout     time.Duration
+}
+
+func newAzureBackend(config common.S3Configuration, client *http.Client) (*azureBackend, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Azure.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(config.Azure.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+	return &azureBackend{
+		client:      client,
+		endpoint:    endpoint,
+		accountName: config.Azure.AccountName,
+		accountKey:  key,
+		timeout:     time.Duration(config.Timeout),
+	}, nil
+}
+
+// azureErrorResponse is the body of failed requests
+type azureErrorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// azureBlobList is the result of listing the blobs of a container
+type azureBlobList struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64 `xml:"Content-Length"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// azureBlockList commits the uploaded blocks of a blob
+type azureBlockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+func (b *azureBackend) url(container string, blob string, query url.Values) string {
+	u := *b.endpoint
+	u.Path += "/" + container
+	if blob != "" {
+		u.Path += "/" + blob
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (b *azureBackend) do(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	return doREST(ctx, b, b.client, b.timeout, method, url, header, body, length)
+}
+
+func (b *azureBackend) doAndDiscard(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) error {
+	return discardResponse(b.do(ctx, method, url, header, body, length))
+}
+
+// authorize signs a request with the SharedKey of the account
+func (b *azureBackend) authorize(req *http.Request) error {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", b.accountName, b.signature(req)))
+	return nil
+}
+
+// failed treats redirects as errors as well - the Blob service does not send any
+func (b *azureBackend) failed(status int) bool {
+	return status >= 300
+}
+
+func (b *azureBackend) requestError(resp *http.Response, body []byte) error {
+	var azureErr azureErrorResponse
+	if len(body) != 0 {
+		// Errors of HEAD requests have no body, only the x-ms-error-code header
+		_ = xml.Unmarshal(body, &azureErr)
+	}
+	if azureErr.Code == "" {
+		azureErr.Code = resp.Header.Get("x-ms-error-code")
+	}
+	return newRequestFailure(resp, azureErr.Code, azureErr.Message, resp.Header.Get("x-ms-request-id"))
+}
+
+// signature returns the SharedKey signature of a request, see
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (b *azureBackend) signature(req *http.Request) string {
+	mac := hmac.New(sha256.New, b.accountKey)
+	mac.Write([]byte(b.stringToSign(req)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (b *azureBackend) stringToSign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	return strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		// The date is sent as x-ms-date instead
+		"",
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		azureCanonicalizedHeaders(req.Header) + b.canonicalizedResource(req.URL),
+	}, "\n")
+}
+
+func azureCanonicalizedHeaders(header http.Header) string {
+	var names []string
+	for name := range header {
+		if name := strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var canonicalized strings.Builder
+	for _, name := range names {
+		canonicalized.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	return canonicalized.String()
+}
+
+func (b *azureBackend) canonicalizedResource(u *url.URL) string {
+	canonicalized := "/" + b.accountName + u.EscapedPath()
+	query := u.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		canonicalized += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+	return canonicalized
+}
+
+// azureBlockID returns the ID of a block - all IDs of a blob must have the same length
+func azureBlockID(part int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%010d", part)))
+}
+
+// Put uploads a block blob - as a block list if the transfer is a multipart one
+func (b *azureBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	header := http.Header{}
+	if options != nil && options.contentType != "" {
+		header.Set("x-ms-blob-content-type", options.contentType)
+	}
+	var err error
+	if transfer.Multipart {
+		err = b.putBlockList(ctx, bucket, objectName, content, size, transfer, header)
+	} else {
+		header.Set("x-ms-blob-type", "BlockBlob")
+		err = b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, nil), header, content, size)
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to upload object,")
+		return err
+	}
+	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
+	return nil
+}
+
+func (b *azureBackend) putBlockList(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, header http.Header) error {
+	data, err := readerAt(content)
+	if err != nil {
+		return err
+	}
+	partSize := int64(transfer.PartSize)
+	blockList := azureBlockList{Latest: make([]string, partCount(size, partSize))}
+	err = forEachPart(ctx, size, partSize, transfer.Concurrency, func(ctx context.Context, part int, offset int64, length int64) error {
+		blockList.Latest[part] = azureBlockID(part)
+		query := url.Values{"comp": {"block"}, "blockid": {blockList.Latest[part]}}
+		return b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, query), nil, io.NewSectionReader(data, offset, length), length)
+	})
+	if err != nil {
+		return err
+	}
+	body, err := xml.Marshal(blockList)
+	if err != nil {
+		return err
+	}
+	header.Set("Content-Type", "application/xml")
+	return b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, url.Values{"comp": {"blocklist"}}), header, bytes.NewReader(body), int64(len(body)))
+}
+
+// Get downloads a blob - with ranged requests of the part size if the transfer is a multipart one
+func (b *azureBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	if !transfer.Multipart {
+		return b.doAndDiscard(ctx, http.MethodGet, b.url(bucket, objectName, nil), nil, nil, 0)
+	}
+	info, err := b.Head(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	partSize := int64(transfer.PartSize)
+	return forEachPart(ctx, info.Size, partSize, transfer.Concurrency, func(ctx context.Context, part int, offset int64, length int64) error {
+		if length == 0 {
+			return nil
+		}
+		header := http.Header{}
+		header.Set("x-ms-range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		return b.doAndDiscard(ctx, http.MethodGet, b.url(bucket, objectName, nil), header, nil, 0)
+	})
+}
+
+// List returns the blobs of a container with the given prefix
+func (b *azureBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := b.do(ctx, http.MethodGet, b.url(bucket, "", query), nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result azureBlobList
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range result.Blobs {
+			objects = append(objects, ObjectInfo{Key: blob.Name, Size: blob.Properties.ContentLength})
+		}
+		if result.NextMarker == "" {
+			return objects, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// Delete removes a blob
+func (b *azureBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	err := b.doAndDiscard(ctx, http.MethodDelete, b.url(bucket, objectName, nil), nil, nil, 0)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Head returns the size of a blob
+func (b *azureBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.url(bucket, objectName, nil), nil, nil, 0)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return ObjectInfo{Key: objectName, Size: resp.ContentLength}, nil
+}
+
+// CreateBucket creates a container
+func (b *azureBackend) CreateBucket(ctx context.Context, bucket string) error {
+	err := b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, "", url.Values{"restype": {"container"}}), nil, nil, 0)
+	if isStatus(err, http.StatusConflict) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithField("bucket", bucket).Info("Issues when creating container")
+	}
+	return err
+}
+
+// DeleteBucket removes a container together with all its blobs
+func (b *azureBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	return b.doAndDiscard(ctx, http.MethodDelete, b.url(bucket, "", url.Values{"restype": {"container"}}), nil, nil, 0)
+}
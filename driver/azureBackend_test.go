@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// fakeAzure is a minimal Blob service that checks the SharedKey signature of every request
+type fakeAzure struct {
+	t       *testing.T
+	backend *azureBackend
+
+	mutex      sync.Mutex
+	containers map[string]map[string][]byte
+	blocks     map[string][]byte
+	requests   []string
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if want := fmt.Sprintf("SharedKey %s:%s", f.backend.accountName, f.backend.signature(r)); r.Header.Get("Authorization") != want {
+		w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/"), "/", 2)
+	container, blob := path[0], ""
+	if len(path) == 2 {
+		blob = path[1]
+	}
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+query.Get("comp")))
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPut && query.Get("restype") == "container":
+		if _, ok := f.containers[container]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.containers[container] = map[string][]byte{}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && query.Get("restype") == "container":
+		delete(f.containers, container)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		var names []string
+		for name := range f.containers[container] {
+			if strings.HasPrefix(name, query.Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		fmt.Fprint(w, "<EnumerationResults><Blobs>")
+		for _, name := range names {
+			fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Content-Length>%d</Content-Length></Properties></Blob>", name, len(f.containers[container][name]))
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker /></EnumerationResults>")
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		f.blocks[blob+query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var blockList azureBlockList
+		if err := xml.Unmarshal(body, &blockList); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, id := range blockList.Latest {
+			data = append(data, f.blocks[blob+id]...)
+		}
+		f.containers[container][blob] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.containers[container][blob] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.containers[container][blob]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("x-ms-range"), "bytes=%d-%d", &start, &end); err == nil {
+			data = data[start : end+1]
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.containers[container][blob]; !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.containers[container], blob)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestAzureBackend(t *testing.T) (*azureBackend, *fakeAzure) {
+	fake := &fakeAzure{t: t, containers: map[string]map[string][]byte{}, blocks: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	config := common.S3Configuration{Azure: common.AzureConfiguration{
+		AccountName: "devstoreaccount1",
+		AccountKey:  base64.StdEncoding.EncodeToString([]byte("secret")),
+		Endpoint:    server.URL + "/devstoreaccount1",
+	}}
+	b, err := newAzureBackend(config, server.Client())
+	if err != nil {
+		t.Fatalf("newAzureBackend() error = %v", err)
+	}
+	fake.backend = b
+	return b, fake
+}
+
+func Test_azureBackend_stringToSign(t *testing.T) {
+	b := &azureBackend{accountName: "devstoreaccount1"}
+	req, _ := http.NewRequest(http.MethodPut, "http://127.0.0.1:10000/devstoreaccount1/bucket/object?comp=block&blockid=MDA%3D", nil)
+	req.ContentLength = 5
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	req.Header.Set("Content-Type", "application/xml")
+	want := "PUT\n\n\n5\n\napplication/xml\n\n\n\n\n\n\n" +
+		"x-ms-date:Mon, 02 Jan 2006 15:04:05 GMT\nx-ms-version:" + azureAPIVersion + "\n" +
+		"/devstoreaccount1/devstoreaccount1/bucket/object\nblockid:MDA=\ncomp:block"
+	if got := b.stringToSign(req); got != want {
+		t.Errorf("azureBackend.stringToSign() = %q, want %q", got, want)
+	}
+}
+
+func Test_azureBackend(t *testing.T) {
+	content := []byte(strings.Repeat("gosbench", 1000))
+	tests := []struct {
+		name         string
+		transfer     TransferOptions
+		wantRequests []string
+	}{
+		{"Single request", TransferOptions{}, []string{"PUT", "GET"}},
+		{"Block list", TransferOptions{Multipart: true, PartSize: 3000, Concurrency: 2},
+			[]string{"PUT block", "PUT block", "PUT block", "PUT blocklist", "HEAD", "GET", "GET", "GET"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, fake := newTestAzureBackend(t)
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			fake.requests = nil
+			if err := b.Put(ctx, "bucket", "dir/object", bytes.NewReader(content), int64(len(content)), tt.transfer, nil); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if err := b.Get(ctx, "bucket", "dir/object", tt.transfer, nil); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			sort.Strings(fake.requests)
+			sort.Strings(tt.wantRequests)
+			if !reflect.DeepEqual(fake.requests, tt.wantRequests) {
+				t.Errorf("Put() and Get() sent %v, want %v", fake.requests, tt.wantRequests)
+			}
+
+			b, fake = newTestAzureBackend(t)
+			testBackendContract(t, b, content, tt.transfer, func(bucket string, key string) []byte {
+				return fake.containers[bucket][key]
+			}, "BlobNotFound")
+		})
+	}
+}
+
+func Test_azureBackend_wrongKey(t *testing.T) {
+	b, _ := newTestAzureBackend(t)
+	wrong := *b
+	wrong.accountKey = []byte("wrong")
+	if errorClass, status := classifyError(wrong.CreateBucket(context.Background(), "bucket")); errorClass != "AuthenticationFailed" || status != http.StatusForbidden {
+		t.Errorf("classifyError() with a wrong key = %s, %d", errorClass, status)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// ObjectInfo describes a single object of a Backend
+type ObjectInfo struct {
+	Key  string
+	Size int64
+}
+
+// TransferOptions configures whether an object is transferred in a single
+// request or in several parts at once
+type TransferOptions struct {
+	Multipart   bool
+	PartSize    uint64
+	Concurrency int
+	// Explicit uploads send every step of a multipart upload on their own
+	// instead of leaving it to the SDK. Backends without such steps ignore
+	// it together with the other options of explicit uploads.
+	Explicit bool
+	// PartOrder is the order in which the parts of an explicit upload are sent
+	PartOrder string
+	// Abort abandons an explicit upload after its parts were sent
+	Abort bool
+	// CopySource is an object in the same bucket that the parts of an explicit upload are copied from
+	CopySource string
+}
+
+// Backend is the storage system that the work items run against.
+// S3 is the default, other object stores or test doubles can be plugged in
+// by implementing this interface.
+// Just like in S3, creating an existing bucket and deleting a missing object
+// are no error in any backend.
+type Backend interface {
+	Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error
+	Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error
+	List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error)
+	Delete(ctx context.Context, bucket string, objectName string) error
+	Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error)
+	CreateBucket(ctx context.Context, bucket string) error
+	DeleteBucket(ctx context.Context, bucket string) error
+}
+
+// ObjectVersion describes a single version of an object - or a delete marker
+type ObjectVersion struct {
+	Key          string
+	VersionID    string
+	Size         int64
+	DeleteMarker bool
+	IsLatest     bool
+}
+
+// VersionedBackend is a Backend with versioned buckets. Only S3 supports
+// them, which the configuration check ensures before a test uses them.
+type VersionedBackend interface {
+	Backend
+	EnableVersioning(ctx context.Context, bucket string) error
+	GetVersion(ctx context.Context, bucket string, objectName string, versionID string, transfer TransferOptions, options *objectOptions) error
+	DeleteVersion(ctx context.Context, bucket string, objectName string, versionID string) error
+	// ListVersions returns the versions and delete markers of the objects with
+	// the given prefix. The versions of a key are ordered from the latest to the oldest one.
+	ListVersions(ctx context.Context, bucket string, prefix string) ([]ObjectVersion, error)
+	// ListVersionsOf returns the versions and delete markers of a single object,
+	// ordered like ListVersions - but not those of other keys that start with its name
+	ListVersionsOf(ctx context.Context, bucket string, objectName string) ([]ObjectVersion, error)
+}
+
+// ObjectLockBackend is a VersionedBackend with Object Lock. Only S3 supports it.
+type ObjectLockBackend interface {
+	VersionedBackend
+	// CreateLockedBucket creates a bucket with Object Lock - and thereby versioning - enabled
+	CreateLockedBucket(ctx context.Context, bucket string) error
+	// DeleteLockedBucket deletes a bucket like DeleteBucket, but bypasses the
+	// governance retention and removes the legal holds of its objects
+	DeleteLockedBucket(ctx context.Context, bucket string) error
+}
+
+// backend runs the measured operations of the work items
+var backend Backend
+
+// housekeepingBackend runs everything that is hidden from the performance monitoring
+var housekeepingBackend Backend
+
+// initBackend sets up the backend of the given configuration. The seed
+// drives the random decisions of the backend, e.g. the endpoint balancing.
+func initBackend(config common.S3Configuration, seed int64) {
+	switch config.Backend {
+	case common.BackendFilesystem:
+		filesystem, err := newFilesystemBackend(config.Filesystem)
+		if err != nil {
+			log.WithError(err).Fatalf("Unable to set up the filesystem backend:")
+		}
+		// The root directory is the only endpoint in the metrics
+		initLocalBackend(filesystem, "Filesystem", "file://"+config.Filesystem.Root, seed)
+	case common.BackendAzure:
+		initHTTPBackend(config, seed, "Azure", config.Azure.Endpoint, func(client *http.Client) (Backend, error) {
+			return newAzureBackend(config, client)
+		})
+	case common.BackendGCS:
+		// Tokens are fetched with the housekeeping client, so that they do not show up in the measurements
+		tr, err := newHTTPTransport(config)
+		if err != nil {
+			log.WithError(err).Fatalf("Unable to configure the HTTP transport:")
+		}
+		auth, err := newGCSAuthenticator(config.GCS, &http.Client{Transport: tr})
+		if err != nil {
+			log.WithError(err).Fatalf("Unable to set up the gcs auth:")
+		}
+		initHTTPBackend(config, seed, "GCS", config.GCS.Endpoint, func(client *http.Client) (Backend, error) {
+			return newGCSBackend(config, client, auth), nil
+		})
+	case common.BackendSwift:
+		tr, err := newHTTPTransport(config)
+		if err != nil {
+			log.WithError(err).Fatalf("Unable to configure the HTTP transport:")
+		}
+		auth, err := newSwiftAuth(config.Swift, &http.Client{Transport: tr})
+		if err != nil {
+			log.WithError(err).Fatalf("Unable to authenticate with swift:")
+		}
+		initHTTPBackend(config, seed, "Swift", auth.getStorageURL(), func(client *http.Client) (Backend, error) {
+			return newSwiftBackend(config, client, auth), nil
+		})
+	case common.BackendNull:
+		initLocalBackend(newNullBackend(config.Null, seed), "Null", "null://", seed)
+	default:
+		InitS3(config, seed)
+	}
+}
+
+// forEachPart calls transferPart for every part of an object of the given
+// size, with up to concurrency parts at once. It stops at the first error.
+func forEachPart(ctx context.Context, size int64, partSize int64, concurrency int, transferPart func(ctx context.Context, part int, offset int64, length int64) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	parts := partCount(size, partSize)
+	errs := make(chan error, parts)
+	semaphore := make(chan struct{}, concurrency)
+	for part := 0; part < parts; part++ {
+		semaphore <- struct{}{}
+		offset := int64(part) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		go func(part int, offset int64, length int64) {
+			defer func() { <-semaphore }()
+			err := transferPart(ctx, part, offset, length)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}(part, offset, length)
+	}
+	var firstErr error
+	for part := 0; part < parts; part++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// partCount returns the number of parts of an object - empty objects have one empty part
+func partCount(size int64, partSize int64) int {
+	if size == 0 || partSize <= 0 {
+		return 1
+	}
+	return int((size + partSize - 1) / partSize)
+}
+
+// readerAt returns the content as io.ReaderAt, so that parts of it can be read at once
+func readerAt(content io.ReadSeeker) (io.ReaderAt, error) {
+	if r, ok := content.(io.ReaderAt); ok {
+		return r, nil
+	}
+	data, err := ioutil.ReadAll(content)
+	return bytes.NewReader(data), err
+}
+
+// initLocalBackend sets up a backend without HTTP requests. It is used for
+// the measured operations and the housekeeping alike.
+func initLocalBackend(local Backend, name string, endpoint string, seed int64) {
+	backend, housekeepingBackend = local, local
+	var err error
+	if balancer, err = newEndpointBalancer(common.S3Configuration{Endpoint: endpoint}, seed); err != nil {
+		log.WithError(err).Fatalf("Unable to parse the %s endpoint:", name)
+	}
+	ctx = context.Background()
+	log.Debugf("%s Init done", name)
+}
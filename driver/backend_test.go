@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testBackendContract checks the behaviour that every Backend shares with S3:
+// creating an existing bucket succeeds, Put stores the content, Get and List
+// find it, deleting a missing object succeeds, reading a missing object fails
+// with status 404 and DeleteBucket removes the bucket with all its objects.
+// stored returns the content of an object on the fake server of the backend.
+func testBackendContract(t *testing.T, b Backend, content []byte, transfer TransferOptions, stored func(bucket string, key string) []byte, wantMissingClass string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := b.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	if err := b.CreateBucket(ctx, "bucket"); err != nil {
+		t.Errorf("CreateBucket() of an existing bucket error = %v", err)
+	}
+	if err := b.Put(ctx, "bucket", "dir/object", bytes.NewReader(content), int64(len(content)), transfer, nil); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got := stored("bucket", "dir/object"); !bytes.Equal(got, content) {
+		t.Errorf("Put() stored %d bytes, want %d", len(got), len(content))
+	}
+	if err := b.Get(ctx, "bucket", "dir/object", transfer, nil); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if err := b.Put(ctx, "bucket", "dir/other", bytes.NewReader(content[:10]), 10, TransferOptions{}, nil); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	objects, err := b.List(ctx, "bucket", "dir/")
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	if want := []ObjectInfo{{Key: "dir/object", Size: int64(len(content))}, {Key: "dir/other", Size: 10}}; err != nil || !reflect.DeepEqual(objects, want) {
+		t.Errorf("List() = %+v, %v, want %+v", objects, err, want)
+	}
+
+	if err := b.Delete(ctx, "bucket", "dir/other"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := b.Delete(ctx, "bucket", "dir/other"); err != nil {
+		t.Errorf("Delete() of a missing object error = %v", err)
+	}
+	if _, err := b.Head(ctx, "bucket", "dir/other"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Head() of a deleted object error = %v, want 404", err)
+	}
+	if errorClass, status := classifyError(b.Get(ctx, "bucket", "dir/other", TransferOptions{}, nil)); errorClass != wantMissingClass || status != http.StatusNotFound {
+		t.Errorf("classifyError() of a missing object = %s, %d, want %s, 404", errorClass, status, wantMissingClass)
+	}
+
+	if err := b.DeleteBucket(ctx, "bucket"); err != nil {
+		t.Errorf("DeleteBucket() error = %v", err)
+	}
+	if got := stored("bucket", "dir/object"); got != nil {
+		t.Errorf("DeleteBucket() left %d bytes of an object behind", len(got))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// leasedBytesBudget draws bytes in leases from the global byte budget of the
+// server. Operations are only counted once they finished, so the bytes of the
+// operations that are still running when a lease is used up overdraw it.
+// The next lease is requested when half of the current lease is used up.
+type leasedBytesBudget struct {
+	request func() error
+
+	mutex     sync.Mutex
+	remaining int64
+	lastLease uint64
+	requested bool
+	exhausted bool
+}
+
+// newLeasedBytesBudget returns a budget that asks for its leases with request
+// and already requests the first one
+func newLeasedBytesBudget(request func() error) *leasedBytesBudget {
+	b := &leasedBytesBudget{request: request}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requestLease()
+	return b
+}
+
+// use counts the bytes of a successful operation and returns false
+// once the budget is used up
+func (b *leasedBytesBudget) use(bytes uint64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remaining -= int64(bytes)
+	if !b.exhausted && !b.requested && b.remaining <= int64(b.lastLease/2) {
+		b.requestLease()
+	}
+	return !b.exhausted || b.remaining > 0
+}
+
+// requestLease asks the server for the next lease. A budget that cannot
+// reach the server does not get any more bytes.
+func (b *leasedBytesBudget) requestLease() {
+	log.Trace("Requesting bytes lease from server")
+	if err := b.request(); err != nil {
+		log.WithError(err).Error("Could not request bytes lease from server")
+		b.exhausted = true
+		return
+	}
+	b.requested = true
+}
+
+// receive adds a lease from the server to the budget
+func (b *leasedBytesBudget) receive(lease uint64) {
+	log.WithField("lease", lease).Trace("Got bytes lease from server")
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requested = false
+	b.remaining += int64(lease)
+	b.lastLease = lease
+	if lease == 0 {
+		b.exhausted = true
+	}
+}
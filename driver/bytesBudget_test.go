@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_leasedBytesBudget_use(t *testing.T) {
+	requests := 0
+	budget := newLeasedBytesBudget(func() error {
+		requests++
+		return nil
+	})
+	if requests != 1 {
+		t.Fatalf("newLeasedBytesBudget() sent %d requests, want %d", requests, 1)
+	}
+	budget.receive(1000)
+	for i := 0; i < 5; i++ {
+		if !budget.use(100) {
+			t.Fatalf("leasedBytesBudget.use() = false within the lease")
+		}
+	}
+	if requests != 2 {
+		t.Errorf("leasedBytesBudget.use() sent %d requests after half of the lease, want %d", requests, 2)
+	}
+	// The bytes of running operations may overdraw the lease until the next one arrives
+	for i := 0; i < 6; i++ {
+		if !budget.use(100) {
+			t.Fatalf("leasedBytesBudget.use() = false while waiting for the next lease")
+		}
+	}
+	budget.receive(0)
+	if budget.use(100) {
+		t.Errorf("leasedBytesBudget.use() = true after the budget was used up")
+	}
+	if requests != 2 {
+		t.Errorf("leasedBytesBudget.use() sent %d requests in total, want %d", requests, 2)
+	}
+}
+
+func Test_leasedBytesBudget_remainingLease(t *testing.T) {
+	budget := newLeasedBytesBudget(func() error { return nil })
+	budget.receive(1000)
+	budget.receive(0)
+	if !budget.use(900) {
+		t.Errorf("leasedBytesBudget.use() = false before the last lease was used up")
+	}
+	if budget.use(100) {
+		t.Errorf("leasedBytesBudget.use() = true after the last lease was used up")
+	}
+}
+
+func Test_leasedBytesBudget_requestFailed(t *testing.T) {
+	budget := newLeasedBytesBudget(func() error { return errors.New("connection lost") })
+	if budget.use(1) {
+		t.Errorf("leasedBytesBudget.use() = true without a connection to the server")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// newCredentials returns the credentials of the given S3 configuration. All
+// providers are wrapped into a timedProvider that reports the latency of
+// every credential refresh.
+func newCredentials(config common.S3Configuration, httpClient *http.Client) (*credentials.Credentials, error) {
+	var provider credentials.Provider
+	switch config.CredentialsSource {
+	case common.CredentialsSourceEnv:
+		provider = &credentials.EnvProvider{}
+	case common.CredentialsSourceShared:
+		provider = &credentials.SharedCredentialsProvider{Filename: config.SharedCredentialsFile, Profile: config.Profile}
+	case common.CredentialsSourceChain:
+		providers := []credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{Filename: config.SharedCredentialsFile, Profile: config.Profile},
+		}
+		if tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && roleARN != "" {
+			providers = append(providers, stscreds.NewWebIdentityRoleProvider(newSTSClient(config, httpClient, nil),
+				roleARN, os.Getenv("AWS_ROLE_SESSION_NAME"), tokenFile))
+		}
+		awsConfig := defaults.Config().WithRegion(config.Region).WithHTTPClient(httpClient)
+		providers = append(providers, defaults.RemoteCredProvider(*awsConfig, defaults.Handlers()))
+		provider = &credentials.ChainProvider{Providers: providers, VerboseErrors: true}
+	case common.CredentialsSourceWebIdentity:
+		// Web identities are always exchanged for the role directly
+		return credentials.NewCredentials(newTimedProvider(config.CredentialsSource,
+			stscreds.NewWebIdentityRoleProvider(newSTSClient(config, httpClient, nil), config.RoleARN, config.RoleSessionName, config.WebIdentityTokenFile),
+			time.Duration(config.CredentialsRefreshInterval))), nil
+	case common.CredentialsSourceStatic:
+		provider = &credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     config.AccessKey,
+			SecretAccessKey: config.SecretKey,
+			SessionToken:    config.SessionToken,
+		}}
+	default:
+		return nil, fmt.Errorf("Unknown credentials_source %s", config.CredentialsSource)
+	}
+
+	name := config.CredentialsSource
+	if config.RoleARN != "" {
+		name = "assume_role"
+		provider = &stscreds.AssumeRoleProvider{
+			Client:          newSTSClient(config, httpClient, credentials.NewCredentials(provider)),
+			RoleARN:         config.RoleARN,
+			RoleSessionName: config.RoleSessionName,
+			ExternalID:      optionalString(config.ExternalID),
+			Duration:        time.Duration(config.RoleDuration),
+		}
+	}
+	return credentials.NewCredentials(newTimedProvider(name, provider, time.Duration(config.CredentialsRefreshInterval))), nil
+}
+
+// newSTSClient returns the STS client that is used to assume roles. Requests
+// to the STS endpoint use the same HTTP client as the S3 requests.
+func newSTSClient(config common.S3Configuration, httpClient *http.Client, creds *credentials.Credentials) *sts.STS {
+	awsConfig := &aws.Config{
+		HTTPClient:  httpClient,
+		Region:      aws.String(config.Region),
+		Credentials: creds,
+	}
+	if creds == nil {
+		// AssumeRoleWithWebIdentity is not signed
+		awsConfig.Credentials = credentials.AnonymousCredentials
+	}
+	if config.STSEndpoint != "" {
+		awsConfig.Endpoint = aws.String(config.STSEndpoint)
+	}
+	return sts.New(session.Must(session.NewSession(awsConfig)))
+}
+
+// timedProvider reports the latency of every credential refresh of the
+// wrapped provider. Optionally it forces a refresh after a fixed interval,
+// to measure the cost of refreshes during a test.
+type timedProvider struct {
+	name            string
+	provider        credentials.Provider
+	refreshInterval time.Duration
+
+	mutex       sync.Mutex
+	retrievedAt time.Time
+}
+
+func newTimedProvider(name string, provider credentials.Provider, refreshInterval time.Duration) *timedProvider {
+	return &timedProvider{
+		name:            name,
+		provider:        provider,
+		refreshInterval: refreshInterval,
+	}
+}
+
+// Retrieve retrieves the credentials of the wrapped provider and records how long this took
+func (p *timedProvider) Retrieve() (credentials.Value, error) {
+	start := time.Now()
+	value, err := p.provider.Retrieve()
+	duration := time.Since(start)
+	if err != nil {
+		log.WithError(err).WithField("provider", p.name).Error("Could not refresh the credentials")
+		promFailedCredentialRefreshes.WithLabelValues(p.name).Inc()
+		return value, err
+	}
+	promCredentialRefreshLatency.WithLabelValues(p.name).Observe(float64(duration.Milliseconds()))
+	log.WithField("provider", p.name).Debugf("Refreshed credentials in %v", duration)
+	p.mutex.Lock()
+	p.retrievedAt = start
+	p.mutex.Unlock()
+	return value, nil
+}
+
+// IsExpired returns if the credentials of the wrapped provider are expired
+// or if the refresh interval has passed
+func (p *timedProvider) IsExpired() bool {
+	if p.refreshInterval != 0 {
+		p.mutex.Lock()
+		retrievedAt := p.retrievedAt
+		p.mutex.Unlock()
+		if time.Since(retrievedAt) >= p.refreshInterval {
+			return true
+		}
+	}
+	return p.provider.IsExpired()
+}
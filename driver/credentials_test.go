@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mulbc/gosbench/common"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASSUMEDKEY</AccessKeyId>
+      <SecretAccessKey>assumedsecret</SecretAccessKey>
+      <SessionToken>assumedtoken</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+
+func Test_newCredentials(t *testing.T) {
+	var stsCalls int32
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&stsCalls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), "Action=AssumeRole") || !strings.Contains(r.Header.Get("Authorization"), "Credential=BASEKEY/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer sts.Close()
+
+	tests := []struct {
+		name      string
+		config    common.S3Configuration
+		want      credentials.Value
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"Static with session token", common.S3Configuration{CredentialsSource: common.CredentialsSourceStatic, AccessKey: "KEY", SecretKey: "secret", SessionToken: "token"},
+			credentials.Value{AccessKeyID: "KEY", SecretAccessKey: "secret", SessionToken: "token"}, 0, false},
+		{"Assume role", common.S3Configuration{CredentialsSource: common.CredentialsSourceStatic, AccessKey: "BASEKEY", SecretKey: "basesecret",
+			Region: "us-east-1", RoleARN: "arn:aws:iam::123456789012:role/bench", STSEndpoint: sts.URL},
+			credentials.Value{AccessKeyID: "ASSUMEDKEY", SecretAccessKey: "assumedsecret", SessionToken: "assumedtoken"}, 1, false},
+		{"Assume role rejected", common.S3Configuration{CredentialsSource: common.CredentialsSourceStatic, AccessKey: "OTHERKEY", SecretKey: "othersecret",
+			Region: "us-east-1", RoleARN: "arn:aws:iam::123456789012:role/bench", STSEndpoint: sts.URL},
+			credentials.Value{}, 1, true},
+		{"Unknown source", common.S3Configuration{CredentialsSource: "vault"}, credentials.Value{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&stsCalls, 0)
+			creds, err := newCredentials(tt.config, sts.Client())
+			if err == nil {
+				var value credentials.Value
+				value, err = creds.Get()
+				value.ProviderName = ""
+				if err == nil && value != tt.want {
+					t.Errorf("newCredentials() = %+v, want %+v", value, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls := atomic.LoadInt32(&stsCalls); calls != tt.wantCalls {
+				t.Errorf("newCredentials() called STS %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_timedProvider_IsExpired(t *testing.T) {
+	tests := []struct {
+		name            string
+		refreshInterval time.Duration
+		wait            time.Duration
+		want            bool
+	}{
+		{"No refresh interval", 0, 0, false},
+		{"Within refresh interval", time.Hour, 0, false},
+		{"Refresh interval passed", time.Millisecond, 5 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTimedProvider("static", &credentials.StaticProvider{Value: credentials.Value{AccessKeyID: "KEY", SecretAccessKey: "secret"}}, tt.refreshInterval)
+			if _, err := p.Retrieve(); err != nil {
+				t.Fatalf("timedProvider.Retrieve() error = %v", err)
+			}
+			time.Sleep(tt.wait)
+			if got := p.IsExpired(); got != tt.want {
+				t.Errorf("timedProvider.IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
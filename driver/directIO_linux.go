@@ -0,0 +1,11 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+// directIOFlag opens files with O_DIRECT to bypass the page cache
+const directIOFlag = syscall.O_DIRECT
+
+const directIOSupported = true
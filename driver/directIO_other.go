@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// directIOFlag is not available on this platform
+const directIOFlag = 0
+
+const directIOSupported = false
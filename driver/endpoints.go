@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/mulbc/gosbench/common"
+)
+
+// balancer spreads the operations of the running test over the S3 endpoints
+var balancer *endpointBalancer
+
+// endpointKey is the context key of the endpoint of an operation
+type endpointKey struct{}
+
+// endpointBalancer picks the endpoint of every operation according to the
+// configured balancing strategy
+type endpointBalancer struct {
+	endpoints   []string
+	urls        []*url.URL
+	strategy    string
+	next        uint64
+	outstanding []int64
+
+	randomMutex sync.Mutex
+	random      *rand.Rand
+}
+
+// s3Endpoints returns the endpoints of an S3 configuration - either the
+// endpoints list or the single endpoint
+func s3Endpoints(config common.S3Configuration) []string {
+	if len(config.Endpoints) != 0 {
+		return config.Endpoints
+	}
+	return []string{config.Endpoint}
+}
+
+// newEndpointBalancer returns the balancer of the endpoints of the configuration.
+// The random strategy picks the endpoints in the order that the seed decides.
+func newEndpointBalancer(config common.S3Configuration, seed int64) (*endpointBalancer, error) {
+	endpoints := s3Endpoints(config)
+	b := &endpointBalancer{
+		endpoints:   endpoints,
+		urls:        make([]*url.URL, len(endpoints)),
+		strategy:    config.EndpointBalancing,
+		outstanding: make([]int64, len(endpoints)),
+		random:      rand.New(rand.NewSource(seed)),
+	}
+	for i, endpoint := range endpoints {
+		var err error
+		if b.urls[i], err = url.Parse(endpoint); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// acquire picks the endpoint of an operation and returns a context that sends
+// all requests of the operation to it. release must be called when the
+// operation is done.
+func (b *endpointBalancer) acquire(parent context.Context) (opCtx context.Context, endpoint string, release func()) {
+	index := b.pick()
+	atomic.AddInt64(&b.outstanding[index], 1)
+	return context.WithValue(parent, endpointKey{}, b.urls[index]), b.endpoints[index], func() {
+		atomic.AddInt64(&b.outstanding[index], -1)
+	}
+}
+
+func (b *endpointBalancer) pick() int {
+	if len(b.endpoints) == 1 {
+		return 0
+	}
+	switch b.strategy {
+	case common.EndpointBalancingRandom:
+		b.randomMutex.Lock()
+		defer b.randomMutex.Unlock()
+		return b.random.Intn(len(b.endpoints))
+	case common.EndpointBalancingLeastOutstanding:
+		// Start at a rotating offset so that ties do not always favour the first endpoint
+		offset := int(atomic.AddUint64(&b.next, 1) % uint64(len(b.endpoints)))
+		best := offset
+		for i := range b.endpoints {
+			index := (offset + i) % len(b.endpoints)
+			if atomic.LoadInt64(&b.outstanding[index]) < atomic.LoadInt64(&b.outstanding[best]) {
+				best = index
+			}
+		}
+		return best
+	default:
+		return int((atomic.AddUint64(&b.next, 1) - 1) % uint64(len(b.endpoints)))
+	}
+}
+
+// endpointHandler sends a request to the endpoint of its operation. It has to run
+// before the S3 client's build handlers, which add the bucket to the host for
+// virtual-hosted-style requests. The path of the client's endpoint - which the
+// request starts with - is replaced by the path of the operation's endpoint.
+var endpointHandler = request.NamedHandler{
+	Name: "gosbench.EndpointHandler",
+	Fn: func(r *request.Request) {
+		endpoint, ok := r.Context().Value(endpointKey{}).(*url.URL)
+		if !ok || endpoint.Host == "" {
+			return
+		}
+		r.HTTPRequest.URL.Scheme = endpoint.Scheme
+		r.HTTPRequest.URL.Host = endpoint.Host
+		if primary, err := url.Parse(r.ClientInfo.Endpoint); err == nil {
+			operationPath := strings.TrimPrefix(r.HTTPRequest.URL.Path, strings.TrimSuffix(primary.Path, "/"))
+			r.HTTPRequest.URL.Path = strings.TrimSuffix(endpoint.Path, "/") + operationPath
+		}
+	},
+}
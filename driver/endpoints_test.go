@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulbc/gosbench/common"
+)
+
+var testEndpoints = []string{"http://node1:8080", "http://node2:8080", "https://node3"}
+
+func Test_endpointBalancer_roundRobin(t *testing.T) {
+	b, err := newEndpointBalancer(common.S3Configuration{Endpoints: testEndpoints, EndpointBalancing: common.EndpointBalancingRoundRobin}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 4; i++ {
+		_, endpoint, release := b.acquire(context.Background())
+		release()
+		got = append(got, endpoint)
+	}
+	want := append(append([]string{}, testEndpoints...), testEndpoints[0])
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("acquire() = %v, want %v", got, want)
+	}
+}
+
+func Test_endpointBalancer_random(t *testing.T) {
+	var picked [2][]string
+	for run := range picked {
+		b, err := newEndpointBalancer(common.S3Configuration{Endpoints: testEndpoints, EndpointBalancing: common.EndpointBalancingRandom}, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 300; i++ {
+			_, endpoint, release := b.acquire(context.Background())
+			release()
+			picked[run] = append(picked[run], endpoint)
+		}
+	}
+	seen := map[string]bool{}
+	for _, endpoint := range picked[0] {
+		seen[endpoint] = true
+	}
+	if len(seen) != len(testEndpoints) {
+		t.Errorf("acquire() only picked %v", seen)
+	}
+	if !reflect.DeepEqual(picked[0], picked[1]) {
+		t.Errorf("acquire() picked other endpoints with the same seed")
+	}
+}
+
+func Test_endpointBalancer_leastOutstanding(t *testing.T) {
+	b, err := newEndpointBalancer(common.S3Configuration{Endpoints: testEndpoints, EndpointBalancing: common.EndpointBalancingLeastOutstanding}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the first two operations running - the next ones have to go elsewhere
+	busy := map[string]func(){}
+	for i := 0; i < 2; i++ {
+		_, endpoint, release := b.acquire(context.Background())
+		if _, ok := busy[endpoint]; ok {
+			t.Fatalf("acquire() picked the busy endpoint %s", endpoint)
+		}
+		busy[endpoint] = release
+	}
+	for i := 0; i < 3; i++ {
+		_, endpoint, release := b.acquire(context.Background())
+		if _, ok := busy[endpoint]; ok {
+			t.Errorf("acquire() picked the busy endpoint %s", endpoint)
+		}
+		release()
+	}
+}
+
+func Test_endpointHandler(t *testing.T) {
+	prefixedEndpoints := []string{"http://node1:8080/s3", "http://node2:8080", "https://node3/gateway/s3/"}
+	tests := []struct {
+		name            string
+		endpoints       []string
+		addressingStyle string
+		want            string
+	}{
+		{"Path style", testEndpoints, common.AddressingStylePath, "https://node3/bucket/object"},
+		{"Virtual-hosted-style", testEndpoints, common.AddressingStyleVirtual, "https://bucket.node3/object"},
+		{"Path style with path prefixes", prefixedEndpoints, common.AddressingStylePath, "https://node3/gateway/s3/bucket/object"},
+		{"Virtual-hosted-style with path prefixes", prefixedEndpoints, common.AddressingStyleVirtual, "https://bucket.node3/gateway/s3/object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := common.S3Configuration{Region: "us-east-1", Endpoints: tt.endpoints, AddressingStyle: tt.addressingStyle}
+			service := s3.New(session.Must(session.NewSession(newAWSConfig(config, http.DefaultClient, credentials.AnonymousCredentials))))
+			service.Handlers.Build.PushFrontNamed(endpointHandler)
+			b, err := newEndpointBalancer(config, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.next = 2
+			opCtx, _, release := b.acquire(context.Background())
+			defer release()
+			req, _ := service.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("object")})
+			req.SetContext(opCtx)
+			if err := req.Build(); err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if got := req.HTTPRequest.URL.String(); got != tt.want {
+				t.Errorf("request URL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// directIOAlignment is the alignment of the buffers, offsets and sizes of O_DIRECT transfers
+const directIOAlignment = 4096
+
+// filesystemBufferSize is the size of the chunks that are read and written at once
+const filesystemBufferSize = 1024 * 1024
+
+// filesystemBackend is the Backend of a local or mounted filesystem, e.g.
+// NFS or CephFS. Buckets are directories below the root directory and
+// objects are the files in them. The object options and multipart settings
+// of the work items do not apply to files.
+type filesystemBackend struct {
+	root     string
+	directIO bool
+	fsync    bool
+	buffers  sync.Pool
+}
+
+func newFilesystemBackend(config common.FilesystemConfiguration) (*filesystemBackend, error) {
+	if config.DirectIO && !directIOSupported {
+		return nil, fmt.Errorf("direct_io is not supported on %s", runtime.GOOS)
+	}
+	if err := os.MkdirAll(config.Root, 0755); err != nil {
+		return nil, err
+	}
+	return &filesystemBackend{
+		root:     config.Root,
+		directIO: config.DirectIO,
+		fsync:    config.Fsync,
+		buffers: sync.Pool{New: func() interface{} {
+			buffer := alignedBuffer(filesystemBufferSize)
+			return &buffer
+		}},
+	}, nil
+}
+
+// alignedBuffer returns a buffer whose start is aligned for O_DIRECT transfers
+func alignedBuffer(size int) []byte {
+	buffer := make([]byte, size+directIOAlignment)
+	offset := int(uintptr(unsafe.Pointer(&buffer[0])) & (directIOAlignment - 1))
+	if offset != 0 {
+		offset = directIOAlignment - offset
+	}
+	return buffer[offset : offset+size : offset+size]
+}
+
+func (b *filesystemBackend) path(bucket string, objectName string) string {
+	return filepath.Join(b.root, bucket, filepath.FromSlash(objectName))
+}
+
+func (b *filesystemBackend) openFlags(flags int) int {
+	if b.directIO {
+		return flags | directIOFlag
+	}
+	return flags
+}
+
+// Put writes an object to its file and syncs it if fsync is enabled
+func (b *filesystemBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	path := b.path(bucket, objectName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, b.openFlags(os.O_WRONLY|os.O_CREATE|os.O_TRUNC), 0644)
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to create file,")
+		return err
+	}
+	err = b.write(ctx, file, path, content)
+	if err == nil && b.fsync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to write file,")
+		return err
+	}
+	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
+	return nil
+}
+
+func (b *filesystemBackend) write(ctx context.Context, file *os.File, path string, content io.Reader) error {
+	buffer := b.buffers.Get().(*[]byte)
+	defer b.buffers.Put(buffer)
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(content, *buffer)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if b.directIO && n%directIOAlignment != 0 {
+			// O_DIRECT only writes whole blocks, so the tail of
+			// the file is written through the page cache
+			return b.writeTail(file, path, (*buffer)[:n], written)
+		}
+		if _, err := file.Write((*buffer)[:n]); err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+}
+
+func (b *filesystemBackend) writeTail(file *os.File, path string, tail []byte, offset int64) error {
+	blocks := len(tail) / directIOAlignment * directIOAlignment
+	if _, err := file.Write(tail[:blocks]); err != nil {
+		return err
+	}
+	tailFile, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = tailFile.WriteAt(tail[blocks:], offset+int64(blocks))
+	if err == nil && b.fsync {
+		err = tailFile.Sync()
+	}
+	if closeErr := tailFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Get reads the whole file of an object
+func (b *filesystemBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	file, err := os.OpenFile(b.path(bucket, objectName), b.openFlags(os.O_RDONLY), 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffer := b.buffers.Get().(*[]byte)
+	defer b.buffers.Put(buffer)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := file.Read(*buffer); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// List walks the directory of a bucket and returns the files with the given prefix
+func (b *filesystemBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	dir := filepath.Join(b.root, bucket)
+	var objects []ObjectInfo
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if key = filepath.ToSlash(key); strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: info.Size()})
+		}
+		return ctx.Err()
+	})
+	return objects, err
+}
+
+// Delete removes the file of an object
+func (b *filesystemBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	if err := os.Remove(b.path(bucket, objectName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Head returns the size of the file of an object
+func (b *filesystemBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	info, err := os.Stat(b.path(bucket, objectName))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: objectName, Size: info.Size()}, nil
+}
+
+// CreateBucket creates the directory of a bucket
+func (b *filesystemBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return os.MkdirAll(filepath.Join(b.root, bucket), 0755)
+}
+
+// DeleteBucket removes the directory of a bucket together with all its files
+func (b *filesystemBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	return os.RemoveAll(filepath.Join(b.root, bucket))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_filesystemBackend(t *testing.T) {
+	content := make([]byte, 2*filesystemBufferSize+100)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	tests := []struct {
+		name   string
+		config common.FilesystemConfiguration
+		size   int
+	}{
+		{"Small file", common.FilesystemConfiguration{}, 100},
+		{"Several chunks", common.FilesystemConfiguration{}, len(content)},
+		{"Fsync", common.FilesystemConfiguration{Fsync: true}, filesystemBufferSize},
+		{"Direct IO with tail", common.FilesystemConfiguration{DirectIO: true, Fsync: true}, len(content)},
+		{"Direct IO without tail", common.FilesystemConfiguration{DirectIO: true}, 2 * directIOAlignment},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Root = t.TempDir()
+			if tt.config.DirectIO && !directIOSupported {
+				t.Skip("O_DIRECT is not supported on this platform")
+			}
+			b, err := newFilesystemBackend(tt.config)
+			if err != nil {
+				t.Fatalf("newFilesystemBackend() error = %v", err)
+			}
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			err = b.Put(ctx, "bucket", "dir/object", bytes.NewReader(content[:tt.size]), int64(tt.size), TransferOptions{}, nil)
+			if tt.config.DirectIO && errors.Is(err, syscall.EINVAL) {
+				t.Skip("O_DIRECT is not supported by the filesystem of the temporary directory")
+			}
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			written, err := ioutil.ReadFile(filepath.Join(tt.config.Root, "bucket", "dir", "object"))
+			if err != nil || !bytes.Equal(written, content[:tt.size]) {
+				t.Errorf("Put() wrote %d bytes, want %d - error = %v", len(written), tt.size, err)
+			}
+			if err := b.Get(ctx, "bucket", "dir/object", TransferOptions{}, nil); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			if info, err := b.Head(ctx, "bucket", "dir/object"); err != nil || info.Size != int64(tt.size) {
+				t.Errorf("Head() = %+v, %v, want size %d", info, err, tt.size)
+			}
+			objects, err := b.List(ctx, "bucket", "dir/")
+			if want := []ObjectInfo{{Key: "dir/object", Size: int64(tt.size)}}; err != nil || !reflect.DeepEqual(objects, want) {
+				t.Errorf("List() = %+v, %v, want %+v", objects, err, want)
+			}
+			if objects, err := b.List(ctx, "bucket", "other"); err != nil || len(objects) != 0 {
+				t.Errorf("List() with other prefix = %+v, %v, want nothing", objects, err)
+			}
+			if err := b.Delete(ctx, "bucket", "dir/object"); err != nil {
+				t.Errorf("Delete() error = %v", err)
+			}
+			if err := b.Delete(ctx, "bucket", "dir/object"); err != nil {
+				t.Errorf("Delete() of a missing object error = %v", err)
+			}
+			if err := b.DeleteBucket(ctx, "bucket"); err != nil {
+				t.Errorf("DeleteBucket() error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(tt.config.Root, "bucket")); !os.IsNotExist(err) {
+				t.Errorf("DeleteBucket() left the bucket directory behind - error = %v", err)
+			}
+		})
+	}
+}
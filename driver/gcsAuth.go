@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// gcsScope is the OAuth2 scope of the service account tokens
+const gcsScope = "https://www.googleapis.com/auth/devstorage.full_control"
+
+// gcsAuthenticator returns the access token of the gcs backend.
+// An empty token sends the requests without authorization, e.g. to emulators.
+type gcsAuthenticator interface {
+	token(ctx context.Context) (string, error)
+}
+
+func newGCSAuthenticator(config common.GCSConfiguration, client *http.Client) (gcsAuthenticator, error) {
+	switch config.Auth {
+	case common.GCSAuthToken:
+		return gcsStaticToken(config.Token), nil
+	case common.GCSAuthServiceAccount:
+		return newGCSServiceAccount(config.CredentialsFile, client)
+	case common.GCSAuthNone, "":
+		return gcsStaticToken(""), nil
+	}
+	return nil, fmt.Errorf("Unknown gcs auth %s", config.Auth)
+}
+
+// gcsStaticToken is a fixed access token, e.g. from `gcloud auth print-access-token`
+type gcsStaticToken string
+
+func (t gcsStaticToken) token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// gcsServiceAccount exchanges a JWT that is signed with the key of a
+// service account for an access token and caches it until it expires
+type gcsServiceAccount struct {
+	client       *http.Client
+	email        string
+	privateKeyID string
+	privateKey   *rsa.PrivateKey
+	tokenURI     string
+
+	mutex       sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+func newGCSServiceAccount(credentialsFile string, client *http.Client) (*gcsServiceAccount, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var key struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err = json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("The credentials_file contains no PEM private key")
+	}
+	privateKey, err := parseRSAPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &gcsServiceAccount{
+		client:       client,
+		email:        key.ClientEmail,
+		privateKeyID: key.PrivateKeyID,
+		privateKey:   privateKey,
+		tokenURI:     key.TokenURI,
+	}, nil
+}
+
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("The private key of the service account is no RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (s *gcsServiceAccount) token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Refresh a minute early, so that no request is sent with an expired token
+	if s.accessToken != "" && time.Until(s.expiry) > time.Minute {
+		return s.accessToken, nil
+	}
+	start := time.Now()
+	accessToken, expiresIn, err := s.fetchToken(ctx)
+	if err != nil {
+		log.WithError(err).WithField("provider", common.GCSAuthServiceAccount).Error("Could not refresh the credentials")
+		promFailedCredentialRefreshes.WithLabelValues(common.GCSAuthServiceAccount).Inc()
+		return "", err
+	}
+	promCredentialRefreshLatency.WithLabelValues(common.GCSAuthServiceAccount).Observe(float64(time.Since(start).Milliseconds()))
+	s.accessToken, s.expiry = accessToken, start.Add(expiresIn)
+	return s.accessToken, nil
+}
+
+// jwt returns the signed assertion of the service account
+func (s *gcsServiceAccount) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.privateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.email,
+		"scope": gcsScope,
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *gcsServiceAccount) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	assertion, err := s.jwt(time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", 0, fmt.Errorf("Token request failed with %s: %s", resp.Status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", 0, err
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// gcsChunkAlignment is the size that all but the last chunk of a resumable upload must be a multiple of
+const gcsChunkAlignment = 256 * 1024
+
+// gcsBackend is the Backend of the Google Cloud Storage JSON API.
+// Multipart uploads are resumable uploads with one chunk per part.
+type gcsBackend struct {
+	client   *http.Client
+	endpoint string
+	project  string
+	auth     gcsAuthenticator
+	timeout  time.Duration
+}
+
+func newGCSBackend(config common.S3Configuration, client *http.Client, auth gcsAuthenticator) *gcsBackend {
+	return &gcsBackend{
+		client:   client,
+		endpoint: strings.TrimSuffix(config.GCS.Endpoint, "/"),
+		project:  config.GCS.Project,
+		auth:     auth,
+		timeout:  time.Duration(config.Timeout),
+	}
+}
+
+// gcsErrorResponse is the body of failed requests
+type gcsErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// gcsObject is the metadata of an object - sizes are strings in the JSON API
+type gcsObject struct {
+	Name string `json:"name"`
+	Size string `json:"size"`
+}
+
+func (o gcsObject) info() ObjectInfo {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	return ObjectInfo{Key: o.Name, Size: size}
+}
+
+func (b *gcsBackend) bucketURL(bucket string) string {
+	return b.endpoint + "/storage/v1/b/" + url.PathEscape(bucket)
+}
+
+func (b *gcsBackend) objectURL(bucket string, objectName string) string {
+	return b.bucketURL(bucket) + "/o/" + url.PathEscape(objectName)
+}
+
+func (b *gcsBackend) uploadURL(bucket string, objectName string, uploadType string) string {
+	return b.endpoint + "/upload/storage/v1/b/" + url.PathEscape(bucket) + "/o?" + url.Values{"uploadType": {uploadType}, "name": {objectName}}.Encode()
+}
+
+func (b *gcsBackend) do(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	return doREST(ctx, b, b.client, b.timeout, method, url, header, body, length)
+}
+
+func (b *gcsBackend) doAndDiscard(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) error {
+	return discardResponse(b.do(ctx, method, url, header, body, length))
+}
+
+// doJSON sends a request and decodes its JSON response into result
+func (b *gcsBackend) doJSON(ctx context.Context, method string, url string, body string, result interface{}) error {
+	header := http.Header{}
+	if body != "" {
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.do(ctx, method, url, header, strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// authorize adds the access token of the configured auth
+func (b *gcsBackend) authorize(req *http.Request) error {
+	token, err := b.auth.token(req.Context())
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// failed accepts redirects, as the chunks of resumable uploads are
+// acknowledged with 308 Resume Incomplete
+func (b *gcsBackend) failed(status int) bool {
+	return status >= 400
+}
+
+func (b *gcsBackend) requestError(resp *http.Response, body []byte) error {
+	var gcsErr gcsErrorResponse
+	_ = json.Unmarshal(body, &gcsErr)
+	code := http.StatusText(resp.StatusCode)
+	if len(gcsErr.Error.Errors) != 0 && gcsErr.Error.Errors[0].Reason != "" {
+		code = gcsErr.Error.Errors[0].Reason
+	}
+	return newRequestFailure(resp, code, gcsErr.Error.Message, resp.Header.Get("X-GUploader-UploadID"))
+}
+
+// Put uploads an object - as a resumable upload if the transfer is a multipart one
+func (b *gcsBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	header := http.Header{}
+	contentType := "application/octet-stream"
+	if options != nil && options.contentType != "" {
+		contentType = options.contentType
+	}
+	var err error
+	if transfer.Multipart {
+		err = b.putResumable(ctx, bucket, objectName, content, size, transfer, contentType)
+	} else {
+		header.Set("Content-Type", contentType)
+		err = b.doAndDiscard(ctx, http.MethodPost, b.uploadURL(bucket, objectName, "media"), header, content, size)
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to upload object,")
+		return err
+	}
+	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
+	return nil
+}
+
+// gcsChunkSize returns the part size rounded down to the chunk alignment of resumable uploads
+func gcsChunkSize(partSize uint64) int64 {
+	chunkSize := int64(partSize) / gcsChunkAlignment * gcsChunkAlignment
+	if chunkSize == 0 {
+		return gcsChunkAlignment
+	}
+	return chunkSize
+}
+
+// putResumable uploads an object in chunks of the part size. The chunks of a
+// resumable upload are sent one after the other, so the concurrency does not apply.
+func (b *gcsBackend) putResumable(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, contentType string) error {
+	header := http.Header{}
+	header.Set("X-Upload-Content-Type", contentType)
+	header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	resp, err := b.do(ctx, http.MethodPost, b.uploadURL(bucket, objectName, "resumable"), header, nil, 0)
+	if err = discardResponse(resp, err); err != nil {
+		return err
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("The resumable upload of %s got no session URI", objectName)
+	}
+	data, err := readerAt(content)
+	if err != nil {
+		return err
+	}
+	chunkSize := gcsChunkSize(transfer.PartSize)
+	for offset := int64(0); offset < size || offset == 0; offset += chunkSize {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		header := http.Header{}
+		if length == 0 {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		} else {
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+		}
+		// All but the last chunk are acknowledged with 308 Resume Incomplete
+		if err := b.doAndDiscard(ctx, http.MethodPut, session, header, io.NewSectionReader(data, offset, length), length); err != nil {
+			return err
+		}
+		if length == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// Get downloads an object - with ranged requests of the part size if the transfer is a multipart one
+func (b *gcsBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	mediaURL := b.objectURL(bucket, objectName) + "?alt=media"
+	if !transfer.Multipart {
+		return b.doAndDiscard(ctx, http.MethodGet, mediaURL, nil, nil, 0)
+	}
+	info, err := b.Head(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	return forEachPart(ctx, info.Size, int64(transfer.PartSize), transfer.Concurrency, func(ctx context.Context, part int, offset int64, length int64) error {
+		if length == 0 {
+			return nil
+		}
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		return b.doAndDiscard(ctx, http.MethodGet, mediaURL, header, nil, 0)
+	})
+}
+
+// List returns the objects of a bucket with the given prefix
+func (b *gcsBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var result struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		if err := b.doJSON(ctx, http.MethodGet, b.bucketURL(bucket)+"/o?"+query.Encode(), "", &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Items {
+			objects = append(objects, object.info())
+		}
+		if result.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// Delete removes an object
+func (b *gcsBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	err := b.doAndDiscard(ctx, http.MethodDelete, b.objectURL(bucket, objectName), nil, nil, 0)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Head returns the metadata of an object
+func (b *gcsBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	var object gcsObject
+	if err := b.doJSON(ctx, http.MethodGet, b.objectURL(bucket, objectName), "", &object); err != nil {
+		return ObjectInfo{}, err
+	}
+	return object.info(), nil
+}
+
+// CreateBucket creates a bucket in the project
+func (b *gcsBackend) CreateBucket(ctx context.Context, bucket string) error {
+	body, err := json.Marshal(map[string]string{"name": bucket})
+	if err != nil {
+		return err
+	}
+	var result gcsObject
+	err = b.doJSON(ctx, http.MethodPost, b.endpoint+"/storage/v1/b?"+url.Values{"project": {b.project}}.Encode(), string(body), &result)
+	if isStatus(err, http.StatusConflict) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithField("bucket", bucket).Info("Issues when creating bucket")
+	}
+	return err
+}
+
+// DeleteBucket removes all objects of a bucket and then the bucket itself
+func (b *gcsBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	objects, err := b.List(ctx, bucket, "")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := b.Delete(ctx, bucket, object.Key); err != nil {
+			return err
+		}
+	}
+	return b.doAndDiscard(ctx, http.MethodDelete, b.bucketURL(bucket), nil, nil, 0)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// fakeGCS is a minimal JSON API in the spirit of fake-gcs-server
+type fakeGCS struct {
+	token string
+
+	mutex    sync.Mutex
+	buckets  map[string]map[string][]byte
+	sessions map[string][]byte
+	requests []string
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": {"code": 401, "message": "Invalid Credentials", "errors": [{"reason": "authError"}]}}`)
+		return
+	}
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i := range path {
+		path[i], _ = url.PathUnescape(path[i])
+	}
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+query.Get("uploadType")))
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": {"code": 404, "message": "Not Found", "errors": [{"reason": "notFound"}]}}`)
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/storage/v1/b":
+		var bucket gcsObject
+		json.Unmarshal(body, &bucket)
+		if _, ok := f.buckets[bucket.Name]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.buckets[bucket.Name] = map[string][]byte{}
+		fmt.Fprintf(w, `{"name": %q}`, bucket.Name)
+	case r.Method == http.MethodPost && query.Get("uploadType") == "media":
+		f.buckets[path[4]][query.Get("name")] = body
+		fmt.Fprintf(w, `{"name": %q, "size": "%d"}`, query.Get("name"), len(body))
+	case r.Method == http.MethodPost && query.Get("uploadType") == "resumable":
+		session := fmt.Sprintf("%s/%s", path[4], query.Get("name"))
+		f.sessions[session] = []byte{}
+		w.Header().Set("Location", "http://"+r.Host+"/session/"+session)
+	case r.Method == http.MethodPut && path[0] == "session":
+		session := strings.Join(path[1:], "/")
+		var start, end, total int64
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start != int64(len(f.sessions[session])) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) != end-start+1 || (end+1 != total && len(body)%gcsChunkAlignment != 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.sessions[session] = append(f.sessions[session], body...)
+		if end+1 < total {
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		f.buckets[path[1]][strings.Join(path[2:], "/")] = f.sessions[session]
+		delete(f.sessions, session)
+	case r.Method == http.MethodGet && len(path) == 5 && path[4] == "o":
+		var names []string
+		for name := range f.buckets[path[3]] {
+			if strings.HasPrefix(name, query.Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		var items []gcsObject
+		for _, name := range names {
+			items = append(items, gcsObject{Name: name, Size: fmt.Sprint(len(f.buckets[path[3]][name]))})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet && len(path) == 6:
+		data, ok := f.buckets[path[3]][path[5]]
+		if !ok {
+			notFound()
+			return
+		}
+		if query.Get("alt") != "media" {
+			fmt.Fprintf(w, `{"name": %q, "size": "%d"}`, path[5], len(data))
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			data = data[start : end+1]
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete && len(path) == 6:
+		if _, ok := f.buckets[path[3]][path[5]]; !ok {
+			notFound()
+			return
+		}
+		delete(f.buckets[path[3]], path[5])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && len(path) == 4:
+		if len(f.buckets[path[3]]) != 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(f.buckets, path[3])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestGCSBackend(t *testing.T, auth gcsAuthenticator, token string) (*gcsBackend, *fakeGCS) {
+	fake := &fakeGCS{token: token, buckets: map[string]map[string][]byte{}, sessions: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	config := common.S3Configuration{GCS: common.GCSConfiguration{Project: "bench", Endpoint: server.URL}}
+	return newGCSBackend(config, server.Client(), auth), fake
+}
+
+func Test_gcsBackend(t *testing.T) {
+	content := []byte(strings.Repeat("gosbench", 100000))
+	tests := []struct {
+		name         string
+		transfer     TransferOptions
+		wantRequests []string
+	}{
+		{"Single request", TransferOptions{}, []string{"POST media", "GET"}},
+		{"Resumable upload", TransferOptions{Multipart: true, PartSize: 300 * 1024, Concurrency: 2},
+			[]string{"POST resumable", "PUT", "PUT", "PUT", "PUT", "GET", "GET", "GET", "GET"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, fake := newTestGCSBackend(t, gcsStaticToken("token"), "token")
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			fake.requests = nil
+			if err := b.Put(ctx, "bucket", "dir/object", bytes.NewReader(content), int64(len(content)), tt.transfer, nil); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if err := b.Get(ctx, "bucket", "dir/object", tt.transfer, nil); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(fake.requests, tt.wantRequests) {
+				t.Errorf("Put() and Get() sent %v, want %v", fake.requests, tt.wantRequests)
+			}
+
+			b, fake = newTestGCSBackend(t, gcsStaticToken("token"), "token")
+			testBackendContract(t, b, content, tt.transfer, func(bucket string, key string) []byte {
+				return fake.buckets[bucket][key]
+			}, "notFound")
+		})
+	}
+}
+
+func Test_gcsBackend_noAuth(t *testing.T) {
+	b, _ := newTestGCSBackend(t, gcsStaticToken(""), "token")
+	if errorClass, status := classifyError(b.CreateBucket(context.Background(), "bucket")); errorClass != "authError" || status != http.StatusUnauthorized {
+		t.Errorf("classifyError() without a token = %s, %d", errorClass, status)
+	}
+}
+
+func Test_gcsServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":"bench@project.iam.gserviceaccount.com"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "service-token", "expires_in": 3600, "token_type": "Bearer"}`)
+	}))
+	defer tokenServer.Close()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "bench@project.iam.gserviceaccount.com",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenServer.URL,
+	})
+	credentialsFile := filepath.Join(t.TempDir(), "key.json")
+	if err := ioutil.WriteFile(credentialsFile, credentials, 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile() error = %v", err)
+	}
+	auth, err := newGCSAuthenticator(common.GCSConfiguration{Auth: common.GCSAuthServiceAccount, CredentialsFile: credentialsFile}, tokenServer.Client())
+	if err != nil {
+		t.Fatalf("newGCSAuthenticator() error = %v", err)
+	}
+	b, _ := newTestGCSBackend(t, auth, "service-token")
+	for i := 0; i < 3; i++ {
+		if err := b.CreateBucket(context.Background(), fmt.Sprintf("bucket%d", i)); err != nil {
+			t.Errorf("CreateBucket() error = %v", err)
+		}
+	}
+	if requests := atomic.LoadInt32(&tokenRequests); requests != 1 {
+		t.Errorf("The service account fetched %d tokens, want 1", requests)
+	}
+}
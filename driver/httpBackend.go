@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+	"go.opencensus.io/plugin/ochttp"
+)
+
+// restAPI is the part of the backends with a plain HTTP API - like Azure,
+// GCS or Swift - that differs between them
+type restAPI interface {
+	// authorize is called on every request right before it is sent
+	authorize(req *http.Request) error
+	// failed returns whether the response status is an error of the API
+	failed(status int) bool
+	// requestError returns the error of a response with an error status
+	requestError(resp *http.Response, body []byte) error
+}
+
+// cancelOnClose cancels the timeout of a request once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// doREST sends a request with the given timeout. Responses with an error status
+// are returned as the error of the API - usually an awserr.RequestFailure,
+// so that they are classified just like S3 errors.
+func doREST(ctx context.Context, api restAPI, client *http.Client, timeout time.Duration, method string, url string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = length
+	if body == nil || length == 0 {
+		req.Body = http.NoBody
+	}
+	if err = api.authorize(req); err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	if api.failed(resp.StatusCode) {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, api.requestError(resp, data)
+	}
+	return resp, nil
+}
+
+// discardResponse reads and closes the response of a request
+func discardResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
+// newRequestFailure returns the error of a failed request of a plain HTTP API
+func newRequestFailure(resp *http.Response, code string, message string, requestID string) error {
+	return awserr.NewRequestFailure(awserr.New(code, message, nil), resp.StatusCode, requestID)
+}
+
+// isStatus checks whether the request failed with the given HTTP status
+func isStatus(err error, status int) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.StatusCode() == status
+}
+
+// initHTTPBackend sets up the measured and the housekeeping instances of a
+// backend with a plain HTTP API. They use the HTTP transport of the S3 options.
+func initHTTPBackend(config common.S3Configuration, seed int64, name string, endpoint string, newBackend func(client *http.Client) (Backend, error)) {
+	tr, err := newHTTPTransport(config)
+	if err != nil {
+		log.WithError(err).Fatalf("Unable to configure the HTTP transport:")
+	}
+	hc = &http.Client{Transport: &ochttp.Transport{Base: tr}}
+	if backend, err = newBackend(hc); err != nil {
+		log.WithError(err).Fatalf("Unable to set up the %s backend:", name)
+	}
+	// Use this backend to do things that are hidden from the performance monitoring
+	if housekeepingBackend, err = newBackend(&http.Client{Transport: tr}); err != nil {
+		log.WithError(err).Fatalf("Unable to set up the %s backend:", name)
+	}
+	if balancer, err = newEndpointBalancer(common.S3Configuration{Endpoint: endpoint}, seed); err != nil {
+		log.WithError(err).Fatalf("Unable to parse the %s endpoint:", name)
+	}
+	ctx = context.Background()
+	log.Debugf("%s Init done", name)
+}
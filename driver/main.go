@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,9 +10,9 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/mulbc/gosbench/common"
 	log "github.com/sirupsen/logrus"
 )
@@ -25,7 +26,6 @@ func init() {
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
 	})
-	rand.Seed(time.Now().UnixNano())
 }
 
 func main() {
@@ -62,10 +62,11 @@ func connectToServer(serverAddress string) error {
 		// return errors.New("Could not establish connection to server yet")
 		return err
 	}
-	encoder := json.NewEncoder(conn)
+	defer conn.Close()
+	server := &serverConnection{encoder: json.NewEncoder(conn)}
 	decoder := json.NewDecoder(conn)
 
-	_ = encoder.Encode("ready for work")
+	_ = server.send("ready for work")
 
 	var response common.DriverMessage
 	Workqueue := &Workqueue{
@@ -75,7 +76,6 @@ func connectToServer(serverAddress string) error {
 		err := decoder.Decode(&response)
 		if err != nil {
 			log.WithField("message", response).WithError(err).Error("Server responded unusually - reconnecting")
-			conn.Close()
 			return errors.New("Issue when receiving work from server")
 		}
 		log.Tracef("Response: %+v", response)
@@ -84,8 +84,11 @@ func connectToServer(serverAddress string) error {
 			config = *response.Config
 			log.Info("Got config from server - starting preparations now")
 
-			randomData = generateRandomBytes(config.Test.Objects.SizeMax)
-			InitS3(*config.S3Config)
+			seed := common.DriverSeed(config.Test.Seed, config.DriverID)
+			log.WithField("seed", seed).Info("Seeding random decisions of this driver")
+			common.SeedRandom(seed)
+			randomData = generateRandomBytes(config.Test.MaxObjectSize(), rand.New(rand.NewSource(seed)))
+			initBackend(*config.S3Config, seed)
 			fillWorkqueue(config.Test, Workqueue, config.DriverID, config.Test.DriversShareBuckets)
 
 			for _, work := range *Workqueue.Queue {
@@ -95,24 +98,43 @@ func connectToServer(serverAddress string) error {
 				}
 			}
 			log.Info("Preparations finished - waiting on server to start work")
-			_ = encoder.Encode(common.DriverMessage{Message: "preparations done"})
+			_ = server.send(common.DriverMessage{Message: "preparations done"})
 		case "start work":
 			if config == (common.DriverConf{}) || len(*Workqueue.Queue) == 0 {
 				log.Fatal("Was instructed to start work - but the preparation step is incomplete - reconnecting")
 				return nil
 			}
 			log.Info("Starting to work")
-			duration := PerfTest(config.Test, Workqueue, config.DriverID)
+			var bytesBudget *leasedBytesBudget
+			if config.Test.BytesDeadline != 0 {
+				bytesBudget = newLeasedBytesBudget(func() error {
+					return server.send(common.DriverMessage{Message: "bytes lease request"})
+				})
+			}
+			monitor = newTestMonitor(config.Test, bytesBudget, func(reason string) {
+				// Let the server stop the other drivers as well
+				_ = server.send(common.DriverMessage{Message: "stop condition reached", StopReason: reason})
+			})
+			var budget opsBudget = &localOpsBudget{max: config.Test.OpsDeadline}
+			var leases chan uint64
+			if config.Test.OpsDeadlineGlobal {
+				leasedBudget := newLeasedOpsBudget(server, monitor.stopped)
+				budget, leases = leasedBudget, leasedBudget.leases
+			}
+			go receiveDuringWork(decoder, monitor, leases)
+			duration := PerfTest(config.Test, Workqueue, config.DriverID, budget)
 			benchResults := getCurrentPromValues(config.Test)
+			benchResults.StopReason = monitor.reason()
 			benchResults.Duration = duration
 			benchResults.Bandwidth = benchResults.Bytes / duration.Seconds()
 			benchResults.OpsPerSecond = benchResults.Operations / duration.Seconds()
-			log.Infof("PROM VALUES %s, %s, %s, %d, %.2f, %.2f, %.2f, %.2f ops/s, %.2f MB, %.2f MB/s, %.2f ms, %.2f%%, %.2f s, %s",
+			benchResults.Seed = common.DriverSeed(config.Test.Seed, config.DriverID)
+			log.Infof("PROM VALUES %s, %s, %s, %d, %.2f, %.2f, %.2f, %.2f, %.2f, %.2f ops/s, %.2f MB, %.2f MB/s, %.2f ms, %.2f%%, %.2f s, %s, seed %d, stopped by %s",
 				benchResults.Host, benchResults.TestName, benchResults.OperationName, benchResults.Workers, benchResults.ObjectSize,
-				benchResults.Operations, benchResults.FailedOperations, benchResults.OpsPerSecond, benchResults.Bytes/(1024*1024),
+				benchResults.Operations, benchResults.FailedOperations, benchResults.TimedOutOperations, benchResults.Retries, benchResults.OpsPerSecond, benchResults.Bytes/(1024*1024),
 				benchResults.Bandwidth/(1024*1024), benchResults.LatencyAvg, benchResults.SuccessRatio*100, benchResults.Duration.Seconds(),
-				benchResults.Options)
-			_ = encoder.Encode(common.DriverMessage{Message: "work done", BenchResult: benchResults})
+				benchResults.Options, benchResults.Seed, benchResults.StopReason)
+			_ = server.send(common.DriverMessage{Message: "work done", BenchResult: benchResults})
 			// Work is done - return to being a ready driver by reconnecting
 			return nil
 		case "shutdown":
@@ -122,11 +144,53 @@ func connectToServer(serverAddress string) error {
 	}
 }
 
+// serverConnection serializes the messages that a driver sends to the server,
+// as workers may report breached stop conditions while the test is running
+type serverConnection struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func (c *serverConnection) send(message interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.encoder.Encode(message)
+}
+
+// receiveDuringWork handles the messages of the server while the test is running.
+// Ops leases are passed on to the given channel.
+// It returns when the server closes the connection after the test.
+func receiveDuringWork(decoder *json.Decoder, monitor *testMonitor, leases chan<- uint64) {
+	for {
+		var response common.DriverMessage
+		err := decoder.Decode(&response)
+		if err != nil {
+			log.WithError(err).Trace("Stopped receiving messages from the server")
+			return
+		}
+		log.Tracef("Response: %+v", response)
+		switch response.Message {
+		case "stop work":
+			log.WithField("reason", response.StopReason).Info("Server told us to stop the test early")
+			monitor.stop(response.StopReason)
+		case "ops lease":
+			if leases != nil {
+				leases <- response.OpsLease
+			}
+		case "bytes lease":
+			if monitor.bytesBudget != nil {
+				monitor.bytesBudget.receive(response.BytesLease)
+			}
+		}
+	}
+}
+
 // PerfTest runs a performance test as configured in testConfig
-func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, driverID string) time.Duration {
+func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, driverID string, budget opsBudget) time.Duration {
 	workChannel := make(chan WorkItem, len(*Workqueue.Queue))
 	doneChannel := make(chan bool)
 
+	workContext, WorkCancel = context.WithCancel(context.Background())
 	startTime := time.Now().UTC()
 	promTestStart.WithLabelValues(testConfig.Name).Set(float64(startTime.UnixNano() / int64(1000000)))
 	// promTestGauge.WithLabelValues(testConfig.Name).Inc()
@@ -137,7 +201,8 @@ func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, dr
 	if testConfig.Runtime != 0 {
 		workUntilTimeout(Workqueue, workChannel, time.Duration(testConfig.Runtime))
 	} else {
-		workUntilOps(Workqueue, workChannel, testConfig.OpsDeadline, testConfig.Workers)
+		// Also used when the test only stops with stop_with_bytes
+		workUntilOps(Workqueue, workChannel, budget, testConfig.Workers)
 	}
 	// Wait for all the goroutines to finish
 	for i := 0; i < testConfig.Workers; i++ {
@@ -155,8 +220,13 @@ func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, dr
 				log.WithError(err).Error("Error during cleanup - ignoring")
 			}
 		}
+		deleteBucket := housekeepingBackend.DeleteBucket
+		if testConfig.ObjectLock.Enabled {
+			// Objects under governance retention or legal hold can not be deleted otherwise
+			deleteBucket = housekeepingBackend.(ObjectLockBackend).DeleteLockedBucket
+		}
 		for bucket := uint64(0); bucket < testConfig.Buckets.NumberMax; bucket++ {
-			err := deleteBucket(housekeepingSvc, fmt.Sprintf("%s%s%d", driverID, testConfig.BucketPrefix, bucket))
+			err := deleteBucket(ctx, fmt.Sprintf("%s%s%d", driverID, testConfig.BucketPrefix, bucket))
 			if err != nil {
 				log.WithError(err).Error("Error during bucket deleting - ignoring")
 			}
@@ -169,56 +239,68 @@ func PerfTest(testConfig *common.TestCaseConfiguration, Workqueue *Workqueue, dr
 }
 
 func workUntilTimeout(Workqueue *Workqueue, workChannel chan WorkItem, runtime time.Duration) {
-	workContext, WorkCancel = context.WithCancel(context.Background())
 	timer := time.NewTimer(runtime)
 	for {
 		for _, work := range *Workqueue.Queue {
 			select {
 			case <-timer.C:
 				log.Debug("Reached Runtime end")
+				monitor.stop(stopReasonRuntime)
+				WorkCancel()
+				return
+			case <-monitor.stopped:
+				log.WithField("reason", monitor.reason()).Info("Reached stop condition")
 				WorkCancel()
 				return
 			case workChannel <- work:
 			}
 		}
-		for _, work := range *Workqueue.Queue {
-			switch work.(type) {
-			case DeleteOperation:
-				log.Debug("Re-Running Work preparation for delete job started")
-				err := work.Prepare()
-				if err != nil {
-					log.WithError(err).Error("Error during work preparation - ignoring")
-				}
-				log.Debug("Delete preparation re-run finished")
-			}
-		}
+		rerunDeletePreparations(Workqueue)
 	}
 }
 
-func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, maxOps uint64, numberOfWorker int) {
-	currentOps := uint64(0)
+// workUntilOps sends work until the ops budget is used up or another stop
+// condition is reached
+func workUntilOps(Workqueue *Workqueue, workChannel chan WorkItem, budget opsBudget, numberOfWorker int) {
 	for {
 		for _, work := range *Workqueue.Queue {
-			if currentOps >= maxOps {
+			if !budget.take() {
+				if monitor.reason() != "" {
+					log.WithField("reason", monitor.reason()).Info("Reached stop condition")
+					WorkCancel()
+					return
+				}
 				log.Debug("Reached OpsDeadline ... waiting for workers to finish")
+				monitor.stop(stopReasonOps)
 				for worker := 0; worker < numberOfWorker; worker++ {
 					workChannel <- Stopper{}
 				}
 				return
 			}
-			currentOps++
-			workChannel <- work
+			select {
+			case <-monitor.stopped:
+				log.WithField("reason", monitor.reason()).Info("Reached stop condition")
+				WorkCancel()
+				return
+			case workChannel <- work:
+			}
 		}
-		for _, work := range *Workqueue.Queue {
-			switch work.(type) {
-			case DeleteOperation:
-				log.Debug("Re-Running Work preparation for delete job started")
-				err := work.Prepare()
-				if err != nil {
-					log.WithError(err).Error("Error during work preparation - ignoring")
-				}
-				log.Debug("Delete preparation re-run finished")
+		rerunDeletePreparations(Workqueue)
+	}
+}
+
+// rerunDeletePreparations recreates the objects that were deleted
+// by the delete operations of the last run through the work queue
+func rerunDeletePreparations(Workqueue *Workqueue) {
+	for _, work := range *Workqueue.Queue {
+		switch work.(type) {
+		case DeleteOperation:
+			log.Debug("Re-Running Work preparation for delete job started")
+			err := work.Prepare()
+			if err != nil {
+				log.WithError(err).Error("Error during work preparation - ignoring")
 			}
+			log.Debug("Delete preparation re-run finished")
 		}
 	}
 }
@@ -241,21 +323,55 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 		Workqueue.OperationValues = append(Workqueue.OperationValues, KV{Key: "delete"})
 	}
 
+	options := newObjectOptions(testConfig)
+	lifecycle := testConfig.Multipart.MultipartLifecycleConfiguration
+	explicitMPU := testConfig.Multipart.WriteMPUEnabled && lifecycle.WriteMPUMode == common.MultipartModeExplicit
+	// The aborted uploads and the targeted versions are chosen once, so that
+	// a replayed seed makes the same choices
+	decisions := rand.New(rand.NewSource(common.DriverSeed(testConfig.Seed, driverID)))
+	versioning := testConfig.Versioning
+	versions := versioning.Versions
+	if versions < 1 {
+		versions = 1
+	}
+	copySource := ""
+	if explicitMPU && lifecycle.WritePartCopy && testConfig.WriteWeight > 0 {
+		copySource = fmt.Sprintf("%s%scopy-source", driverID, testConfig.ObjectPrefix)
+	}
 	bucketCount := common.EvaluateDistribution(testConfig.Buckets.NumberMin, testConfig.Buckets.NumberMax, &testConfig.Buckets.NumberLast, 1, testConfig.Buckets.NumberDistribution)
 	for bucket := uint64(0); bucket < bucketCount; bucket++ {
 		bucketName := fmt.Sprintf("%s%s%d", driverID, testConfig.BucketPrefix, bucket)
 		if shareBucketName {
 			bucketName = fmt.Sprintf("%s%d", testConfig.BucketPrefix, bucket)
 		}
-		err := createBucket(housekeepingSvc, bucketName)
+		var err error
+		if testConfig.ObjectLock.Enabled {
+			err = housekeepingBackend.(ObjectLockBackend).CreateLockedBucket(ctx, bucketName)
+		} else {
+			err = housekeepingBackend.CreateBucket(ctx, bucketName)
+		}
 		if err != nil {
 			log.WithError(err).WithField("bucket", bucketName).Error("Error when creating bucket")
 		}
-		var PreExistingObjects *s3.ListObjectsOutput
+		if versioning.Enabled {
+			err = housekeepingBackend.(VersionedBackend).EnableVersioning(ctx, bucketName)
+			if err != nil {
+				log.WithError(err).WithField("bucket", bucketName).Error("Error when enabling versioning")
+			}
+		}
+		if copySource != "" {
+			// The parts of the writes are copied from this object - it is as large as the largest object
+			err = housekeepingBackend.Put(ctx, bucketName, copySource, bytes.NewReader(randomData), int64(len(randomData)),
+				uploadTransferOptions(true, testConfig.Multipart.WritePartSize, testConfig.Multipart.WriteConcurrency), nil)
+			if err != nil {
+				log.WithError(err).WithField("bucket", bucketName).Error("Error when uploading the copy source")
+			}
+		}
+		var PreExistingObjects []ObjectInfo
 		var PreExistingObjectCount uint64
 		if testConfig.ExistingReadWeight > 0 {
-			PreExistingObjects, err = listObjects(housekeepingSvc, "", bucketName)
-			PreExistingObjectCount = uint64(len(PreExistingObjects.Contents))
+			PreExistingObjects, err = housekeepingBackend.List(ctx, bucketName, "")
+			PreExistingObjectCount = uint64(len(PreExistingObjects))
 			log.Debugf("Found %d objects in bucket %s", PreExistingObjectCount, bucketName)
 			if err != nil {
 				log.WithError(err).Fatalf("Problems when listing contents of bucket %s", bucketName)
@@ -263,9 +379,8 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 		}
 		objectCount := common.EvaluateDistribution(testConfig.Objects.NumberMin, testConfig.Objects.NumberMax, &testConfig.Objects.NumberLast, 1, testConfig.Objects.NumberDistribution)
 		for object := uint64(0); object < objectCount; object++ {
-			objectSize := common.EvaluateDistribution(testConfig.Objects.SizeMin, testConfig.Objects.SizeMax, &testConfig.Objects.SizeLast, 1, testConfig.Objects.SizeDistribution)
-
 			nextOp := GetNextOperation(Workqueue)
+			objectSize := nextObjectSize(testConfig, nextOp)
 			switch nextOp {
 			case "read":
 				err := IncreaseOperationValue(nextOp, 1/float64(testConfig.ReadWeight), Workqueue)
@@ -281,6 +396,9 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 					MPUEnabled:               testConfig.Multipart.ReadMPUEnabled,
 					PartSize:                 testConfig.Multipart.ReadPartSize,
 					MPUConcurrency:           testConfig.Multipart.ReadConcurrency,
+					Options:                  options,
+					Versions:                 versions,
+					Version:                  newVersionTarget(versioning.Read, versions, decisions),
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			case "existing_read":
@@ -291,16 +409,17 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 				new := ReadOperation{
 					TestName:                 testConfig.Name,
 					Bucket:                   bucketName,
-					ObjectName:               *PreExistingObjects.Contents[object%PreExistingObjectCount].Key,
-					ObjectSize:               uint64(*PreExistingObjects.Contents[object%PreExistingObjectCount].Size),
+					ObjectName:               PreExistingObjects[object%PreExistingObjectCount].Key,
+					ObjectSize:               uint64(PreExistingObjects[object%PreExistingObjectCount].Size),
 					WorksOnPreexistingObject: true,
 					MPUEnabled:               testConfig.Multipart.ReadMPUEnabled,
 					PartSize:                 testConfig.Multipart.ReadPartSize,
 					MPUConcurrency:           testConfig.Multipart.ReadConcurrency,
+					Options:                  options,
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			case "write":
-				err := IncreaseOperationValue(nextOp, 1/float64(testConfig.WriteWeight), Workqueue)
+				err := IncreaseOperationValue(nextOp, float64(versions)/float64(testConfig.WriteWeight), Workqueue)
 				if err != nil {
 					log.WithError(err).Error("Could not increase operational Value - ignoring")
 				}
@@ -312,8 +431,16 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 					MPUEnabled:     testConfig.Multipart.WriteMPUEnabled,
 					PartSize:       testConfig.Multipart.WritePartSize,
 					MPUConcurrency: testConfig.Multipart.WriteConcurrency,
+					Options:        options,
+					ExplicitMPU:    explicitMPU,
+					PartOrder:      lifecycle.WritePartOrder,
+					AbortMPU:       explicitMPU && decisions.Float64() < lifecycle.WriteAbortRatio,
+					CopySource:     copySource,
+				}
+				// Every version of the key is written by a write of its own
+				for version := 0; version < versions; version++ {
+					*Workqueue.Queue = append(*Workqueue.Queue, new)
 				}
-				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			case "list":
 				err := IncreaseOperationValue(nextOp, 1/float64(testConfig.ListWeight), Workqueue)
 				if err != nil {
@@ -327,6 +454,8 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 					MPUEnabled:     testConfig.Multipart.WriteMPUEnabled,
 					PartSize:       testConfig.Multipart.WritePartSize,
 					MPUConcurrency: testConfig.Multipart.WriteConcurrency,
+					Options:        options,
+					Versions:       versions,
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			case "delete":
@@ -342,9 +471,21 @@ func fillWorkqueue(testConfig *common.TestCaseConfiguration, Workqueue *Workqueu
 					MPUEnabled:     testConfig.Multipart.WriteMPUEnabled,
 					PartSize:       testConfig.Multipart.WritePartSize,
 					MPUConcurrency: testConfig.Multipart.WriteConcurrency,
+					Options:        options,
+					Versions:       versions,
+					Version:        newVersionTarget(versioning.Delete, versions, decisions),
 				}
 				*Workqueue.Queue = append(*Workqueue.Queue, new)
 			}
 		}
 	}
 }
+
+// nextObjectSize returns the size of the next object for the given operation.
+// Operations without a size override use the test case's object sizes.
+func nextObjectSize(testConfig *common.TestCaseConfiguration, operation string) uint64 {
+	if sizes := testConfig.ObjectSizeOverride(operation); sizes != nil {
+		return common.EvaluateSizeDistribution(sizes.SizeMin, sizes.SizeMax, &sizes.SizeLast, sizes.SizeDistribution, sizes.SizeBuckets)
+	}
+	return common.EvaluateSizeDistribution(testConfig.Objects.SizeMin, testConfig.Objects.SizeMax, &testConfig.Objects.SizeLast, testConfig.Objects.SizeDistribution, testConfig.Objects.SizeBuckets)
+}
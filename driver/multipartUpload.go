@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// The steps of an explicit multipart upload - as S3 operation names
+const (
+	mpuStepCreate   = "CreateMultipartUpload"
+	mpuStepPart     = "UploadPart"
+	mpuStepPartCopy = "UploadPartCopy"
+	mpuStepComplete = "CompleteMultipartUpload"
+	mpuStepAbort    = "AbortMultipartUpload"
+)
+
+// multipartStepsKey is the context key of the labels of the multipart step metrics
+type multipartStepsKey struct{}
+
+type multipartStepLabels struct {
+	testName string
+	endpoint string
+}
+
+// withMultipartSteps returns a context that records the latency of every
+// step of the explicit multipart uploads that are sent with it. Uploads
+// without it - e.g. during the preparations - are not measured.
+func withMultipartSteps(parent context.Context, testName string, endpoint string) context.Context {
+	return context.WithValue(parent, multipartStepsKey{}, multipartStepLabels{testName: testName, endpoint: endpoint})
+}
+
+// observeMultipartStep records the latency of a single step of an explicit multipart upload
+func observeMultipartStep(ctx context.Context, step string, start time.Time) {
+	if labels, ok := ctx.Value(multipartStepsKey{}).(multipartStepLabels); ok {
+		promMultipartStepLatency.WithLabelValues(labels.testName, step, labels.endpoint).Observe(float64(time.Since(start).Milliseconds()))
+	}
+}
+
+// partOrder returns the indices of the parts of an upload in the order in which they are sent.
+// The random order is derived from the object name, so that it is the same in every run.
+func partOrder(order string, parts int, objectName string) []int {
+	indices := make([]int, parts)
+	for i := range indices {
+		indices[i] = i
+	}
+	switch order {
+	case common.PartOrderReverse:
+		for i, j := 0, parts-1; i < j; i, j = i+1, j-1 {
+			indices[i], indices[j] = indices[j], indices[i]
+		}
+	case common.PartOrderRandom:
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(objectName))
+		rand.New(rand.NewSource(int64(hash.Sum64()))).Shuffle(parts, func(i, j int) {
+			indices[i], indices[j] = indices[j], indices[i]
+		})
+	}
+	return indices
+}
+
+// putObjectExplicitMPU uploads an object with CreateMultipartUpload, UploadPart
+// or UploadPartCopy and CompleteMultipartUpload - or AbortMultipartUpload if
+// the transfer abandons the upload. Every step is measured on its own.
+func putObjectExplicitMPU(ctx context.Context, service *s3.S3, objectName string, content io.ReadSeeker, bucket string, size int64, transfer TransferOptions, options *objectOptions) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: &bucket,
+		Key:    &objectName,
+	}
+	options.applyToCreateMultipartUpload(input)
+	start := time.Now()
+	created, err := service.CreateMultipartUploadWithContext(ctx, input)
+	observeMultipartStep(ctx, mpuStepCreate, start)
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to create multipart upload,")
+		return err
+	}
+	uploadID := created.UploadId
+
+	var reader io.ReaderAt
+	if transfer.CopySource == "" {
+		if reader, err = readerAt(content); err != nil {
+			return err
+		}
+	}
+	partSize := int64(transfer.PartSize)
+	order := partOrder(transfer.PartOrder, partCount(size, partSize), objectName)
+	completed := make([]*s3.CompletedPart, len(order))
+	err = forEachPart(ctx, size, partSize, transfer.Concurrency, func(ctx context.Context, i int, _ int64, _ int64) error {
+		part := order[i]
+		offset := int64(part) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		partNumber := aws.Int64(int64(part + 1))
+		start := time.Now()
+		// Empty objects have no range to copy
+		if transfer.CopySource != "" && length > 0 {
+			input := &s3.UploadPartCopyInput{
+				Bucket:          &bucket,
+				Key:             &objectName,
+				UploadId:        uploadID,
+				PartNumber:      partNumber,
+				CopySource:      aws.String(bucket + "/" + url.PathEscape(transfer.CopySource)),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+			}
+			options.applyToUploadPartCopy(input)
+			result, err := service.UploadPartCopyWithContext(ctx, input)
+			observeMultipartStep(ctx, mpuStepPartCopy, start)
+			if err != nil {
+				return err
+			}
+			completed[part] = &s3.CompletedPart{ETag: result.CopyPartResult.ETag, PartNumber: partNumber}
+			return nil
+		}
+		input := &s3.UploadPartInput{
+			Bucket:        &bucket,
+			Key:           &objectName,
+			UploadId:      uploadID,
+			PartNumber:    partNumber,
+			Body:          io.NewSectionReader(reader, offset, length),
+			ContentLength: &length,
+		}
+		options.applyToUploadPart(input)
+		result, err := service.UploadPartWithContext(ctx, input)
+		observeMultipartStep(ctx, mpuStepPart, start)
+		if err != nil {
+			return err
+		}
+		completed[part] = &s3.CompletedPart{ETag: result.ETag, PartNumber: partNumber}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to upload part,")
+		// Do not leave the parts of the failed upload behind
+		if _, abortErr := service.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &objectName,
+			UploadId: uploadID,
+		}); abortErr != nil {
+			log.WithError(abortErr).WithField("object", objectName).WithField("bucket", bucket).Warn("Failed to abort multipart upload")
+		}
+		return err
+	}
+
+	if transfer.Abort {
+		start = time.Now()
+		_, err = service.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &objectName,
+			UploadId: uploadID,
+		})
+		observeMultipartStep(ctx, mpuStepAbort, start)
+		if err != nil {
+			log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to abort multipart upload,")
+		}
+		return err
+	}
+
+	start = time.Now()
+	_, err = service.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &objectName,
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	observeMultipartStep(ctx, mpuStepComplete, start)
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to complete multipart upload,")
+		return err
+	}
+	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
+	return nil
+}
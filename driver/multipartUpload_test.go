@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+	"github.com/mulbc/gosbench/s3stub"
+	prom "github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+)
+
+func Test_partOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order string
+		parts int
+		want  []int
+	}{
+		{"sequential", common.PartOrderSequential, 4, []int{0, 1, 2, 3}},
+		{"reverse", common.PartOrderReverse, 4, []int{3, 2, 1, 0}},
+		{"single part", common.PartOrderReverse, 1, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partOrder(tt.order, tt.parts, "obj"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("partOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	random := partOrder(common.PartOrderRandom, 20, "obj")
+	if !reflect.DeepEqual(random, partOrder(common.PartOrderRandom, 20, "obj")) {
+		t.Errorf("partOrder() is not reproducible for the same object")
+	}
+	sorted := append([]int(nil), random...)
+	sort.Ints(sorted)
+	if reflect.DeepEqual(random, sorted) || !reflect.DeepEqual(sorted, partOrder(common.PartOrderSequential, 20, "obj")) {
+		t.Errorf("partOrder() = %v is no shuffled permutation", random)
+	}
+}
+
+// stepCount returns how often a step of the explicit multipart uploads was measured
+func stepCount(t *testing.T, testName string, step string) uint64 {
+	metric := &promModel.Metric{}
+	if err := promMultipartStepLatency.WithLabelValues(testName, step, "stub").(prom.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_putObjectExplicitMPU(t *testing.T) {
+	const partSize = 5 * 1024 * 1024
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*partSize+1024)/16)
+	tests := []struct {
+		name       string
+		transfer   TransferOptions
+		wantParts  []string
+		wantObject bool
+		wantSteps  map[string]uint64
+	}{
+		{"sequential", TransferOptions{PartOrder: common.PartOrderSequential}, []string{"1", "2", "3"}, true,
+			map[string]uint64{mpuStepCreate: 1, mpuStepPart: 3, mpuStepComplete: 1}},
+		{"reverse", TransferOptions{PartOrder: common.PartOrderReverse}, []string{"3", "2", "1"}, true,
+			map[string]uint64{mpuStepCreate: 1, mpuStepPart: 3, mpuStepComplete: 1}},
+		{"aborted", TransferOptions{Abort: true}, []string{"1", "2", "3"}, false,
+			map[string]uint64{mpuStepCreate: 1, mpuStepPart: 3, mpuStepComplete: 0, mpuStepAbort: 1}},
+		{"copied parts", TransferOptions{CopySource: "source"}, []string{"1", "2", "3"}, true,
+			map[string]uint64{mpuStepCreate: 1, mpuStepPart: 0, mpuStepPartCopy: 3, mpuStepComplete: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			b := newStubBackend(t, stub, common.S3Configuration{})
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			if err := b.Put(ctx, "bucket", "source", bytes.NewReader(data), int64(len(data)), TransferOptions{}, nil); err != nil {
+				t.Fatalf("Put() of the copy source error = %v", err)
+			}
+			var mutex sync.Mutex
+			var parts []string
+			stub.SetFaultInjector(func(operation string, r *http.Request) *s3stub.Fault {
+				if operation == "UploadPart" || operation == "UploadPartCopy" {
+					mutex.Lock()
+					parts = append(parts, r.URL.Query().Get("partNumber"))
+					mutex.Unlock()
+				}
+				return nil
+			})
+
+			transfer := tt.transfer
+			transfer.Multipart, transfer.Explicit, transfer.PartSize, transfer.Concurrency = true, true, partSize, 1
+			testName := "explicit-" + tt.name
+			err := b.Put(withMultipartSteps(ctx, testName, "stub"), "bucket", "obj", bytes.NewReader(data), int64(len(data)), transfer, nil)
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if !reflect.DeepEqual(parts, tt.wantParts) {
+				t.Errorf("Put() sent the parts %v, want %v", parts, tt.wantParts)
+			}
+			stored, ok := stub.Object("bucket", "obj")
+			if ok != tt.wantObject || (ok && !bytes.Equal(stored, data)) {
+				t.Errorf("Put() stored %d bytes, object exists: %v, want %v", len(stored), ok, tt.wantObject)
+			}
+			if stub.Uploads() != 0 {
+				t.Errorf("Put() left %d open uploads", stub.Uploads())
+			}
+			for step, want := range tt.wantSteps {
+				if got := stepCount(t, testName, step); got != want {
+					t.Errorf("%s was measured %d times, want %d", step, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_putObjectExplicitMPUFailedPart(t *testing.T) {
+	noRetries := 0
+	stub := s3stub.New()
+	b := newStubBackend(t, stub, common.S3Configuration{MaxRetries: &noRetries})
+	if err := b.CreateBucket(context.Background(), "bucket"); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	stub.SetFaultInjector(s3stub.ForOperations(s3stub.EveryNth(2, s3stub.InternalError), "UploadPart"))
+	data := bytes.Repeat([]byte("x"), 12*1024*1024)
+	transfer := TransferOptions{Multipart: true, Explicit: true, PartSize: 5 * 1024 * 1024, Concurrency: 1}
+	err := b.Put(context.Background(), "bucket", "obj", bytes.NewReader(data), int64(len(data)), transfer, nil)
+	if class, _ := classifyError(err); class != "InternalError" {
+		t.Errorf("Put() error = %v, want an InternalError", err)
+	}
+	if stub.Uploads() != 0 || stub.Requests("AbortMultipartUpload") != 1 {
+		t.Errorf("The failed upload was not aborted - %d open uploads", stub.Uploads())
+	}
+}
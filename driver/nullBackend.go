@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/mulbc/gosbench/common"
+)
+
+// nullBufferSize is the size of the buffers that the content of the objects is copied into
+const nullBufferSize = 32 * 1024
+
+// nullBackend accepts all writes and serves reads from the random data in
+// memory after an artificial latency. It measures the overhead of gosbench
+// itself - e.g. to find the throughput ceiling of a driver host.
+type nullBackend struct {
+	latency time.Duration
+	jitter  time.Duration
+
+	randomMutex sync.Mutex
+	random      *rand.Rand
+	buffers     sync.Pool
+
+	// mutex protects the sizes of the objects of all buckets
+	mutex   sync.RWMutex
+	buckets map[string]map[string]int64
+}
+
+// newNullBackend returns a null backend whose latency jitter is derived from the seed
+func newNullBackend(config common.NullConfiguration, seed int64) *nullBackend {
+	return &nullBackend{
+		latency: time.Duration(config.Latency),
+		jitter:  time.Duration(config.LatencyJitter),
+		random:  rand.New(rand.NewSource(seed)),
+		buckets: map[string]map[string]int64{},
+		buffers: sync.Pool{New: func() interface{} {
+			buffer := make([]byte, nullBufferSize)
+			return &buffer
+		}},
+	}
+}
+
+// drain copies the whole content into a buffer, just like a client that sends or receives it
+func (b *nullBackend) drain(content io.Reader) (int64, error) {
+	buffer := b.buffers.Get().(*[]byte)
+	defer b.buffers.Put(buffer)
+	var total int64
+	for {
+		n, err := content.Read(*buffer)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// wait sleeps for the artificial latency or until the context is done
+func (b *nullBackend) wait(ctx context.Context) error {
+	latency := b.latency
+	if b.jitter > 0 {
+		b.randomMutex.Lock()
+		latency += time.Duration(b.random.Int63n(int64(b.jitter)))
+		b.randomMutex.Unlock()
+	}
+	if latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notFound returns the error of a missing bucket or object, classified like the S3 one
+func notFound(code string, name string) error {
+	return awserr.NewRequestFailure(awserr.New(code, fmt.Sprintf("%s does not exist", name), nil), http.StatusNotFound, "")
+}
+
+// Put reads the whole content and remembers the size of the object
+func (b *nullBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	written, err := b.drain(content)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	objects, ok := b.buckets[bucket]
+	if !ok {
+		return notFound("NoSuchBucket", bucket)
+	}
+	objects[objectName] = written
+	return nil
+}
+
+// Get copies as many bytes of the random data as the object has
+func (b *nullBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	info, err := b.Head(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	if info.Size > int64(len(randomData)) {
+		info.Size = int64(len(randomData))
+	}
+	_, err = b.drain(bytes.NewReader(randomData[:info.Size]))
+	return err
+}
+
+// List returns the objects of a bucket with the given prefix
+func (b *nullBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	objects, ok := b.buckets[bucket]
+	if !ok {
+		return nil, notFound("NoSuchBucket", bucket)
+	}
+	var result []ObjectInfo
+	for name, size := range objects {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, ObjectInfo{Key: name, Size: size})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+// Delete forgets an object
+func (b *nullBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.buckets[bucket], objectName)
+	return nil
+}
+
+// Head returns the size of an object
+func (b *nullBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	if err := b.wait(ctx); err != nil {
+		return ObjectInfo{}, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	size, ok := b.buckets[bucket][objectName]
+	if !ok {
+		return ObjectInfo{}, notFound("NoSuchKey", objectName)
+	}
+	return ObjectInfo{Key: objectName, Size: size}, nil
+}
+
+// CreateBucket creates an empty bucket
+func (b *nullBackend) CreateBucket(ctx context.Context, bucket string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.buckets[bucket]; !ok {
+		b.buckets[bucket] = map[string]int64{}
+	}
+	return nil
+}
+
+// DeleteBucket forgets a bucket together with all its objects
+func (b *nullBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.buckets, bucket)
+	return nil
+}
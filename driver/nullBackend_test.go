@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_nullBackend(t *testing.T) {
+	randomData = make([]byte, 100000)
+	ctx := context.Background()
+	b := newNullBackend(common.NullConfiguration{}, 0)
+	if err := b.Put(ctx, "bucket", "object", bytes.NewReader(randomData), int64(len(randomData)), TransferOptions{}, nil); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Put() into a missing bucket error = %v, want 404", err)
+	}
+	if err := b.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	for _, name := range []string{"dir/object", "dir/other", "object"} {
+		if err := b.Put(ctx, "bucket", name, bytes.NewReader(randomData[:len(name)]), int64(len(name)), TransferOptions{}, nil); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	if err := b.Get(ctx, "bucket", "dir/object", TransferOptions{}, nil); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if errorClass, status := classifyError(b.Get(ctx, "bucket", "missing", TransferOptions{}, nil)); errorClass != "NoSuchKey" || status != http.StatusNotFound {
+		t.Errorf("classifyError() of a missing object = %s, %d", errorClass, status)
+	}
+	objects, err := b.List(ctx, "bucket", "dir/")
+	if want := []ObjectInfo{{Key: "dir/object", Size: 10}, {Key: "dir/other", Size: 9}}; err != nil || !reflect.DeepEqual(objects, want) {
+		t.Errorf("List() = %+v, %v, want %+v", objects, err, want)
+	}
+	if err := b.Delete(ctx, "bucket", "dir/object"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := b.Head(ctx, "bucket", "dir/object"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Head() of a deleted object error = %v, want 404", err)
+	}
+	if err := b.DeleteBucket(ctx, "bucket"); err != nil {
+		t.Errorf("DeleteBucket() error = %v", err)
+	}
+	if _, err := b.List(ctx, "bucket", ""); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("List() of a deleted bucket error = %v, want 404", err)
+	}
+}
+
+func Test_nullBackend_wait(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.NullConfiguration
+		timeout time.Duration
+		wantMin time.Duration
+		wantMax time.Duration
+		wantErr error
+	}{
+		{"No latency", common.NullConfiguration{}, time.Second, 0, 10 * time.Millisecond, nil},
+		{"Latency", common.NullConfiguration{Latency: common.Duration(20 * time.Millisecond)}, time.Second, 20 * time.Millisecond, 500 * time.Millisecond, nil},
+		{"Latency with jitter", common.NullConfiguration{Latency: common.Duration(10 * time.Millisecond), LatencyJitter: common.Duration(10 * time.Millisecond)},
+			time.Second, 10 * time.Millisecond, 500 * time.Millisecond, nil},
+		{"Canceled", common.NullConfiguration{Latency: common.Duration(time.Minute)}, 10 * time.Millisecond, 10 * time.Millisecond, 500 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			err := newNullBackend(tt.config, 0).wait(ctx)
+			if elapsed := time.Since(start); elapsed < tt.wantMin || elapsed > tt.wantMax {
+				t.Errorf("nullBackend.wait() took %v, want between %v and %v", elapsed, tt.wantMin, tt.wantMax)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("nullBackend.wait() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// objectOptions are the optional settings of a test that are sent with
+// every request that writes or reads an object. A nil objectOptions sends
+// plain requests.
+type objectOptions struct {
+	encryption string
+	kmsKeyID   string
+	// customerKeys are the generated SSE-C keys of the test
+	customerKeys []string
+
+	storageClass string
+	metadata     map[string]*string
+	// tagging is the URL encoded query of the object tags
+	tagging     string
+	acl         string
+	contentType string
+
+	// lockMode is the S3 Object Lock mode of the retention - empty without retention
+	lockMode  string
+	retention time.Duration
+	legalHold bool
+}
+
+// metadataCharacters are the characters of the generated user metadata values
+const metadataCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func newObjectOptions(testConfig *common.TestCaseConfiguration) *objectOptions {
+	options := &objectOptions{
+		encryption:   testConfig.Encryption.Type,
+		kmsKeyID:     testConfig.Encryption.KMSKeyID,
+		storageClass: testConfig.WriteOptions.StorageClass,
+		acl:          testConfig.WriteOptions.ACL,
+		contentType:  testConfig.WriteOptions.ContentType,
+		lockMode:     strings.ToUpper(testConfig.ObjectLock.Mode),
+		retention:    time.Duration(testConfig.ObjectLock.Retention),
+		legalHold:    testConfig.ObjectLock.LegalHold,
+	}
+	if testConfig.WriteOptions.MetadataCount > 0 {
+		source := rand.New(rand.NewSource(testConfig.Seed))
+		options.metadata = make(map[string]*string, testConfig.WriteOptions.MetadataCount)
+		for i := 0; i < testConfig.WriteOptions.MetadataCount; i++ {
+			value := make([]byte, testConfig.WriteOptions.MetadataSize)
+			for j := range value {
+				value[j] = metadataCharacters[source.Intn(len(metadataCharacters))]
+			}
+			options.metadata[fmt.Sprintf("gosbench-%d", i)] = aws.String(string(value))
+		}
+	}
+	if len(testConfig.WriteOptions.Tags) != 0 {
+		tags := url.Values{}
+		for key, value := range testConfig.WriteOptions.Tags {
+			tags.Set(key, value)
+		}
+		options.tagging = tags.Encode()
+	}
+	if options.encryption == common.EncryptionSSEC {
+		// Derive the keys from the test's seed, so that all drivers
+		// can read the objects of each other
+		source := rand.New(rand.NewSource(testConfig.Seed))
+		for i := 0; i < testConfig.Encryption.CustomerKeys; i++ {
+			key := make([]byte, 32)
+			if _, err := source.Read(key); err != nil {
+				log.WithError(err).Fatal("Could not generate SSE-C keys")
+			}
+			options.customerKeys = append(options.customerKeys, string(key))
+		}
+	}
+	return options
+}
+
+// objectLock returns whether the objects are written with a retention or a legal hold
+func (o *objectOptions) objectLock() bool {
+	return o.lockMode != "" || o.legalHold
+}
+
+// retainUntil returns the end of the retention of an object that is written now
+func (o *objectOptions) retainUntil() *time.Time {
+	return aws.Time(time.Now().Add(o.retention).UTC())
+}
+
+// legalHoldStatus returns the legal hold of the written objects - nil to send none
+func (o *objectOptions) legalHoldStatus() *string {
+	if !o.legalHold {
+		return nil
+	}
+	return aws.String(s3.ObjectLockLegalHoldStatusOn)
+}
+
+// contentMD5 returns the base64 encoded MD5 of the content and rewinds it.
+// S3 requires it for writes with Object Lock, but the SDK only computes it
+// when the checksums are validated.
+func contentMD5(content io.Reader) *string {
+	seeker, ok := content.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	hash := md5.New()
+	if _, err := io.Copy(hash, seeker); err != nil {
+		log.WithError(err).Warning("Could not compute the Content-MD5 of an object")
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		log.WithError(err).Warning("Could not rewind an object after computing its Content-MD5")
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(hash.Sum(nil)))
+}
+
+// customerKey returns the SSE-C key of an object
+func (o *objectOptions) customerKey(objectName string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(objectName))
+	return o.customerKeys[hash.Sum32()%uint32(len(o.customerKeys))]
+}
+
+// writeHeaders are the headers of all requests that write an object. The
+// fields are named like the fields of the SDK inputs they are copied to.
+type writeHeaders struct {
+	StorageClass         *string
+	Metadata             map[string]*string
+	Tagging              *string
+	ACL                  *string
+	ContentType          *string
+	ServerSideEncryption *string
+	SSEKMSKeyId          *string
+	SSECustomerAlgorithm *string
+	SSECustomerKey       *string
+
+	ObjectLockMode            *string
+	ObjectLockRetainUntilDate *time.Time
+	ObjectLockLegalHoldStatus *string
+}
+
+// applyWriteHeaders sets the headers of a written object on a PutObject,
+// Upload or CreateMultipartUpload input. Headers that are not set keep
+// the value of the input.
+func (o *objectOptions) applyWriteHeaders(input interface{}, objectName string) {
+	headers := writeHeaders{
+		StorageClass: optionalString(o.storageClass),
+		Metadata:     o.metadata,
+		Tagging:      optionalString(o.tagging),
+		ACL:          optionalString(o.acl),
+		ContentType:  optionalString(o.contentType),
+
+		ObjectLockLegalHoldStatus: o.legalHoldStatus(),
+	}
+	switch o.encryption {
+	case common.EncryptionSSES3:
+		headers.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case common.EncryptionSSEKMS:
+		headers.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		headers.SSEKMSKeyId = optionalString(o.kmsKeyID)
+	case common.EncryptionSSEC:
+		headers.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		headers.SSECustomerKey = aws.String(o.customerKey(objectName))
+	}
+	if o.lockMode != "" {
+		headers.ObjectLockMode = aws.String(o.lockMode)
+		headers.ObjectLockRetainUntilDate = o.retainUntil()
+	}
+	awsutil.Copy(input, &headers)
+}
+
+func (o *objectOptions) applyToPutObject(input *s3.PutObjectInput) {
+	if o == nil {
+		return
+	}
+	o.applyWriteHeaders(input, *input.Key)
+	if o.objectLock() && input.ContentMD5 == nil {
+		input.ContentMD5 = contentMD5(input.Body)
+	}
+}
+
+func (o *objectOptions) applyToUpload(input *s3manager.UploadInput) {
+	if o == nil {
+		return
+	}
+	o.applyWriteHeaders(input, *input.Key)
+	if o.objectLock() && input.ContentMD5 == nil {
+		input.ContentMD5 = contentMD5(input.Body)
+	}
+}
+
+func (o *objectOptions) applyToCreateMultipartUpload(input *s3.CreateMultipartUploadInput) {
+	if o == nil {
+		return
+	}
+	o.applyWriteHeaders(input, *input.Key)
+}
+
+// applyToUploader makes the uploader send the Content-MD5 of every part.
+// S3 requires it for the parts of uploads with Object Lock as well.
+func (o *objectOptions) applyToUploader(uploader *s3manager.Uploader) {
+	if o == nil || !o.objectLock() {
+		return
+	}
+	uploader.RequestOptions = append(uploader.RequestOptions, withPartContentMD5)
+}
+
+// withPartContentMD5 sets the Content-MD5 of the parts that the uploader sends
+func withPartContentMD5(r *request.Request) {
+	if input, ok := r.Params.(*s3.UploadPartInput); ok && input.ContentMD5 == nil {
+		input.ContentMD5 = contentMD5(input.Body)
+	}
+}
+
+// applyToUploadPart sets the SSE-C key and the Content-MD5 that Object Lock
+// needs on the part - the other options are set when the upload is created
+func (o *objectOptions) applyToUploadPart(input *s3.UploadPartInput) {
+	if o == nil {
+		return
+	}
+	if o.encryption == common.EncryptionSSEC {
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(o.customerKey(*input.Key))
+	}
+	if o.objectLock() && input.ContentMD5 == nil {
+		input.ContentMD5 = contentMD5(input.Body)
+	}
+}
+
+// applyToUploadPartCopy sets the SSE-C key of the upload on the copied part.
+// The copy sources are written without any options.
+func (o *objectOptions) applyToUploadPartCopy(input *s3.UploadPartCopyInput) {
+	if o == nil {
+		return
+	}
+	if o.encryption == common.EncryptionSSEC {
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(o.customerKey(*input.Key))
+	}
+}
+
+func (o *objectOptions) applyToGetObject(input *s3.GetObjectInput) {
+	if o == nil {
+		return
+	}
+	// SSE-S3 and SSE-KMS are decrypted transparently
+	if o.encryption == common.EncryptionSSEC {
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(o.customerKey(*input.Key))
+	}
+}
+
+// optionalString returns nil for empty strings, so that no header is sent
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
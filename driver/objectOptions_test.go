@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_objectOptions_encryption(t *testing.T) {
+	tests := []struct {
+		name            string
+		encryption      common.EncryptionConfiguration
+		wantSSE         string
+		wantKMSKeyID    string
+		wantCustomerKey bool
+	}{
+		{"No encryption", common.EncryptionConfiguration{}, "", "", false},
+		{"SSE-S3", common.EncryptionConfiguration{Type: common.EncryptionSSES3}, s3.ServerSideEncryptionAes256, "", false},
+		{"SSE-KMS", common.EncryptionConfiguration{Type: common.EncryptionSSEKMS, KMSKeyID: "my-key"}, s3.ServerSideEncryptionAwsKms, "my-key", false},
+		{"SSE-C", common.EncryptionConfiguration{Type: common.EncryptionSSEC, CustomerKeys: 4}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := newObjectOptions(&common.TestCaseConfiguration{Seed: 42, Encryption: tt.encryption})
+			put := &s3.PutObjectInput{Key: aws.String("object1")}
+			options.applyToPutObject(put)
+			upload := &s3manager.UploadInput{Key: aws.String("object1")}
+			options.applyToUpload(upload)
+			create := &s3.CreateMultipartUploadInput{Key: aws.String("object1")}
+			options.applyToCreateMultipartUpload(create)
+			get := &s3.GetObjectInput{Key: aws.String("object1")}
+			options.applyToGetObject(get)
+
+			if aws.StringValue(put.ServerSideEncryption) != tt.wantSSE || aws.StringValue(upload.ServerSideEncryption) != tt.wantSSE || aws.StringValue(create.ServerSideEncryption) != tt.wantSSE {
+				t.Errorf("ServerSideEncryption = %v/%v/%v, want %v", aws.StringValue(put.ServerSideEncryption), aws.StringValue(upload.ServerSideEncryption), aws.StringValue(create.ServerSideEncryption), tt.wantSSE)
+			}
+			if aws.StringValue(put.SSEKMSKeyId) != tt.wantKMSKeyID || aws.StringValue(upload.SSEKMSKeyId) != tt.wantKMSKeyID {
+				t.Errorf("SSEKMSKeyId = %v/%v, want %v", aws.StringValue(put.SSEKMSKeyId), aws.StringValue(upload.SSEKMSKeyId), tt.wantKMSKeyID)
+			}
+			if !tt.wantCustomerKey {
+				if put.SSECustomerKey != nil || upload.SSECustomerKey != nil || get.SSECustomerKey != nil {
+					t.Errorf("Unexpected SSE-C key")
+				}
+				return
+			}
+			if len(aws.StringValue(put.SSECustomerKey)) != 32 {
+				t.Errorf("SSE-C key has %d bytes, want 32", len(aws.StringValue(put.SSECustomerKey)))
+			}
+			// Writes and reads of an object have to use the same key
+			if *put.SSECustomerKey != *upload.SSECustomerKey || *put.SSECustomerKey != *create.SSECustomerKey || *put.SSECustomerKey != *get.SSECustomerKey {
+				t.Errorf("SSE-C keys of write and read differ")
+			}
+			if aws.StringValue(get.SSECustomerAlgorithm) != s3.ServerSideEncryptionAes256 {
+				t.Errorf("SSECustomerAlgorithm = %v, want %v", aws.StringValue(get.SSECustomerAlgorithm), s3.ServerSideEncryptionAes256)
+			}
+			// All drivers derive the same keys from the test's seed
+			other := newObjectOptions(&common.TestCaseConfiguration{Seed: 42, Encryption: tt.encryption})
+			if other.customerKey("object1") != *put.SSECustomerKey {
+				t.Errorf("SSE-C keys of the same seed differ")
+			}
+		})
+	}
+}
+
+func Test_objectOptions_nil(t *testing.T) {
+	var options *objectOptions
+	put := &s3.PutObjectInput{Key: aws.String("object1")}
+	options.applyToPutObject(put)
+	if put.ServerSideEncryption != nil || put.SSECustomerKey != nil {
+		t.Errorf("nil objectOptions changed the request: %v", put)
+	}
+}
+
+func Test_objectOptions_writeOptions(t *testing.T) {
+	testConfig := &common.TestCaseConfiguration{Seed: 42}
+	testConfig.WriteOptions = common.WriteOptionsConfiguration{
+		StorageClass:  "STANDARD_IA",
+		MetadataCount: 3,
+		MetadataSize:  100,
+		Tags:          map[string]string{"team": "storage", "purpose": "bench mark"},
+		ACL:           "bucket-owner-full-control",
+		ContentType:   "application/octet-stream",
+	}
+	options := newObjectOptions(testConfig)
+	put := &s3.PutObjectInput{Key: aws.String("object1")}
+	options.applyToPutObject(put)
+	upload := &s3manager.UploadInput{Key: aws.String("object1")}
+	options.applyToUpload(upload)
+
+	for _, got := range []struct {
+		storageClass, tagging, acl, contentType *string
+		metadata                                map[string]*string
+	}{
+		{put.StorageClass, put.Tagging, put.ACL, put.ContentType, put.Metadata},
+		{upload.StorageClass, upload.Tagging, upload.ACL, upload.ContentType, upload.Metadata},
+	} {
+		if aws.StringValue(got.storageClass) != "STANDARD_IA" {
+			t.Errorf("StorageClass = %v, want %v", aws.StringValue(got.storageClass), "STANDARD_IA")
+		}
+		if want := "purpose=bench+mark&team=storage"; aws.StringValue(got.tagging) != want {
+			t.Errorf("Tagging = %v, want %v", aws.StringValue(got.tagging), want)
+		}
+		if aws.StringValue(got.acl) != "bucket-owner-full-control" {
+			t.Errorf("ACL = %v, want %v", aws.StringValue(got.acl), "bucket-owner-full-control")
+		}
+		if aws.StringValue(got.contentType) != "application/octet-stream" {
+			t.Errorf("ContentType = %v, want %v", aws.StringValue(got.contentType), "application/octet-stream")
+		}
+		if len(got.metadata) != 3 {
+			t.Errorf("Metadata has %d headers, want %d", len(got.metadata), 3)
+		}
+		for key, value := range got.metadata {
+			if len(*value) != 100 {
+				t.Errorf("Metadata %s has %d bytes, want %d", key, len(*value), 100)
+			}
+		}
+	}
+
+	// Unset options do not send any headers
+	options = newObjectOptions(&common.TestCaseConfiguration{})
+	put = &s3.PutObjectInput{Key: aws.String("object1")}
+	options.applyToPutObject(put)
+	if put.StorageClass != nil || put.Tagging != nil || put.ACL != nil || put.ContentType != nil || put.Metadata != nil {
+		t.Errorf("Unset options changed the request: %v", put)
+	}
+}
+
+func Test_objectOptions_objectLock(t *testing.T) {
+	tests := []struct {
+		name          string
+		objectLock    common.ObjectLockConfiguration
+		wantMode      string
+		wantLegalHold string
+		wantMD5       bool
+	}{
+		{"No Object Lock", common.ObjectLockConfiguration{}, "", "", false},
+		{"Lock without retention", common.ObjectLockConfiguration{Enabled: true}, "", "", false},
+		{"Governance", common.ObjectLockConfiguration{Enabled: true, Mode: common.ObjectLockGovernance, Retention: common.Duration(time.Hour)}, s3.ObjectLockModeGovernance, "", true},
+		{"Compliance with legal hold", common.ObjectLockConfiguration{Enabled: true, Mode: common.ObjectLockCompliance, Retention: common.Duration(time.Hour), LegalHold: true},
+			s3.ObjectLockModeCompliance, s3.ObjectLockLegalHoldStatusOn, true},
+		{"Legal hold", common.ObjectLockConfiguration{Enabled: true, LegalHold: true}, "", s3.ObjectLockLegalHoldStatusOn, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := newObjectOptions(&common.TestCaseConfiguration{ObjectLock: tt.objectLock})
+			body := bytes.NewReader([]byte("locked"))
+			put := &s3.PutObjectInput{Key: aws.String("object1"), Body: body}
+			options.applyToPutObject(put)
+			create := &s3.CreateMultipartUploadInput{Key: aws.String("object1")}
+			options.applyToCreateMultipartUpload(create)
+
+			if aws.StringValue(put.ObjectLockMode) != tt.wantMode || aws.StringValue(create.ObjectLockMode) != tt.wantMode {
+				t.Errorf("ObjectLockMode = %v/%v, want %v", aws.StringValue(put.ObjectLockMode), aws.StringValue(create.ObjectLockMode), tt.wantMode)
+			}
+			if aws.StringValue(put.ObjectLockLegalHoldStatus) != tt.wantLegalHold || aws.StringValue(create.ObjectLockLegalHoldStatus) != tt.wantLegalHold {
+				t.Errorf("ObjectLockLegalHoldStatus = %v/%v, want %v", aws.StringValue(put.ObjectLockLegalHoldStatus), aws.StringValue(create.ObjectLockLegalHoldStatus), tt.wantLegalHold)
+			}
+			until := aws.TimeValue(put.ObjectLockRetainUntilDate)
+			if (tt.wantMode != "") != !until.IsZero() || (!until.IsZero() && time.Until(until) < 59*time.Minute) {
+				t.Errorf("ObjectLockRetainUntilDate = %v, want a retention of an hour: %v", until, tt.wantMode != "")
+			}
+			if want := "TO8vMKx9M0GdAMHZOgkAlQ=="; tt.wantMD5 != (aws.StringValue(put.ContentMD5) == want) {
+				t.Errorf("ContentMD5 = %v, want it: %v", aws.StringValue(put.ContentMD5), tt.wantMD5)
+			}
+			// The body is rewound after its MD5 was computed
+			if body.Len() != len("locked") {
+				t.Errorf("The body was not rewound - %d bytes left", body.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// opsBudget decides how many operations a driver may still send to its workers
+type opsBudget interface {
+	// take reserves a single operation and returns false when the budget is used up
+	take() bool
+}
+
+// localOpsBudget allows a fixed number of operations on this driver.
+// A max of 0 allows an unlimited number of operations.
+type localOpsBudget struct {
+	max  uint64
+	used uint64
+}
+
+func (b *localOpsBudget) take() bool {
+	if b.max != 0 && b.used >= b.max {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// leasedOpsBudget draws operations in leases from the global ops budget of
+// the server. The next lease is requested when half of the current lease is
+// used up, so that workers do not have to wait for the server.
+type leasedOpsBudget struct {
+	server  *serverConnection
+	leases  chan uint64
+	stopped <-chan struct{}
+
+	remaining uint64
+	lastLease uint64
+	requested bool
+	exhausted bool
+}
+
+func newLeasedOpsBudget(server *serverConnection, stopped <-chan struct{}) *leasedOpsBudget {
+	return &leasedOpsBudget{
+		server:  server,
+		leases:  make(chan uint64, 1),
+		stopped: stopped,
+	}
+}
+
+func (b *leasedOpsBudget) take() bool {
+	select {
+	case lease := <-b.leases:
+		b.receive(lease)
+	default:
+	}
+	if !b.exhausted && !b.requested && b.remaining <= b.lastLease/2 {
+		log.Trace("Requesting ops lease from server")
+		if err := b.server.send(common.DriverMessage{Message: "ops lease request"}); err != nil {
+			log.WithError(err).Error("Could not request ops lease from server")
+			return false
+		}
+		b.requested = true
+	}
+	if b.remaining == 0 {
+		if !b.requested {
+			return false
+		}
+		select {
+		case lease := <-b.leases:
+			b.receive(lease)
+		case <-b.stopped:
+			return false
+		}
+		if b.remaining == 0 {
+			return false
+		}
+	}
+	b.remaining--
+	return true
+}
+
+// receive adds a lease from the server to the budget
+func (b *leasedOpsBudget) receive(lease uint64) {
+	log.WithField("lease", lease).Trace("Got ops lease from server")
+	b.requested = false
+	b.remaining += lease
+	b.lastLease = lease
+	if lease == 0 {
+		b.exhausted = true
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_localOpsBudget_take(t *testing.T) {
+	budget := &localOpsBudget{max: 3}
+	for i := 0; i < 3; i++ {
+		if !budget.take() {
+			t.Fatalf("localOpsBudget.take() = false after %d operations, want true", i)
+		}
+	}
+	if budget.take() {
+		t.Errorf("localOpsBudget.take() = true after the budget is used up, want false")
+	}
+	unlimited := &localOpsBudget{}
+	for i := 0; i < 1000; i++ {
+		if !unlimited.take() {
+			t.Fatalf("localOpsBudget.take() without max = false, want true")
+		}
+	}
+}
+
+func Test_leasedOpsBudget_take(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	budget := newLeasedOpsBudget(&serverConnection{encoder: json.NewEncoder(writer)}, make(chan struct{}))
+
+	// Play the server: hand out 10 operations in leases of 4
+	go func() {
+		decoder := json.NewDecoder(reader)
+		remaining := uint64(10)
+		for {
+			var request common.DriverMessage
+			if err := decoder.Decode(&request); err != nil {
+				return
+			}
+			lease := uint64(4)
+			if lease > remaining {
+				lease = remaining
+			}
+			remaining -= lease
+			budget.leases <- lease
+		}
+	}()
+
+	taken := 0
+	for budget.take() {
+		taken++
+		if taken > 10 {
+			t.Fatalf("leasedOpsBudget.take() allowed more operations than leased")
+		}
+	}
+	if taken != 10 {
+		t.Errorf("leasedOpsBudget.take() allowed %d operations, want %d", taken, 10)
+	}
+}
+
+func Test_leasedOpsBudget_stopped(t *testing.T) {
+	var sent bytes.Buffer
+	stopped := make(chan struct{})
+	budget := newLeasedOpsBudget(&serverConnection{encoder: json.NewEncoder(&sent)}, stopped)
+	close(stopped)
+	if budget.take() {
+		t.Errorf("leasedOpsBudget.take() of stopped test = true, want false")
+	}
+}
@@ -31,32 +31,64 @@ var promFinishedOps = prom.NewCounterVec(
 		Name:      "finished_ops",
 		Namespace: "gosbench",
 		Help:      "Finished S3 operations",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promFailedOps = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "failed_ops",
 		Namespace: "gosbench",
-		Help:      "Failed S3 operations",
-	}, []string{"testName", "method"})
+		Help:      "Failed S3 operations by their error class - the S3 error code or e.g. connection_reset - and HTTP status",
+	}, []string{"testName", "method", "endpoint", "errorClass", "statusCode"})
+var promTimedOutOps = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name:      "timedout_ops",
+		Namespace: "gosbench",
+		Help:      "S3 operations that ran into the configured timeout",
+	}, []string{"testName", "method", "endpoint"})
+var promRetries = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name:      "retries",
+		Namespace: "gosbench",
+		Help:      "Retried S3 requests - these are hidden in the latency of the operations",
+	}, []string{"testName", "method", "endpoint"})
 var promLatency = prom.NewHistogramVec(
 	prom.HistogramOpts{
 		Name:      "ops_latency",
 		Namespace: "gosbench",
 		Help:      "Histogram latency of S3 operations",
 		Buckets:   prom.ExponentialBuckets(2, 2, 12),
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
+var promMultipartStepLatency = prom.NewHistogramVec(
+	prom.HistogramOpts{
+		Name:      "mpu_step_latency",
+		Namespace: "gosbench",
+		Help:      "Histogram latency of the single steps of explicit multipart uploads",
+		Buckets:   prom.ExponentialBuckets(2, 2, 12),
+	}, []string{"testName", "step", "endpoint"})
 var promUploadedBytes = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "uploaded_bytes",
 		Namespace: "gosbench",
 		Help:      "Uploaded bytes to S3 store",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
 var promDownloadedBytes = prom.NewCounterVec(
 	prom.CounterOpts{
 		Name:      "downloaded_bytes",
 		Namespace: "gosbench",
 		Help:      "Downloaded bytes from S3 store",
-	}, []string{"testName", "method"})
+	}, []string{"testName", "method", "endpoint"})
+var promCredentialRefreshLatency = prom.NewHistogramVec(
+	prom.HistogramOpts{
+		Name:      "credential_refresh_latency",
+		Namespace: "gosbench",
+		Help:      "Histogram latency of credential refreshes",
+		Buckets:   prom.ExponentialBuckets(2, 2, 12),
+	}, []string{"provider"})
+var promFailedCredentialRefreshes = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name:      "failed_credential_refreshes",
+		Namespace: "gosbench",
+		Help:      "Failed credential refreshes",
+	}, []string{"provider"})
 
 func init() {
 	// Then create the prometheus stat exporter
@@ -84,9 +116,24 @@ func init() {
 	if err = promRegistry.Register(promFailedOps); err != nil {
 		log.WithError(err).Error("Issues when adding failed_ops gauge to Prometheus registry")
 	}
+	if err = promRegistry.Register(promTimedOutOps); err != nil {
+		log.WithError(err).Error("Issues when adding timedout_ops gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promRetries); err != nil {
+		log.WithError(err).Error("Issues when adding retries gauge to Prometheus registry")
+	}
 	if err = promRegistry.Register(promLatency); err != nil {
 		log.WithError(err).Error("Issues when adding ops_latency gauge to Prometheus registry")
 	}
+	if err = promRegistry.Register(promMultipartStepLatency); err != nil {
+		log.WithError(err).Error("Issues when adding mpu_step_latency gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promCredentialRefreshLatency); err != nil {
+		log.WithError(err).Error("Issues when adding credential_refresh_latency gauge to Prometheus registry")
+	}
+	if err = promRegistry.Register(promFailedCredentialRefreshes); err != nil {
+		log.WithError(err).Error("Issues when adding failed_credential_refreshes gauge to Prometheus registry")
+	}
 	if err = promRegistry.Register(promUploadedBytes); err != nil {
 		log.WithError(err).Error("Issues when adding uploaded_bytes gauge to Prometheus registry")
 	}
@@ -119,13 +166,80 @@ func getCurrentPromValues(testConfig *common.TestCaseConfiguration) common.Bench
 	}
 	benchResult.Operations = sumCounterForTest(resultmap["gosbench_finished_ops"], testName)
 	benchResult.FailedOperations = sumCounterForTest(resultmap["gosbench_failed_ops"], testName)
-	benchResult.SuccessRatio = benchResult.Operations / (benchResult.Operations + benchResult.FailedOperations)
+	benchResult.TimedOutOperations = sumCounterForTest(resultmap["gosbench_timedout_ops"], testName)
+	benchResult.Retries = sumCounterForTest(resultmap["gosbench_retries"], testName)
+	benchResult.ErrorClasses = getErrorClasses(resultmap["gosbench_failed_ops"], testName)
+	if benchResult.TimedOutOperations != 0 {
+		benchResult.ErrorClasses[errorClassTimeout] = benchResult.TimedOutOperations
+	}
+	benchResult.SuccessRatio = benchResult.Operations / (benchResult.Operations + benchResult.FailedOperations + benchResult.TimedOutOperations)
 	benchResult.Bytes = sumCounterForTest(resultmap["gosbench_uploaded_bytes"], testName) + sumCounterForTest(resultmap["gosbench_downloaded_bytes"], testName)
-	benchResult.ObjectSize = benchResult.Bytes / (benchResult.Operations + benchResult.FailedOperations)
+	benchResult.ObjectSize = benchResult.Bytes / (benchResult.Operations + benchResult.FailedOperations + benchResult.TimedOutOperations)
 	benchResult.LatencyAvg = averageHistogramForTest(resultmap["gosbench_ops_latency"], testName)
+	benchResult.OperationResults = getOperationResults(testConfig, resultmap)
 	return benchResult
 }
 
+// getOperationResults breaks the gathered metrics of a test down per S3 method
+func getOperationResults(testConfig *common.TestCaseConfiguration, resultmap map[string][]*promModel.Metric) []common.OperationResult {
+	var operationResults []common.OperationResult
+	for _, method := range []struct{ name, operation string }{
+		{"GET", "read"},
+		{"PUT", "write"},
+		{"LIST", "list"},
+		{"DELETE", "delete"},
+	} {
+		operationResult := common.OperationResult{
+			Method:           method.name,
+			ObjectSizeMin:    testConfig.Objects.SizeMin,
+			ObjectSizeMax:    testConfig.Objects.SizeMax,
+			SizeDistribution: testConfig.Objects.SizeDistribution,
+		}
+		if sizes := testConfig.ObjectSizeOverride(method.operation); sizes != nil {
+			operationResult.ObjectSizeMin = sizes.SizeMin
+			operationResult.ObjectSizeMax = sizes.SizeMax
+			operationResult.SizeDistribution = sizes.SizeDistribution
+		}
+		operationResult.Operations = sumCounterForMethod(resultmap["gosbench_finished_ops"], testConfig.Name, method.name)
+		operationResult.FailedOperations = sumCounterForMethod(resultmap["gosbench_failed_ops"], testConfig.Name, method.name)
+		operationResult.TimedOutOperations = sumCounterForMethod(resultmap["gosbench_timedout_ops"], testConfig.Name, method.name)
+		operationResult.Retries = sumCounterForMethod(resultmap["gosbench_retries"], testConfig.Name, method.name)
+		if operationResult.Operations+operationResult.FailedOperations+operationResult.TimedOutOperations == 0 {
+			continue
+		}
+		operationResult.Bytes = sumCounterForMethod(resultmap["gosbench_uploaded_bytes"], testConfig.Name, method.name) + sumCounterForMethod(resultmap["gosbench_downloaded_bytes"], testConfig.Name, method.name)
+		operationResult.ObjectSize = operationResult.Bytes / (operationResult.Operations + operationResult.FailedOperations + operationResult.TimedOutOperations)
+		operationResult.LatencyAvg = averageHistogramForMethod(resultmap["gosbench_ops_latency"], testConfig.Name, method.name)
+		operationResults = append(operationResults, operationResult)
+	}
+	return operationResults
+}
+
+// getErrorClasses sums up the failed operations of a test per error class.
+// Classes with an HTTP status are named like SlowDown (503).
+func getErrorClasses(metrics []*promModel.Metric, testName string) map[string]float64 {
+	errorClasses := map[string]float64{}
+	for _, metric := range metrics {
+		if !hasLabels(metric, map[string]string{"testName": testName}) {
+			continue
+		}
+		var errorClass, statusCode string
+		for _, label := range metric.Label {
+			switch *label.Name {
+			case "errorClass":
+				errorClass = *label.Value
+			case "statusCode":
+				statusCode = *label.Value
+			}
+		}
+		if statusCode != "" {
+			errorClass = fmt.Sprintf("%s (%s)", errorClass, statusCode)
+		}
+		errorClasses[errorClass] += *metric.Counter.Value
+	}
+	return errorClasses
+}
+
 func sumCounterForTest(metrics []*promModel.Metric, testName string) float64 {
 	sum := float64(0)
 	for _, metric := range metrics {
@@ -138,6 +252,42 @@ func sumCounterForTest(metrics []*promModel.Metric, testName string) float64 {
 	return sum
 }
 
+// hasLabels checks whether the metric carries all the given label values
+func hasLabels(metric *promModel.Metric, labels map[string]string) bool {
+	found := 0
+	for _, label := range metric.Label {
+		if value, ok := labels[*label.Name]; ok {
+			if value != *label.Value {
+				return false
+			}
+			found++
+		}
+	}
+	return found == len(labels)
+}
+
+func sumCounterForMethod(metrics []*promModel.Metric, testName string, method string) float64 {
+	sum := float64(0)
+	for _, metric := range metrics {
+		if hasLabels(metric, map[string]string{"testName": testName, "method": method}) {
+			sum += *metric.Counter.Value
+		}
+	}
+	return sum
+}
+
+func averageHistogramForMethod(metrics []*promModel.Metric, testName string, method string) float64 {
+	sum := float64(0)
+	count := float64(0)
+	for _, metric := range metrics {
+		if hasLabels(metric, map[string]string{"testName": testName, "method": method}) {
+			sum += *metric.Histogram.SampleSum
+			count += float64(*metric.Histogram.SampleCount)
+		}
+	}
+	return sum / count
+}
+
 func averageHistogramForTest(metrics []*promModel.Metric, testName string) float64 {
 	sum := float64(0)
 	count := float64(0)
@@ -196,5 +346,28 @@ func getTestOptionString(testConfig *common.TestCaseConfiguration) string {
 	fmt.Fprintf(&options, "multipart_read_enabled=%t~", testConfig.Multipart.ReadMPUEnabled)
 	fmt.Fprintf(&options, "multipart_read_part_size=%d~", testConfig.Multipart.ReadPartSize)
 	fmt.Fprintf(&options, "multipart_read_unit=%s~", testConfig.Multipart.ReadUnit)
+	for _, operation := range []string{"read", "write", "list", "delete"} {
+		if sizes := testConfig.ObjectSizeOverride(operation); sizes != nil {
+			fmt.Fprintf(&options, "%s_object_size_min=%d~", operation, sizes.SizeMin)
+			fmt.Fprintf(&options, "%s_object_size_max=%d~", operation, sizes.SizeMax)
+			fmt.Fprintf(&options, "%s_object_size_distribution=%s~", operation, sizes.SizeDistribution)
+		}
+	}
+	if testConfig.Encryption.Type != "" {
+		fmt.Fprintf(&options, "encryption=%s~", testConfig.Encryption.Type)
+	}
+	if testConfig.WriteOptions.StorageClass != "" {
+		fmt.Fprintf(&options, "storage_class=%s~", testConfig.WriteOptions.StorageClass)
+	}
+	if testConfig.WriteOptions.MetadataCount != 0 {
+		fmt.Fprintf(&options, "metadata_count=%d~", testConfig.WriteOptions.MetadataCount)
+		fmt.Fprintf(&options, "metadata_size=%d~", testConfig.WriteOptions.MetadataSize)
+	}
+	if len(testConfig.WriteOptions.Tags) != 0 {
+		fmt.Fprintf(&options, "tags=%d~", len(testConfig.WriteOptions.Tags))
+	}
+	if testConfig.WriteOptions.ACL != "" {
+		fmt.Fprintf(&options, "acl=%s~", testConfig.WriteOptions.ACL)
+	}
 	return strings.TrimRight(options.String(), "~")
 }
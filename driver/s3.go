@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -53,103 +59,309 @@ func init() {
 
 // InitS3 initialises the S3 session
 // Also starts the Prometheus exporter on Port 8888
-func InitS3(config common.S3Configuration) {
+func InitS3(config common.S3Configuration, seed int64) {
 	// All clients require a Session. The Session provides the client with
 	// shared configuration such as region, endpoint, and credentials. A
 	// Session should be shared where possible to take advantage of
 	// configuration and credential caching. See the session package for
 	// more information.
 
-	var tr *http.Transport
-	if config.ProxyHost != "" {
-		proxyUrl, err := url.Parse(config.ProxyHost)
-		if err != nil {
-			log.WithError(err).Fatalf("Unable to configure proxy:")
-		}
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipSSLVerify},
-			Proxy:           http.ProxyURL(proxyUrl),
-			DialContext: (&net.Dialer{
-				KeepAlive: 15 * time.Second,
-				DualStack: true,
-				Timeout:   5 * time.Second,
-			}).DialContext,
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-		}
-	} else {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipSSLVerify},
-			DialContext: (&net.Dialer{
-				KeepAlive: 15 * time.Second,
-				DualStack: true,
-				Timeout:   5 * time.Second,
-			}).DialContext,
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-		}
+	tr, err := newHTTPTransport(config)
+	if err != nil {
+		log.WithError(err).Fatalf("Unable to configure the HTTP transport:")
+	}
+	balancer, err = newEndpointBalancer(config, seed)
+	if err != nil {
+		log.WithError(err).Fatalf("Unable to parse the S3 endpoints:")
 	}
 	tr2 := &ochttp.Transport{Base: tr}
 	hc = &http.Client{
 		Transport: tr2,
 	}
 
-	sess := session.Must(session.NewSession(&aws.Config{
-		HTTPClient: hc,
-		// TODO Also set the remaining S3 connection details...
-		Region:                            &config.Region,
-		Credentials:                       credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
-		Endpoint:                          &config.Endpoint,
-		S3ForcePathStyle:                  aws.Bool(true),
-		S3DisableContentMD5Validation:     aws.Bool(true),
-		DisableComputeChecksums:           aws.Bool(true),
-		S3Disable100Continue:              aws.Bool(true),
-		EC2MetadataDisableTimeoutOverride: aws.Bool(true),
-	}))
+	// The credentials are shared, so that they are only refreshed once
+	creds, err := newCredentials(config, &http.Client{Transport: tr})
+	if err != nil {
+		log.WithError(err).Fatalf("Unable to configure the credentials:")
+	}
+	sess := session.Must(session.NewSession(newAWSConfig(config, hc, creds)))
 	// Use this Session to do things that are hidden from the performance monitoring
-	housekeepingSess := session.Must(session.NewSession(&aws.Config{
-		HTTPClient: &http.Client{Transport: tr},
-		// TODO Also set the remaining S3 connection details...
-		Region:                            &config.Region,
-		Credentials:                       credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
-		Endpoint:                          &config.Endpoint,
-		S3ForcePathStyle:                  aws.Bool(true),
-		S3DisableContentMD5Validation:     aws.Bool(true),
-		DisableComputeChecksums:           aws.Bool(true),
-		S3Disable100Continue:              aws.Bool(true),
-		EC2MetadataDisableTimeoutOverride: aws.Bool(true),
-	}))
+	housekeepingSess := session.Must(session.NewSession(newAWSConfig(config, &http.Client{Transport: tr}, creds)))
 
 	// Create a new instance of the service's client with a Session.
 	// Optional aws.Config values can also be provided as variadic arguments
 	// to the New function. This option allows you to provide service
 	// specific configuration.
 	svc = s3.New(sess)
+	svc.Handlers.Complete.PushBackNamed(retryCounterHandler)
+	svc.Handlers.Build.PushFrontNamed(endpointHandler)
 	// Use this service to do things that are hidden from the performance monitoring
 	housekeepingSvc = s3.New(housekeepingSess)
+	putOptions := setPayloadSigning(config.PayloadSigning, svc, housekeepingSvc)
 
-	// TODO Create a context with a timeout - we already use this context in all S3 calls
-	// Usually this shouldn't be a problem ;)
+	// The timeout is applied to every single request instead of this context,
+	// so that each part of a multipart transfer gets its own deadline
 	ctx = context.Background()
+	if config.Timeout != 0 {
+		svc.Handlers.Build.PushFrontNamed(requestTimeoutHandler(time.Duration(config.Timeout)))
+		housekeepingSvc.Handlers.Build.PushFrontNamed(requestTimeoutHandler(time.Duration(config.Timeout)))
+	}
+	backend = &s3Backend{service: svc, putOptions: putOptions}
+	housekeepingBackend = &s3Backend{service: housekeepingSvc, putOptions: putOptions}
 	log.Debug("S3 Init done")
 }
 
-func putObject(service *s3.S3, objectName string, objectContent io.ReadSeeker, bucket string, objectSize int64) error {
+// newHTTPTransport returns the HTTP transport for the given S3 endpoint
+func newHTTPTransport(config common.S3Configuration) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		KeepAlive: time.Duration(config.TCPKeepAlive),
+		Timeout:   time.Duration(config.DialTimeout),
+	}
+	tr := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConns,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     time.Duration(config.IdleConnTimeout),
+		TLSHandshakeTimeout: time.Duration(config.TLSHandshakeTimeout),
+		ReadBufferSize:      int(config.ReadBufferSize),
+		WriteBufferSize:     int(config.WriteBufferSize),
+		DisableKeepAlives:   config.DisableKeepAlives,
+		// A custom TLS config and dialer disable HTTP/2 unless it is forced
+		ForceAttemptHTTP2: config.HTTP2,
+	}
+	// Dual-stack dialing tries IPv6 and IPv4 addresses of the endpoint - the others
+	// restrict the connections to a single address family
+	if network, ok := ipFamilyNetworks[config.IPFamily]; ok {
+		tr.DialContext = func(ctx context.Context, _ string, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+	if config.ProxyHost != "" {
+		proxyURL, err := url.Parse(config.ProxyHost)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to configure proxy: %v", err)
+		}
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+	return tr, nil
+}
+
+// ipFamilyNetworks are the dialer networks of the single address families
+var ipFamilyNetworks = map[string]string{
+	common.IPFamilyIPv4: "tcp4",
+	common.IPFamilyIPv6: "tcp6",
+}
+
+// newTLSConfig returns the TLS configuration for the given S3 endpoint
+func newTLSConfig(config common.S3Configuration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.SkipSSLVerify,
+		ServerName:         config.TLSServerName,
+	}
+	var err error
+	if tlsConfig.MinVersion, err = common.ParseTLSVersion(config.MinTLSVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.CipherSuites, err = common.ParseCipherSuites(config.CipherSuites); err != nil {
+		return nil, err
+	}
+	if config.CACertFile != "" {
+		caCerts, err := ioutil.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read ca_cert_file: %v", err)
+		}
+		tlsConfig.RootCAs, err = x509.SystemCertPool()
+		if err != nil {
+			log.WithError(err).Warn("Unable to load the system CA certificates - only using the ca_cert_file")
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("No PEM encoded certificates found in ca_cert_file %s", config.CACertFile)
+		}
+	}
+	if config.ClientCertFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
+
+// newAWSConfig returns the SDK configuration of a session for the given S3 endpoint
+func newAWSConfig(config common.S3Configuration, httpClient *http.Client, creds *credentials.Credentials) *aws.Config {
+	return &aws.Config{
+		HTTPClient:                        httpClient,
+		Region:                            &config.Region,
+		Credentials:                       creds,
+		Endpoint:                          aws.String(s3Endpoints(config)[0]),
+		Retryer:                           newRetryer(config),
+		S3ForcePathStyle:                  aws.Bool(config.AddressingStyle != common.AddressingStyleVirtual),
+		S3DisableContentMD5Validation:     aws.Bool(!config.ValidateChecksums),
+		DisableComputeChecksums:           aws.Bool(!config.ValidateChecksums),
+		S3Disable100Continue:              aws.Bool(!config.Use100Continue),
+		EC2MetadataDisableTimeoutOverride: aws.Bool(true),
+	}
+}
+
+// unsignedPayloadSignHandler replaces the default S3 signer, so that
+// the payload is sent as UNSIGNED-PAYLOAD instead of hashing it
+var unsignedPayloadSignHandler = v4.BuildNamedHandler(v4.SignRequestHandler.Name, func(s *v4.Signer) {
+	s.DisableURIPathEscaping = true
+}, v4.WithUnsignedPayload)
+
+// setPayloadSigning sets up the payload signing of the clients and returns the
+// options of their single-part PutObject requests
+func setPayloadSigning(mode string, services ...*s3.S3) []request.Option {
+	switch mode {
+	case common.PayloadSigningUnsigned:
+		for _, service := range services {
+			service.Handlers.Sign.Swap(v4.SignRequestHandler.Name, unsignedPayloadSignHandler)
+		}
+	case common.PayloadSigningUnsignedPut:
+		return []request.Option{withUnsignedPayload}
+	}
+	return nil
+}
+
+// withUnsignedPayload sends a single request with UNSIGNED-PAYLOAD
+func withUnsignedPayload(r *request.Request) {
+	r.Handlers.Sign.Swap(v4.SignRequestHandler.Name, unsignedPayloadSignHandler)
+}
+
+// requestTimeoutHandler returns a handler that limits the duration of every request
+// of a client - including its retries - to the given timeout
+func requestTimeoutHandler(timeout time.Duration) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "gosbench.RequestTimeoutHandler",
+		Fn: func(r *request.Request) {
+			timeoutCtx, cancel := context.WithTimeout(r.Context(), timeout)
+			r.SetContext(timeoutCtx)
+			r.Handlers.Complete.PushBack(func(*request.Request) {
+				cancel()
+			})
+		},
+	}
+}
+
+// newRetryer returns the retryer for the configured retry policy.
+// Without any retry settings the SDK's default retryer is used.
+func newRetryer(config common.S3Configuration) request.Retryer {
+	if config.MaxRetries == nil && config.RetryMinDelay == 0 && config.RetryMaxDelay == 0 &&
+		config.RetryMinThrottleDelay == 0 && config.RetryMaxThrottleDelay == 0 {
+		return nil
+	}
+	retryer := client.DefaultRetryer{
+		NumMaxRetries:    client.DefaultRetryerMaxNumRetries,
+		MinRetryDelay:    time.Duration(config.RetryMinDelay),
+		MaxRetryDelay:    time.Duration(config.RetryMaxDelay),
+		MinThrottleDelay: time.Duration(config.RetryMinThrottleDelay),
+		MaxThrottleDelay: time.Duration(config.RetryMaxThrottleDelay),
+	}
+	if config.MaxRetries != nil {
+		retryer.NumMaxRetries = *config.MaxRetries
+	}
+	return retryer
+}
+
+// retryCounterKey is the context key of the retry counter of an operation
+type retryCounterKey struct{}
+
+// withRetryCounter returns a context that counts the retries of all
+// requests that are sent with it - e.g. all parts of a multipart upload
+func withRetryCounter(parent context.Context) (context.Context, *uint64) {
+	counter := new(uint64)
+	return context.WithValue(parent, retryCounterKey{}, counter), counter
+}
+
+// retryCounterHandler adds the retries of a finished request to the
+// retry counter of its context
+var retryCounterHandler = request.NamedHandler{
+	Name: "gosbench.RetryCounterHandler",
+	Fn: func(r *request.Request) {
+		if counter, ok := r.Context().Value(retryCounterKey{}).(*uint64); ok {
+			atomic.AddUint64(counter, uint64(r.RetryCount))
+		}
+	},
+}
+
+// Error classes of failed operations that are not described by an S3 error code
+const (
+	errorClassTimeout           = "timeout"
+	errorClassConnectionReset   = "connection_reset"
+	errorClassConnectionRefused = "connection_refused"
+	errorClassDNS               = "dns"
+	errorClassOther             = "other"
+)
+
+// unwrapError returns the error that caused the given one - also for SDK errors
+func unwrapError(err error) error {
+	if e, ok := err.(awserr.Error); ok {
+		return e.OrigErr()
+	}
+	return errors.Unwrap(err)
+}
+
+// isTimeout checks whether the error was caused by a request running into its timeout
+func isTimeout(err error) bool {
+	for ; err != nil; err = unwrapError(err) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError returns the class of a failed operation together with the HTTP
+// status code of the failed request - if the request got a response at all.
+// The class is the S3 error code, e.g. SlowDown or NoSuchKey, for requests
+// that got an error response and one of the errorClass constants otherwise.
+func classifyError(err error) (string, int) {
+	if isTimeout(err) {
+		return errorClassTimeout, 0
+	}
+	for ; err != nil; err = unwrapError(err) {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() != 0 {
+			if reqErr.Code() == "" {
+				return http.StatusText(reqErr.StatusCode()), reqErr.StatusCode()
+			}
+			return reqErr.Code(), reqErr.StatusCode()
+		}
+		if _, ok := err.(*net.DNSError); ok {
+			return errorClassDNS, 0
+		}
+		if errno, ok := err.(syscall.Errno); ok {
+			switch errno {
+			case syscall.ECONNRESET, syscall.EPIPE:
+				return errorClassConnectionReset, 0
+			case syscall.ECONNREFUSED:
+				return errorClassConnectionRefused, 0
+			}
+		}
+	}
+	return errorClassOther, 0
+}
+
+func putObject(ctx context.Context, service *s3.S3, objectName string, objectContent io.ReadSeeker, bucket string, objectSize int64, options *objectOptions, requestOptions ...request.Option) error {
 	input := &s3.PutObjectInput{
 		Bucket:        &bucket,
 		Key:           &objectName,
 		Body:          objectContent,
 		ContentLength: &objectSize,
 	}
+	options.applyToPutObject(input)
 
-	req, _ := service.PutObjectRequest(input)
-	req.Handlers.Sign.Remove(v4.SignRequestHandler)
-	handler := v4.BuildNamedHandler("v4.CustomSignerHandler", v4.WithUnsignedPayload)
-	req.Handlers.Sign.PushFrontNamed(handler)
-
-	err := req.Send()
-
-	//_, err := service.PutObject(input)
+	_, err := service.PutObjectWithContext(ctx, input, requestOptions...)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == request.CanceledErrorCode {
 			// If the SDK can determine the request or retry delay was canceled
@@ -193,15 +405,18 @@ func putObject(service *s3.S3, objectName string, objectContent io.ReadSeeker, b
 // 	return err
 // }
 
-func putObjectMPU(service *s3.S3, objectName string, objectContent io.ReadSeeker, bucket string, partSize uint64, concurrency int) error {
+func putObjectMPU(ctx context.Context, service *s3.S3, objectName string, objectContent io.ReadSeeker, bucket string, partSize uint64, concurrency int, options *objectOptions) error {
 	// Create an uploader with S3 client and custom options
 	uploader := s3manager.NewUploaderWithClient(service)
+	options.applyToUploader(uploader)
 
-	_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Bucket: &bucket,
 		Key:    &objectName,
 		Body:   objectContent,
-	}, func(d *s3manager.Uploader) {
+	}
+	options.applyToUpload(input)
+	_, err := uploader.UploadWithContext(ctx, input, func(d *s3manager.Uploader) {
 		d.PartSize = int64(partSize)
 		d.Concurrency = concurrency
 	})
@@ -243,8 +458,8 @@ func putObjectMPU(service *s3.S3, objectName string, objectContent io.ReadSeeker
 // 	log.Debugf("Object Properties:\n%+v", result)
 // }
 
-func listObjects(service *s3.S3, prefix string, bucket string) (*s3.ListObjectsOutput, error) {
-	result, err := service.ListObjects(&s3.ListObjectsInput{
+func listObjects(ctx context.Context, service *s3.S3, prefix string, bucket string) (*s3.ListObjectsOutput, error) {
+	result, err := service.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 		Bucket: &bucket,
 		Prefix: &prefix,
 	})
@@ -258,21 +473,27 @@ func listObjects(service *s3.S3, prefix string, bucket string) (*s3.ListObjectsO
 	return result, err
 }
 
-func getObject(service *s3.S3, objectName string, bucket string, partSize uint64, concurrency int) error {
+// getObject downloads the given version of an object - the latest one if the version ID is empty
+func getObject(ctx context.Context, service *s3.S3, objectName string, versionID string, bucket string, partSize uint64, concurrency int, options *objectOptions) error {
 	// Create a downloader with the session and custom options
 	downloader := s3manager.NewDownloaderWithClient(service)
 	buf := aws.NewWriteAtBuffer([]byte{})
-	_, err := downloader.DownloadWithContext(ctx, buf, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &objectName,
-	}, func(d *s3manager.Downloader) {
+	}
+	if versionID != "" {
+		input.VersionId = &versionID
+	}
+	options.applyToGetObject(input)
+	_, err := downloader.DownloadWithContext(ctx, buf, input, func(d *s3manager.Downloader) {
 		d.PartSize = int64(partSize)
 		d.Concurrency = concurrency
 	})
 	return err
 }
 
-func deleteObject(service *s3.S3, objectName string, bucket string) error {
+func deleteObject(ctx context.Context, service *s3.S3, objectName string, bucket string) error {
 	_, err := service.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
 		Bucket: &bucket,
 		Delete: &s3.Delete{
@@ -289,34 +510,288 @@ func deleteObject(service *s3.S3, objectName string, bucket string) error {
 	return err
 }
 
-func createBucket(service *s3.S3, bucket string) error {
-	// TODO do not err when the bucket is already there...
-	_, err := service.CreateBucket(&s3.CreateBucketInput{
-		Bucket: &bucket,
+// deleteObjectVersion removes a single version of an object for good - or a delete marker
+func deleteObjectVersion(ctx context.Context, service *s3.S3, objectName string, versionID string, bucket string) error {
+	_, err := service.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    &bucket,
+		Key:       &objectName,
+		VersionId: &versionID,
 	})
 	if err != nil {
-		aerr, _ := err.(awserr.Error)
+		log.WithError(err).WithField("object", objectName).WithField("version", versionID).WithField("bucket", bucket).Errorf("Failed to delete object version,")
+	}
+	return err
+}
+
+// createBucket creates a bucket - a bucket that is already there is no error
+func createBucket(ctx context.Context, service *s3.S3, bucket string, objectLock bool) error {
+	input := &s3.CreateBucketInput{
+		Bucket: &bucket,
+	}
+	if objectLock {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+	_, err := service.CreateBucketWithContext(ctx, input)
+	if err != nil {
 		// Ignore error if bucket already exists
-		if aerr.Code() == s3.ErrCodeBucketAlreadyExists {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeBucketAlreadyExists || aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou) {
 			return nil
 		}
-		log.WithField("Message", aerr.Message()).WithField("Code", aerr.Code()).Info("Issues when creating bucket")
+		log.WithError(err).WithField("bucket", bucket).Info("Issues when creating bucket")
 	}
 	return err
 }
 
-func deleteBucket(service *s3.S3, bucket string) error {
-	// First delete all objects in the bucket
-	iter := s3manager.NewDeleteListIterator(service, &s3.ListObjectsInput{
+func enableVersioning(ctx context.Context, service *s3.S3, bucket string) error {
+	_, err := service.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
 		Bucket: &bucket,
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
 	})
+	if err != nil {
+		log.WithError(err).WithField("bucket", bucket).Error("Failed to enable versioning")
+	}
+	return err
+}
 
-	if err := s3manager.NewBatchDeleteWithClient(service).Delete(aws.BackgroundContext(), iter); err != nil {
+func deleteBucket(ctx context.Context, service *s3.S3, bucket string, bypassLock bool) error {
+	// First delete all objects in the bucket - with all their versions and delete
+	// markers, as versioned buckets could not be deleted otherwise.
+	// Unversioned objects are listed as null versions.
+	var deleteErr error
+	err := service.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+	}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		var objects []*s3.ObjectIdentifier
+		for _, version := range page.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		deleteErr = deleteObjectIdentifiers(ctx, service, bucket, objects, bypassLock)
+		return deleteErr == nil
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	if err != nil {
 		return err
 	}
 	// Then delete the (now empty) bucket itself
-	_, err := service.DeleteBucket(&s3.DeleteBucketInput{
+	_, err = service.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: &bucket,
+	})
+	return err
+}
+
+// deleteObjectIdentifiers deletes up to 1000 objects with a single request.
+// Objects that could not be deleted do not fail the request, so the errors
+// of the response are returned instead. With bypassLock the governance
+// retention is bypassed and the versions that are denied because of a legal
+// hold are released and deleted one by one.
+func deleteObjectIdentifiers(ctx context.Context, service *s3.S3, bucket string, objects []*s3.ObjectIdentifier, bypassLock bool) error {
+	input := &s3.DeleteObjectsInput{
 		Bucket: &bucket,
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	}
+	if bypassLock {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	result, err := service.DeleteObjectsWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	var failed []*s3.Error
+	for _, objectErr := range result.Errors {
+		if bypassLock && aws.StringValue(objectErr.Code) == "AccessDenied" &&
+			releaseObjectVersion(ctx, service, bucket, objectErr.Key, objectErr.VersionId) == nil {
+			continue
+		}
+		failed = append(failed, objectErr)
+	}
+	if len(failed) > 0 {
+		return awserr.New(aws.StringValue(failed[0].Code), fmt.Sprintf("%d objects could not be deleted, e.g. %s: %s",
+			len(failed), aws.StringValue(failed[0].Key), aws.StringValue(failed[0].Message)), nil)
+	}
+	return nil
+}
+
+// releaseObjectVersion removes the legal hold of a version and deletes it -
+// bypassing its governance retention. Compliance retention can not be bypassed.
+func releaseObjectVersion(ctx context.Context, service *s3.S3, bucket string, objectName *string, versionID *string) error {
+	_, err := service.PutObjectLegalHoldWithContext(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    &bucket,
+		Key:       objectName,
+		VersionId: versionID,
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOff)},
 	})
+	if err == nil {
+		_, err = service.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket:                    &bucket,
+			Key:                       objectName,
+			VersionId:                 versionID,
+			BypassGovernanceRetention: aws.Bool(true),
+		})
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", aws.StringValue(objectName)).WithField("version", aws.StringValue(versionID)).WithField("bucket", bucket).Debug("Failed to release locked object version")
+	}
 	return err
 }
+
+// s3Backend is the Backend of an S3 client
+type s3Backend struct {
+	service *s3.S3
+	// putOptions are applied to the single-part PutObject requests
+	putOptions []request.Option
+}
+
+// Put uploads an object - in multiple parts if the transfer is a multipart one
+func (b *s3Backend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	if transfer.Multipart && transfer.Explicit {
+		return putObjectExplicitMPU(ctx, b.service, objectName, content, bucket, size, transfer, options)
+	}
+	if transfer.Multipart {
+		return putObjectMPU(ctx, b.service, objectName, content, bucket, transfer.PartSize, transfer.Concurrency, options)
+	}
+	return putObject(ctx, b.service, objectName, content, bucket, size, options, b.putOptions...)
+}
+
+// Get downloads an object with ranged GETs of the transfer's part size
+func (b *s3Backend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	return getObject(ctx, b.service, objectName, "", bucket, transfer.PartSize, transfer.Concurrency, options)
+}
+
+// List returns the objects of a bucket with the given prefix
+func (b *s3Backend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	result, err := listObjects(ctx, b.service, prefix, bucket)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, len(result.Contents))
+	for i, object := range result.Contents {
+		objects[i] = ObjectInfo{Key: aws.StringValue(object.Key), Size: aws.Int64Value(object.Size)}
+	}
+	return objects, nil
+}
+
+// Delete removes an object
+func (b *s3Backend) Delete(ctx context.Context, bucket string, objectName string) error {
+	return deleteObject(ctx, b.service, objectName, bucket)
+}
+
+// Head returns the properties of an object
+func (b *s3Backend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	result, err := b.service.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &objectName,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: objectName, Size: aws.Int64Value(result.ContentLength)}, nil
+}
+
+// CreateBucket creates a bucket
+func (b *s3Backend) CreateBucket(ctx context.Context, bucket string) error {
+	return createBucket(ctx, b.service, bucket, false)
+}
+
+// DeleteBucket removes a bucket together with all its objects
+func (b *s3Backend) DeleteBucket(ctx context.Context, bucket string) error {
+	return deleteBucket(ctx, b.service, bucket, false)
+}
+
+// CreateLockedBucket creates a bucket with Object Lock enabled
+func (b *s3Backend) CreateLockedBucket(ctx context.Context, bucket string) error {
+	return createBucket(ctx, b.service, bucket, true)
+}
+
+// DeleteLockedBucket removes a bucket together with all its objects - even the
+// ones under governance retention or legal hold
+func (b *s3Backend) DeleteLockedBucket(ctx context.Context, bucket string) error {
+	return deleteBucket(ctx, b.service, bucket, true)
+}
+
+// EnableVersioning turns on the versioning of a bucket
+func (b *s3Backend) EnableVersioning(ctx context.Context, bucket string) error {
+	return enableVersioning(ctx, b.service, bucket)
+}
+
+// GetVersion downloads a single version of an object like Get does
+func (b *s3Backend) GetVersion(ctx context.Context, bucket string, objectName string, versionID string, transfer TransferOptions, options *objectOptions) error {
+	return getObject(ctx, b.service, objectName, versionID, bucket, transfer.PartSize, transfer.Concurrency, options)
+}
+
+// DeleteVersion removes a single version of an object
+func (b *s3Backend) DeleteVersion(ctx context.Context, bucket string, objectName string, versionID string) error {
+	return deleteObjectVersion(ctx, b.service, objectName, versionID, bucket)
+}
+
+// ListVersions returns the versions and delete markers with the given prefix
+func (b *s3Backend) ListVersions(ctx context.Context, bucket string, prefix string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	err := b.service.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		versions = append(versions, objectVersionsOf(page)...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// ListVersionsOf returns the versions and delete markers of a single object.
+// The object is the first key that starts with its name, so the listing
+// stops at the first page that reaches another key.
+func (b *s3Backend) ListVersionsOf(ctx context.Context, bucket string, objectName string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	err := b.service.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+		Prefix: &objectName,
+	}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		otherKey := false
+		for _, version := range objectVersionsOf(page) {
+			if version.Key == objectName {
+				versions = append(versions, version)
+			} else {
+				otherKey = true
+			}
+		}
+		return !otherKey
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// objectVersionsOf returns the versions and then the delete markers of a listing page
+func objectVersionsOf(page *s3.ListObjectVersionsOutput) []ObjectVersion {
+	versions := make([]ObjectVersion, 0, len(page.Versions)+len(page.DeleteMarkers))
+	for _, version := range page.Versions {
+		versions = append(versions, ObjectVersion{
+			Key:       aws.StringValue(version.Key),
+			VersionID: aws.StringValue(version.VersionId),
+			Size:      aws.Int64Value(version.Size),
+			IsLatest:  aws.BoolValue(version.IsLatest),
+		})
+	}
+	for _, marker := range page.DeleteMarkers {
+		versions = append(versions, ObjectVersion{
+			Key:          aws.StringValue(marker.Key),
+			VersionID:    aws.StringValue(marker.VersionId),
+			DeleteMarker: true,
+			IsLatest:     aws.BoolValue(marker.IsLatest),
+		})
+	}
+	return versions
+}
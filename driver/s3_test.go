@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulbc/gosbench/common"
+	"github.com/mulbc/gosbench/s3stub"
+)
+
+type fakeNetError struct {
+	timeout bool
+}
+
+func (e fakeNetError) Error() string   { return "fake net error" }
+func (e fakeNetError) Timeout() bool   { return e.timeout }
+func (e fakeNetError) Temporary() bool { return false }
+
+func Test_isTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("boom"), false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"wrapped deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"aws canceled", awserr.New(request.CanceledErrorCode, "canceled", context.DeadlineExceeded), true},
+		{"aws other", awserr.New("NoSuchKey", "not found", nil), false},
+		{"net timeout", awserr.New(request.ErrCodeRequestError, "send request failed", fakeNetError{timeout: true}), true},
+		{"net error", awserr.New(request.ErrCodeRequestError, "send request failed", fakeNetError{}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTimeout(tt.err); got != tt.want {
+				t.Errorf("isTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newRetryer(t *testing.T) {
+	noRetries := 0
+	fiveRetries := 5
+	tests := []struct {
+		name   string
+		config common.S3Configuration
+		want   request.Retryer
+	}{
+		{"SDK default", common.S3Configuration{}, nil},
+		{"No retries", common.S3Configuration{MaxRetries: &noRetries}, client.DefaultRetryer{}},
+		{"Five retries", common.S3Configuration{MaxRetries: &fiveRetries}, client.DefaultRetryer{NumMaxRetries: 5}},
+		{"Only delays", common.S3Configuration{RetryMinDelay: common.Duration(time.Second), RetryMaxThrottleDelay: common.Duration(time.Minute)},
+			client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries, MinRetryDelay: time.Second, MaxThrottleDelay: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRetryer(tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newRetryer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retryCounterHandler(t *testing.T) {
+	opCtx, retries := withRetryCounter(context.Background())
+	for _, retryCount := range []int{2, 0, 1} {
+		r := &request.Request{RetryCount: retryCount, HTTPRequest: &http.Request{}}
+		r.SetContext(opCtx)
+		retryCounterHandler.Fn(r)
+	}
+	// Requests without a counter in their context are ignored
+	r := &request.Request{RetryCount: 5, HTTPRequest: &http.Request{}}
+	r.SetContext(context.Background())
+	retryCounterHandler.Fn(r)
+	if *retries != 3 {
+		t.Errorf("retryCounterHandler counted %v retries, want %v", *retries, 3)
+	}
+}
+
+func Test_classifyError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantClass      string
+		wantStatusCode int
+	}{
+		{"throttled", awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "id"), "SlowDown", 503},
+		{"missing key", awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "", nil), 404, "id"), s3.ErrCodeNoSuchKey, 404},
+		{"multipart part failed", awserr.New("MultipartUpload", "upload multipart failed",
+			awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id")), "InternalError", 500},
+		{"status without code", awserr.NewRequestFailure(awserr.New("", "", nil), 502, "id"), "Bad Gateway", 502},
+		{"timeout", awserr.New(request.CanceledErrorCode, "canceled", context.DeadlineExceeded), errorClassTimeout, 0},
+		{"connection reset", awserr.New(request.ErrCodeRequestError, "send request failed",
+			&url.Error{Op: "Put", URL: "http://s3", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}), errorClassConnectionReset, 0},
+		{"connection refused", awserr.New(request.ErrCodeRequestError, "send request failed",
+			&url.Error{Op: "Put", URL: "http://s3", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}), errorClassConnectionRefused, 0},
+		{"dns", awserr.New(request.ErrCodeRequestError, "send request failed",
+			&url.Error{Op: "Put", URL: "http://s3", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "s3"}}}), errorClassDNS, 0},
+		{"unknown", errors.New("boom"), errorClassOther, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotClass, gotStatusCode := classifyError(tt.err)
+			if gotClass != tt.wantClass || gotStatusCode != tt.wantStatusCode {
+				t.Errorf("classifyError() = %v, %v, want %v, %v", gotClass, gotStatusCode, tt.wantClass, tt.wantStatusCode)
+			}
+		})
+	}
+}
+
+func Test_newAWSConfig(t *testing.T) {
+	tests := []struct {
+		name              string
+		config            common.S3Configuration
+		wantPathStyle     bool
+		wantNo100Continue bool
+		wantNoChecksums   bool
+	}{
+		{"Defaults", common.S3Configuration{AddressingStyle: common.AddressingStylePath}, true, true, true},
+		{"Virtual-hosted-style", common.S3Configuration{AddressingStyle: common.AddressingStyleVirtual}, false, true, true},
+		{"All options", common.S3Configuration{Use100Continue: true, ValidateChecksums: true}, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newAWSConfig(tt.config, http.DefaultClient, credentials.AnonymousCredentials)
+			if *got.S3ForcePathStyle != tt.wantPathStyle {
+				t.Errorf("newAWSConfig() S3ForcePathStyle = %v, want %v", *got.S3ForcePathStyle, tt.wantPathStyle)
+			}
+			if *got.S3Disable100Continue != tt.wantNo100Continue {
+				t.Errorf("newAWSConfig() S3Disable100Continue = %v, want %v", *got.S3Disable100Continue, tt.wantNo100Continue)
+			}
+			if *got.S3DisableContentMD5Validation != tt.wantNoChecksums || *got.DisableComputeChecksums != tt.wantNoChecksums {
+				t.Errorf("newAWSConfig() checksums disabled = %v/%v, want %v", *got.S3DisableContentMD5Validation, *got.DisableComputeChecksums, tt.wantNoChecksums)
+			}
+		})
+	}
+}
+
+func Test_unsignedPayloadSignHandler(t *testing.T) {
+	config := common.S3Configuration{Region: "us-east-1", Endpoint: "http://localhost:9000", AccessKey: "a", SecretKey: "b"}
+	tests := []struct {
+		name     string
+		unsigned bool
+		want     string
+	}{
+		{"Signed payload", false, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+		{"Unsigned payload", true, "UNSIGNED-PAYLOAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := s3.New(session.Must(session.NewSession(newAWSConfig(config, http.DefaultClient, credentials.NewStaticCredentials("access", "secret", "")))))
+			if tt.unsigned {
+				service.Handlers.Sign.Swap(v4.SignRequestHandler.Name, unsignedPayloadSignHandler)
+			}
+			req, _ := service.PutObjectRequest(&s3.PutObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("object"),
+				Body:   bytes.NewReader([]byte("foo")),
+			})
+			if err := req.Sign(); err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if got := req.HTTPRequest.Header.Get("X-Amz-Content-Sha256"); got != tt.want {
+				t.Errorf("X-Amz-Content-Sha256 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newHTTPTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.S3Configuration
+		wantErr bool
+	}{
+		{"Defaults", common.S3Configuration{MaxIdleConns: 100}, false},
+		{"Tuned", common.S3Configuration{MaxIdleConns: 500, MaxConnsPerHost: 500, IdleConnTimeout: common.Duration(time.Minute),
+			TLSHandshakeTimeout: common.Duration(time.Second), ReadBufferSize: 65536, WriteBufferSize: 65536, DisableKeepAlives: true, HTTP2: true}, false},
+		{"Proxy", common.S3Configuration{ProxyHost: "http://localhost:1234"}, false},
+		{"Invalid proxy", common.S3Configuration{ProxyHost: "://localhost"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newHTTPTransport(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newHTTPTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.MaxIdleConnsPerHost != tt.config.MaxIdleConns || got.MaxConnsPerHost != tt.config.MaxConnsPerHost ||
+				got.IdleConnTimeout != time.Duration(tt.config.IdleConnTimeout) || got.TLSHandshakeTimeout != time.Duration(tt.config.TLSHandshakeTimeout) ||
+				got.ReadBufferSize != int(tt.config.ReadBufferSize) || got.WriteBufferSize != int(tt.config.WriteBufferSize) ||
+				got.DisableKeepAlives != tt.config.DisableKeepAlives || got.ForceAttemptHTTP2 != tt.config.HTTP2 {
+				t.Errorf("newHTTPTransport() = %+v, want the settings of %+v", got, tt.config)
+			}
+			if (got.Proxy != nil) != (tt.config.ProxyHost != "") {
+				t.Errorf("newHTTPTransport() proxy set = %v, want %v", got.Proxy != nil, tt.config.ProxyHost != "")
+			}
+		})
+	}
+}
+
+func Test_newHTTPTransportIPFamily(t *testing.T) {
+	// The test server only listens on the IPv4 loopback address
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tests := []struct {
+		family  string
+		wantErr bool
+	}{
+		{common.IPFamilyDualStack, false},
+		{common.IPFamilyIPv4, false},
+		{common.IPFamilyIPv6, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			tr, err := newHTTPTransport(common.S3Configuration{IPFamily: tt.family, DialTimeout: common.Duration(time.Second)})
+			if err != nil {
+				t.Fatalf("newHTTPTransport() error = %v", err)
+			}
+			defer tr.CloseIdleConnections()
+			resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET via %s error = %v, wantErr %v", tt.family, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gosbench"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	cert, err := x509.CreateCertificate(crand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func Test_newTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	noPEMFile := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(noPEMFile, []byte("no certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		config  common.S3Configuration
+		wantErr bool
+	}{
+		{"Defaults", common.S3Configuration{}, false},
+		{"All options", common.S3Configuration{CACertFile: certFile, ClientCertFile: certFile, ClientKeyFile: keyFile,
+			MinTLSVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, TLSServerName: "s3.internal"}, false},
+		{"Missing CA file", common.S3Configuration{CACertFile: filepath.Join(dir, "missing.pem")}, true},
+		{"CA file without certificates", common.S3Configuration{CACertFile: noPEMFile}, true},
+		{"Client key mismatch", common.S3Configuration{ClientCertFile: certFile, ClientKeyFile: certFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.ServerName != tt.config.TLSServerName {
+				t.Errorf("newTLSConfig() ServerName = %v, want %v", got.ServerName, tt.config.TLSServerName)
+			}
+			if (got.RootCAs != nil) != (tt.config.CACertFile != "") {
+				t.Errorf("newTLSConfig() RootCAs set = %v, want %v", got.RootCAs != nil, tt.config.CACertFile != "")
+			}
+			if len(got.Certificates) != 0 != (tt.config.ClientCertFile != "") {
+				t.Errorf("newTLSConfig() got %d client certificates", len(got.Certificates))
+			}
+			if len(got.CipherSuites) != len(tt.config.CipherSuites) {
+				t.Errorf("newTLSConfig() CipherSuites = %v, want %v", got.CipherSuites, tt.config.CipherSuites)
+			}
+		})
+	}
+}
+
+// newStubBackend returns an s3Backend that runs against the given in-memory S3 server
+func newStubBackend(t *testing.T, stub *s3stub.Server, config common.S3Configuration) *s3Backend {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	config.Endpoint = server.URL
+	config.Region = "us-east-1"
+	service := s3.New(session.Must(session.NewSession(newAWSConfig(config, server.Client(), credentials.NewStaticCredentials("access", "secret", "")))))
+	service.Handlers.Complete.PushBackNamed(retryCounterHandler)
+	if config.Timeout != 0 {
+		service.Handlers.Build.PushFrontNamed(requestTimeoutHandler(time.Duration(config.Timeout)))
+	}
+	return &s3Backend{service: service}
+}
+
+func Test_s3BackendWithStub(t *testing.T) {
+	stub := s3stub.New()
+	b := newStubBackend(t, stub, common.S3Configuration{})
+	ctx := context.Background()
+	small := bytes.Repeat([]byte("gosbench"), 128)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+
+	if err := b.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	if err := b.Put(ctx, "bucket", "obj0", bytes.NewReader(small), int64(len(small)), TransferOptions{}, nil); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	multipart := TransferOptions{Multipart: true, PartSize: 5 * 1024 * 1024, Concurrency: 2}
+	if err := b.Put(ctx, "bucket", "obj1", bytes.NewReader(large), int64(len(large)), multipart, nil); err != nil {
+		t.Fatalf("multipart Put() error = %v", err)
+	}
+	if got := stub.Requests("UploadPart"); got != 3 {
+		t.Errorf("Put() uploaded %d parts, want 3", got)
+	}
+	if data, _ := stub.Object("bucket", "obj1"); !bytes.Equal(data, large) {
+		t.Errorf("multipart Put() stored %d bytes, want %d", len(data), len(large))
+	}
+
+	if err := b.Get(ctx, "bucket", "obj1", TransferOptions{PartSize: 4 * 1024 * 1024, Concurrency: 2}, nil); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := stub.Requests("GetObject"); got != 3 {
+		t.Errorf("Get() sent %d ranged requests, want 3", got)
+	}
+	info, err := b.Head(ctx, "bucket", "obj0")
+	if err != nil || info.Size != int64(len(small)) {
+		t.Errorf("Head() = %+v, %v", info, err)
+	}
+	objects, err := b.List(ctx, "bucket", "obj")
+	if err != nil || len(objects) != 2 || objects[1].Size != int64(len(large)) {
+		t.Errorf("List() = %+v, %v", objects, err)
+	}
+	if err := b.Delete(ctx, "bucket", "obj0"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := b.Head(ctx, "bucket", "obj0"); err == nil {
+		t.Error("Head() of a deleted object should fail")
+	}
+	if err := b.DeleteBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("DeleteBucket() error = %v", err)
+	}
+	if buckets := stub.Buckets(); len(buckets) != 0 {
+		t.Errorf("DeleteBucket() left the buckets %v", buckets)
+	}
+}
+
+func Test_s3BackendFaults(t *testing.T) {
+	noRetries := 0
+	threeRetries := 3
+	data := bytes.Repeat([]byte("x"), 6*1024*1024)
+	tests := []struct {
+		name           string
+		config         common.S3Configuration
+		injector       s3stub.FaultInjector
+		transfer       TransferOptions
+		wantRetries    uint64
+		wantClass      string
+		wantStatusCode int
+	}{
+		{"throttled and retried", common.S3Configuration{MaxRetries: &threeRetries, RetryMaxThrottleDelay: common.Duration(time.Millisecond)},
+			s3stub.ForOperations(s3stub.EveryNth(2, s3stub.SlowDown), "PutObject"), TransferOptions{}, 1, "", 0},
+		{"throttled without retries", common.S3Configuration{MaxRetries: &noRetries},
+			s3stub.Always(s3stub.SlowDown), TransferOptions{}, 0, "SlowDown", http.StatusServiceUnavailable},
+		{"failed part", common.S3Configuration{MaxRetries: &noRetries},
+			s3stub.ForOperations(s3stub.Always(s3stub.InternalError), "UploadPart"), TransferOptions{Multipart: true, PartSize: 5 * 1024 * 1024, Concurrency: 1}, 0, "InternalError", http.StatusInternalServerError},
+		{"timeout", common.S3Configuration{MaxRetries: &noRetries, Timeout: common.Duration(20 * time.Millisecond)},
+			s3stub.Always(s3stub.Fault{Delay: time.Second}), TransferOptions{}, 0, errorClassTimeout, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			b := newStubBackend(t, stub, tt.config)
+			if err := b.CreateBucket(context.Background(), "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			stub.SetFaultInjector(tt.injector)
+			opCtx, retries := withRetryCounter(context.Background())
+			var err error
+			for i := 0; i < 2 && err == nil; i++ {
+				err = b.Put(opCtx, "bucket", "obj", bytes.NewReader(data), int64(len(data)), tt.transfer, nil)
+			}
+			if tt.wantClass == "" {
+				if err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			} else if gotClass, gotStatusCode := classifyError(err); gotClass != tt.wantClass || gotStatusCode != tt.wantStatusCode {
+				t.Errorf("classifyError() = %v, %v, want %v, %v", gotClass, gotStatusCode, tt.wantClass, tt.wantStatusCode)
+			}
+			if *retries != tt.wantRetries {
+				t.Errorf("retries = %d, want %d", *retries, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func Test_s3BackendCreateBucket(t *testing.T) {
+	noRetries := 0
+	tests := []struct {
+		name     string
+		injector s3stub.FaultInjector
+		wantErr  bool
+	}{
+		{"already owned by you", nil, false},
+		{"already exists", s3stub.Always(s3stub.Fault{StatusCode: http.StatusConflict, Code: "BucketAlreadyExists", Message: "The requested bucket name is not available."}), false},
+		{"access denied", s3stub.Always(s3stub.Fault{StatusCode: http.StatusForbidden, Code: "AccessDenied", Message: "Access Denied"}), true},
+		{"connection reset", s3stub.Always(s3stub.Fault{Reset: true}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			b := newStubBackend(t, stub, common.S3Configuration{MaxRetries: &noRetries})
+			if err := b.CreateBucket(context.Background(), "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			stub.SetFaultInjector(tt.injector)
+			if err := b.CreateBucket(context.Background(), "bucket"); (err != nil) != tt.wantErr {
+				t.Errorf("CreateBucket() of an existing bucket error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_s3BackendObjectLock(t *testing.T) {
+	const partSize = 5 * 1024 * 1024
+	small := bytes.Repeat([]byte("gosbench"), 128)
+	large := bytes.Repeat([]byte("0123456789abcdef"), (2*partSize+1024)/16)
+	tests := []struct {
+		name       string
+		objectLock common.ObjectLockConfiguration
+		// wantDeleted is whether DeleteLockedBucket can remove the bucket
+		wantDeleted bool
+	}{
+		{"governance", common.ObjectLockConfiguration{Enabled: true, Mode: common.ObjectLockGovernance, Retention: common.Duration(time.Hour)}, true},
+		{"governance with legal hold", common.ObjectLockConfiguration{Enabled: true, Mode: common.ObjectLockGovernance, Retention: common.Duration(time.Hour), LegalHold: true}, true},
+		{"compliance", common.ObjectLockConfiguration{Enabled: true, Mode: common.ObjectLockCompliance, Retention: common.Duration(time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			b := newStubBackend(t, stub, common.S3Configuration{})
+			ctx := context.Background()
+			if err := b.CreateLockedBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateLockedBucket() error = %v", err)
+			}
+			options := newObjectOptions(&common.TestCaseConfiguration{ObjectLock: tt.objectLock})
+			for objectName, put := range map[string]struct {
+				data     []byte
+				transfer TransferOptions
+			}{
+				"single":   {small, TransferOptions{}},
+				"uploader": {large, TransferOptions{Multipart: true, PartSize: partSize, Concurrency: 1}},
+				"explicit": {large, TransferOptions{Multipart: true, Explicit: true, PartSize: partSize, Concurrency: 1}},
+			} {
+				if err := b.Put(ctx, "bucket", objectName, bytes.NewReader(put.data), int64(len(put.data)), put.transfer, options); err != nil {
+					t.Fatalf("Put() of %s error = %v", objectName, err)
+				}
+				versions := stub.Versions("bucket", objectName)
+				if len(versions) != 1 || versions[0].LockMode != options.lockMode || versions[0].LegalHold != tt.objectLock.LegalHold {
+					t.Errorf("Put() of %s stored %+v", objectName, versions)
+				}
+			}
+			// Deleting the keys only leaves delete markers in front of the locked versions
+			if err := b.Delete(ctx, "bucket", "single"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			if err := b.DeleteBucket(ctx, "bucket"); err == nil {
+				t.Errorf("DeleteBucket() deleted the locked objects")
+			}
+			err := b.DeleteLockedBucket(ctx, "bucket")
+			if (err == nil) != tt.wantDeleted {
+				t.Errorf("DeleteLockedBucket() error = %v, want the bucket deleted: %v", err, tt.wantDeleted)
+			}
+			if buckets := stub.Buckets(); (len(buckets) == 0) != tt.wantDeleted {
+				t.Errorf("DeleteLockedBucket() left the buckets %v", buckets)
+			}
+		})
+	}
+}
+
+func Test_setPayloadSigning(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		// wantUnsigned are the operations that are sent with UNSIGNED-PAYLOAD
+		wantUnsigned map[string]bool
+	}{
+		{"unsigned PutObject", common.PayloadSigningUnsignedPut, map[string]bool{"PutObject": true}},
+		{"unsigned", common.PayloadSigningUnsigned, map[string]bool{"PutObject": true, "UploadPart": true, "GetObject": true, "DeleteObjects": true}},
+		{"signed", common.PayloadSigningSigned, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			b := newStubBackend(t, stub, common.S3Configuration{})
+			b.putOptions = setPayloadSigning(tt.mode, b.service)
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			var mutex sync.Mutex
+			unsigned := map[string]bool{}
+			stub.SetFaultInjector(func(operation string, r *http.Request) *s3stub.Fault {
+				mutex.Lock()
+				unsigned[operation] = r.Header.Get("X-Amz-Content-Sha256") == "UNSIGNED-PAYLOAD"
+				mutex.Unlock()
+				return nil
+			})
+			small := []byte("gosbench")
+			large := bytes.Repeat([]byte("x"), 6*1024*1024)
+			if err := b.Put(ctx, "bucket", "small", bytes.NewReader(small), int64(len(small)), TransferOptions{}, nil); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if err := b.Put(ctx, "bucket", "large", bytes.NewReader(large), int64(len(large)), TransferOptions{Multipart: true, PartSize: 5 * 1024 * 1024, Concurrency: 1}, nil); err != nil {
+				t.Fatalf("Put() of a multipart object error = %v", err)
+			}
+			if err := b.Get(ctx, "bucket", "small", TransferOptions{PartSize: 1024, Concurrency: 1}, nil); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if err := b.Delete(ctx, "bucket", "small"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			for _, operation := range []string{"PutObject", "UploadPart", "GetObject", "DeleteObjects"} {
+				if unsigned[operation] != tt.wantUnsigned[operation] {
+					t.Errorf("%s sent UNSIGNED-PAYLOAD: %v, want %v", operation, unsigned[operation], tt.wantUnsigned[operation])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons why a test stopped
+const (
+	stopReasonRuntime    = "runtime"
+	stopReasonOps        = "ops"
+	stopReasonBytes      = "bytes"
+	stopReasonErrorRatio = "error_ratio"
+	stopReasonLatencyP99 = "latency_p99"
+)
+
+// stopConditionMinOperations is the number of operations a driver needs to
+// finish before the error ratio and the latency p99 are evaluated.
+// This also is the size of the rolling latency window.
+const stopConditionMinOperations = 1000
+
+// stopConditionCheckInterval is the number of operations after which the
+// rolling latency p99 is evaluated again
+const stopConditionCheckInterval = 100
+
+// testMonitor keeps track of the progress of a running test and decides
+// whether one of its stop conditions is reached
+type testMonitor struct {
+	// bytesBudget is nil when the test does not stop with stop_with_bytes
+	bytesBudget   *leasedBytesBudget
+	maxErrorRatio float64
+	maxLatencyP99 time.Duration
+	// onAbort is called when the test is aborted because of a breached
+	// error ratio or latency - which should also stop the other drivers
+	onAbort func(reason string)
+
+	operations uint64
+	failures   uint64
+
+	latencyMutex sync.Mutex
+	latencies    []time.Duration
+	latencyIndex int
+
+	stopOnce   sync.Once
+	stopReason string
+	stopped    chan struct{}
+}
+
+func newTestMonitor(testConfig *common.TestCaseConfiguration, bytesBudget *leasedBytesBudget, onAbort func(reason string)) *testMonitor {
+	return &testMonitor{
+		bytesBudget:   bytesBudget,
+		maxErrorRatio: testConfig.MaxErrorRatio,
+		maxLatencyP99: time.Duration(testConfig.MaxLatencyP99),
+		onAbort:       onAbort,
+		latencies:     make([]time.Duration, 0, stopConditionMinOperations),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// record adds the outcome of a single operation and stops the test
+// when this breaches one of the stop conditions
+func (m *testMonitor) record(bytes uint64, duration time.Duration, err error) {
+	operations := atomic.AddUint64(&m.operations, 1)
+	failures := atomic.LoadUint64(&m.failures)
+	if err != nil {
+		failures = atomic.AddUint64(&m.failures, 1)
+	} else if m.bytesBudget != nil && !m.bytesBudget.use(bytes) {
+		m.stop(stopReasonBytes)
+	}
+
+	if m.maxErrorRatio != 0 && operations >= stopConditionMinOperations && float64(failures)/float64(operations) > m.maxErrorRatio {
+		log.Warnf("Error ratio of %.4f exceeds the allowed %.4f - aborting test", float64(failures)/float64(operations), m.maxErrorRatio)
+		m.abort(stopReasonErrorRatio)
+	}
+
+	if m.maxLatencyP99 != 0 {
+		m.latencyMutex.Lock()
+		if len(m.latencies) < cap(m.latencies) {
+			m.latencies = append(m.latencies, duration)
+		} else {
+			m.latencies[m.latencyIndex] = duration
+		}
+		m.latencyIndex = (m.latencyIndex + 1) % cap(m.latencies)
+		var p99 time.Duration
+		if len(m.latencies) == cap(m.latencies) && operations%stopConditionCheckInterval == 0 {
+			p99 = percentile(m.latencies, 0.99)
+		}
+		m.latencyMutex.Unlock()
+		if p99 > m.maxLatencyP99 {
+			log.Warnf("Rolling latency p99 of %v exceeds the allowed %v - aborting test", p99, m.maxLatencyP99)
+			m.abort(stopReasonLatencyP99)
+		}
+	}
+}
+
+// stop ends the test with the given reason. Only the first reason is kept.
+func (m *testMonitor) stop(reason string) bool {
+	stopped := false
+	m.stopOnce.Do(func() {
+		m.stopReason = reason
+		close(m.stopped)
+		stopped = true
+	})
+	return stopped
+}
+
+// abort stops the test and tells the server about it
+func (m *testMonitor) abort(reason string) {
+	if m.stop(reason) && m.onAbort != nil {
+		m.onAbort(reason)
+	}
+}
+
+// reason returns why the test stopped - empty while it is still running
+func (m *testMonitor) reason() string {
+	select {
+	case <-m.stopped:
+		return m.stopReason
+	default:
+		return ""
+	}
+}
+
+// percentile returns the given percentile of the latencies without modifying them
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	index := int(float64(len(sorted))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+func Test_testMonitor_record(t *testing.T) {
+	tests := []struct {
+		name       string
+		testConfig *common.TestCaseConfiguration
+		bytes      uint64
+		duration   time.Duration
+		err        error
+		operations int
+		want       string
+	}{
+		{"no stop condition", &common.TestCaseConfiguration{}, 100, time.Second, errors.New("failed"), 2000, ""},
+		{"bytes reached", &common.TestCaseConfiguration{BytesDeadline: 1000}, 100, time.Millisecond, nil, 10, stopReasonBytes},
+		{"bytes not reached", &common.TestCaseConfiguration{BytesDeadline: 1000}, 100, time.Millisecond, nil, 9, ""},
+		{"failed bytes do not count", &common.TestCaseConfiguration{BytesDeadline: 1000}, 100, time.Millisecond, errors.New("failed"), 10, ""},
+		{"error ratio breached", &common.TestCaseConfiguration{MaxErrorRatio: 0.5}, 0, time.Millisecond, errors.New("failed"), stopConditionMinOperations, stopReasonErrorRatio},
+		{"error ratio needs enough operations", &common.TestCaseConfiguration{MaxErrorRatio: 0.5}, 0, time.Millisecond, errors.New("failed"), stopConditionMinOperations - 1, ""},
+		{"latency breached", &common.TestCaseConfiguration{MaxLatencyP99: common.Duration(time.Second)}, 0, 2 * time.Second, nil, stopConditionMinOperations, stopReasonLatencyP99},
+		{"latency within SLO", &common.TestCaseConfiguration{MaxLatencyP99: common.Duration(time.Second)}, 0, time.Second, nil, stopConditionMinOperations, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aborted := ""
+			var bytesBudget *leasedBytesBudget
+			if tt.testConfig.BytesDeadline != 0 {
+				// Play the server: the whole budget in one lease
+				bytesBudget = newLeasedBytesBudget(func() error { return nil })
+				bytesBudget.receive(uint64(tt.testConfig.BytesDeadline))
+				bytesBudget.receive(0)
+			}
+			m := newTestMonitor(tt.testConfig, bytesBudget, func(reason string) {
+				aborted = reason
+			})
+			for i := 0; i < tt.operations; i++ {
+				m.record(tt.bytes, tt.duration, tt.err)
+			}
+			if got := m.reason(); got != tt.want {
+				t.Errorf("testMonitor.reason() = %v, want %v", got, tt.want)
+			}
+			if tt.want == stopReasonBytes && aborted != "" {
+				t.Errorf("testMonitor aborted the test when the bytes were reached")
+			}
+			if (tt.want == stopReasonErrorRatio || tt.want == stopReasonLatencyP99) && aborted != tt.want {
+				t.Errorf("testMonitor did not report the abort, got %v, want %v", aborted, tt.want)
+			}
+		})
+	}
+}
+
+func Test_testMonitor_stop(t *testing.T) {
+	m := newTestMonitor(&common.TestCaseConfiguration{}, nil, nil)
+	if m.reason() != "" {
+		t.Errorf("testMonitor.reason() of running test = %v, want empty reason", m.reason())
+	}
+	m.stop(stopReasonRuntime)
+	m.stop(stopReasonOps)
+	if m.reason() != stopReasonRuntime {
+		t.Errorf("testMonitor.reason() = %v, want %v", m.reason(), stopReasonRuntime)
+	}
+}
+
+func Test_percentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(latencies, 0.99); got != 99*time.Millisecond {
+		t.Errorf("percentile() = %v, want %v", got, 99*time.Millisecond)
+	}
+	if latencies[0] != 100*time.Millisecond {
+		t.Errorf("percentile() modified the given latencies")
+	}
+}
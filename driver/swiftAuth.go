@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// swiftAuth fetches the token and storage URL of the swift backend with
+// TempAuth or Keystone v3 and caches the token until it expires
+type swiftAuth struct {
+	config common.SwiftConfiguration
+	client *http.Client
+
+	mutex      sync.Mutex
+	token      string
+	storageURL string
+	expiry     time.Time
+}
+
+func newSwiftAuth(config common.SwiftConfiguration, client *http.Client) (*swiftAuth, error) {
+	a := &swiftAuth{config: config, client: client}
+	// Authenticate right away to learn the storage URL
+	if _, err := a.getToken(context.Background()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// getToken returns a valid token - refreshed a minute before it expires
+func (a *swiftAuth) getToken(ctx context.Context) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token != "" && (a.expiry.IsZero() || time.Until(a.expiry) > time.Minute) {
+		return a.token, nil
+	}
+	start := time.Now()
+	var token, storageURL string
+	var expiry time.Time
+	var err error
+	if a.config.Auth == common.SwiftAuthKeystone {
+		token, storageURL, expiry, err = a.keystone(ctx)
+	} else {
+		token, storageURL, expiry, err = a.tempAuth(ctx)
+	}
+	provider := "swift_" + a.config.Auth
+	if err != nil {
+		log.WithError(err).WithField("provider", provider).Error("Could not refresh the credentials")
+		promFailedCredentialRefreshes.WithLabelValues(provider).Inc()
+		return "", err
+	}
+	promCredentialRefreshLatency.WithLabelValues(provider).Observe(float64(time.Since(start).Milliseconds()))
+	if a.config.StorageURL != "" {
+		storageURL = a.config.StorageURL
+	}
+	a.token, a.storageURL, a.expiry = token, strings.TrimSuffix(storageURL, "/"), expiry
+	return a.token, nil
+}
+
+// getStorageURL returns the URL of the account of the last authentication
+func (a *swiftAuth) getStorageURL() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.storageURL
+}
+
+func (a *swiftAuth) tempAuth(ctx context.Context) (string, string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.AuthURL, nil)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	req.Header.Set("X-Auth-User", a.config.User)
+	req.Header.Set("X-Auth-Key", a.config.Key)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", "", time.Time{}, fmt.Errorf("TempAuth failed with %s: %s", resp.Status, body)
+	}
+	var expiry time.Time
+	if seconds, err := strconv.Atoi(resp.Header.Get("X-Auth-Token-Expires")); err == nil {
+		expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return resp.Header.Get("X-Auth-Token"), resp.Header.Get("X-Storage-Url"), expiry, nil
+}
+
+// keystoneToken is the part of a Keystone v3 token response that is needed
+type keystoneToken struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+func (a *swiftAuth) keystone(ctx context.Context) (string, string, time.Time, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     a.config.User,
+						"domain":   map[string]string{"name": a.config.UserDomain},
+						"password": a.config.Key,
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"name":   a.config.Project,
+					"domain": map[string]string{"name": a.config.ProjectDomain},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(a.config.AuthURL, "/")+"/auth/tokens", bytes.NewReader(body))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", "", time.Time{}, fmt.Errorf("Keystone auth failed with %s: %s", resp.Status, body)
+	}
+	var token keystoneToken
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", "", time.Time{}, err
+	}
+	for _, service := range token.Token.Catalog {
+		if service.Type != "object-store" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == "public" && (a.config.Region == "" || endpoint.Region == a.config.Region) {
+				return resp.Header.Get("X-Subject-Token"), endpoint.URL, token.Token.ExpiresAt, nil
+			}
+		}
+	}
+	if a.config.StorageURL != "" {
+		return resp.Header.Get("X-Subject-Token"), a.config.StorageURL, token.Token.ExpiresAt, nil
+	}
+	return "", "", time.Time{}, fmt.Errorf("The Keystone catalog has no public object-store endpoint in region %q", a.config.Region)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mulbc/gosbench/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// swiftSegmentsSuffix is appended to a container to get the container of
+// the segments of its large objects
+const swiftSegmentsSuffix = "_segments"
+
+// swiftBackend is the Backend of the OpenStack Swift API. Containers are
+// buckets. Multipart uploads are static or dynamic large objects whose
+// segments are stored in a separate segments container.
+type swiftBackend struct {
+	client       *http.Client
+	auth         *swiftAuth
+	largeObjects string
+	timeout      time.Duration
+}
+
+func newSwiftBackend(config common.S3Configuration, client *http.Client, auth *swiftAuth) *swiftBackend {
+	return &swiftBackend{
+		client:       client,
+		auth:         auth,
+		largeObjects: config.Swift.LargeObjects,
+		timeout:      time.Duration(config.Timeout),
+	}
+}
+
+// swiftObject is an entry of a container listing
+type swiftObject struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// swiftSegment is an entry of the manifest of a static large object
+type swiftSegment struct {
+	Path      string `json:"path"`
+	ETag      string `json:"etag"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+func (b *swiftBackend) url(container string, objectName string, query url.Values) string {
+	u := b.auth.getStorageURL() + "/" + url.PathEscape(container)
+	if objectName != "" {
+		u += "/" + (&url.URL{Path: objectName}).EscapedPath()
+	}
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (b *swiftBackend) do(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	return doREST(ctx, b, b.client, b.timeout, method, url, header, body, length)
+}
+
+func (b *swiftBackend) doAndDiscard(ctx context.Context, method string, url string, header http.Header, body io.Reader, length int64) error {
+	return discardResponse(b.do(ctx, method, url, header, body, length))
+}
+
+// authorize adds the token of the account
+func (b *swiftBackend) authorize(req *http.Request) error {
+	token, err := b.auth.getToken(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", token)
+	return nil
+}
+
+func (b *swiftBackend) failed(status int) bool {
+	return status >= 400
+}
+
+// requestError classifies the error by its HTTP status - Swift has no error codes
+func (b *swiftBackend) requestError(resp *http.Response, body []byte) error {
+	return newRequestFailure(resp, http.StatusText(resp.StatusCode), strings.TrimSpace(string(body)), resp.Header.Get("X-Trans-Id"))
+}
+
+// Put uploads an object - as a large object if the transfer is a multipart one
+func (b *swiftBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	header := http.Header{}
+	if options != nil && options.contentType != "" {
+		header.Set("Content-Type", options.contentType)
+	}
+	var err error
+	if transfer.Multipart {
+		err = b.putLargeObject(ctx, bucket, objectName, content, size, transfer, header)
+	} else {
+		err = b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, nil), header, content, size)
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Errorf("Failed to upload object,")
+		return err
+	}
+	log.WithField("bucket", bucket).WithField("key", objectName).Tracef("Upload successful")
+	return nil
+}
+
+// putLargeObject uploads the segments of the object and then its manifest.
+// Every upload writes its segments below its own prefix, so that a dynamic
+// large object never picks up the segments of an earlier, larger upload.
+// The segments of the earlier uploads are removed once the manifest is written.
+func (b *swiftBackend) putLargeObject(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, header http.Header) error {
+	data, err := readerAt(content)
+	if err != nil {
+		return err
+	}
+	segmentsContainer := bucket + swiftSegmentsSuffix
+	upload := fmt.Sprintf("%020d", time.Now().UnixNano())
+	segmentsPrefix := objectName + "/" + upload + "/"
+	segments := make([]swiftSegment, partCount(size, int64(transfer.PartSize)))
+	err = forEachPart(ctx, size, int64(transfer.PartSize), transfer.Concurrency, func(ctx context.Context, part int, offset int64, length int64) error {
+		segmentName := fmt.Sprintf("%s%08d", segmentsPrefix, part)
+		resp, err := b.do(ctx, http.MethodPut, b.url(segmentsContainer, segmentName, nil), nil, io.NewSectionReader(data, offset, length), length)
+		if err = discardResponse(resp, err); err != nil {
+			return err
+		}
+		segments[part] = swiftSegment{
+			Path:      "/" + segmentsContainer + "/" + segmentName,
+			ETag:      strings.Trim(resp.Header.Get("Etag"), `"`),
+			SizeBytes: length,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if b.largeObjects == common.SwiftLargeObjectsDynamic {
+		// The segments are found by their prefix
+		header.Set("X-Object-Manifest", segmentsContainer+"/"+segmentsPrefix)
+		err = b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, nil), header, nil, 0)
+	} else {
+		var manifest []byte
+		if manifest, err = json.Marshal(segments); err != nil {
+			return err
+		}
+		err = b.doAndDiscard(ctx, http.MethodPut, b.url(bucket, objectName, url.Values{"multipart-manifest": {"put"}}), header, bytes.NewReader(manifest), int64(len(manifest)))
+	}
+	if err != nil {
+		return err
+	}
+	if err := b.deleteSegments(ctx, bucket, objectName, upload); err != nil {
+		log.WithError(err).WithField("object", objectName).WithField("bucket", bucket).Warn("Failed to remove the segments of earlier uploads")
+	}
+	return nil
+}
+
+// deleteSegments removes the segments of all uploads of an object that
+// are older than the given upload - all of them if upload is empty
+func (b *swiftBackend) deleteSegments(ctx context.Context, bucket string, objectName string, upload string) error {
+	segmentsContainer := bucket + swiftSegmentsSuffix
+	prefix := objectName + "/"
+	objects, err := b.List(ctx, segmentsContainer, prefix)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		// Segments are <object>/<upload>/<part> - anything deeper belongs
+		// to another object whose name starts with this one
+		segment := strings.Split(strings.TrimPrefix(object.Key, prefix), "/")
+		if len(segment) != 2 || (upload != "" && segment[0] >= upload) {
+			continue
+		}
+		if err := b.deleteObject(ctx, segmentsContainer, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get downloads an object - with ranged requests of the part size if the transfer is a multipart one
+func (b *swiftBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	if !transfer.Multipart {
+		return b.doAndDiscard(ctx, http.MethodGet, b.url(bucket, objectName, nil), nil, nil, 0)
+	}
+	info, err := b.Head(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	return forEachPart(ctx, info.Size, int64(transfer.PartSize), transfer.Concurrency, func(ctx context.Context, part int, offset int64, length int64) error {
+		if length == 0 {
+			return nil
+		}
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		return b.doAndDiscard(ctx, http.MethodGet, b.url(bucket, objectName, nil), header, nil, 0)
+	})
+}
+
+// List returns the objects of a container with the given prefix
+func (b *swiftBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	marker := ""
+	for {
+		query := url.Values{"format": {"json"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := b.do(ctx, http.MethodGet, b.url(bucket, "", query), nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var page []swiftObject
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(page) == 0 {
+			return objects, nil
+		}
+		for _, object := range page {
+			objects = append(objects, ObjectInfo{Key: object.Name, Size: object.Bytes})
+		}
+		marker = page[len(page)-1].Name
+	}
+}
+
+// Delete removes an object and the segments of large objects
+func (b *swiftBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	if err := b.deleteObject(ctx, bucket, objectName); err != nil {
+		return err
+	}
+	return b.deleteSegments(ctx, bucket, objectName, "")
+}
+
+// deleteObject removes a single object - a missing object is not an error
+func (b *swiftBackend) deleteObject(ctx context.Context, container string, objectName string) error {
+	err := b.doAndDiscard(ctx, http.MethodDelete, b.url(container, objectName, nil), nil, nil, 0)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Head returns the size of an object - for large objects the size of all segments
+func (b *swiftBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.url(bucket, objectName, nil), nil, nil, 0)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return ObjectInfo{Key: objectName, Size: resp.ContentLength}, nil
+}
+
+// CreateBucket creates a container and its segments container
+func (b *swiftBackend) CreateBucket(ctx context.Context, bucket string) error {
+	for _, container := range []string{bucket, bucket + swiftSegmentsSuffix} {
+		if err := b.doAndDiscard(ctx, http.MethodPut, b.url(container, "", nil), nil, nil, 0); err != nil {
+			log.WithError(err).WithField("bucket", container).Info("Issues when creating container")
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBucket removes all objects of a container and its segments container and then the containers themselves
+func (b *swiftBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	for _, container := range []string{bucket, bucket + swiftSegmentsSuffix} {
+		objects, err := b.List(ctx, container, "")
+		if isStatus(err, http.StatusNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if err := b.deleteObject(ctx, container, object.Key); err != nil {
+				return err
+			}
+		}
+		if err := b.doAndDiscard(ctx, http.MethodDelete, b.url(container, "", nil), nil, nil, 0); err != nil && !isStatus(err, http.StatusNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// fakeSwift is a minimal Swift proxy with TempAuth, Keystone v3 and large objects
+type fakeSwift struct {
+	server *httptest.Server
+
+	mutex      sync.Mutex
+	containers map[string]map[string][]byte
+	manifests  map[string]string
+	authCalls  int
+	requests   []string
+}
+
+func (f *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case "/auth/v1.0":
+		f.authCalls++
+		if r.Header.Get("X-Auth-User") != "test:tester" || r.Header.Get("X-Auth-Key") != "testing" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Auth-Token", "token")
+		w.Header().Set("X-Storage-Url", f.server.URL+"/v1/AUTH_test")
+		w.Header().Set("X-Auth-Token-Expires", "3600")
+		return
+	case "/v3/auth/tokens":
+		f.authCalls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"password":"secret"`) || !strings.Contains(string(body), `"project":{"domain":{"name":"Default"},"name":"bench"}`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": "2099-01-01T00:00:00Z", "catalog": [
+			{"type": "identity", "endpoints": [{"interface": "public", "region": "one", "url": "http://keystone"}]},
+			{"type": "object-store", "endpoints": [
+				{"interface": "internal", "region": "one", "url": "http://internal"},
+				{"interface": "public", "region": "two", "url": "http://other-region"},
+				{"interface": "public", "region": "one", "url": "%s/v1/AUTH_test"}]}]}}`, f.server.URL)
+		return
+	}
+	if r.Header.Get("X-Auth-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/AUTH_test/"), "/", 2)
+	container, object := path[0], ""
+	if len(path) == 2 {
+		object = path[1]
+	}
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	f.requests = append(f.requests, strings.Join(strings.Fields(r.Method+" "+strings.TrimPrefix(container, "bucket")+" "+query.Get("multipart-manifest")), " "))
+	objects, ok := f.containers[container]
+	switch {
+	case r.Method == http.MethodPut && object == "":
+		if !ok {
+			f.containers[container] = map[string][]byte{}
+		}
+		w.WriteHeader(http.StatusCreated)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodDelete && object == "":
+		if len(objects) != 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(f.containers, container)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && object == "":
+		var names []string
+		for name := range objects {
+			if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("marker") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) > 1 {
+			// Page through the listing one object at a time
+			names = names[:1]
+		}
+		list := []swiftObject{}
+		for _, name := range names {
+			list = append(list, swiftObject{Name: name, Bytes: int64(len(f.read(container, name)))})
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPut && query.Get("multipart-manifest") == "put":
+		var segments []swiftSegment
+		if err := json.Unmarshal(body, &segments); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, segment := range segments {
+			path := strings.SplitN(strings.TrimPrefix(segment.Path, "/"), "/", 2)
+			part := f.containers[path[0]][path[1]]
+			if fmt.Sprintf("%x", md5.Sum(part)) != segment.ETag || int64(len(part)) != segment.SizeBytes {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data = append(data, part...)
+		}
+		objects[object] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		objects[object] = body
+		if manifest := r.Header.Get("X-Object-Manifest"); manifest != "" {
+			f.manifests[container+"/"+object] = manifest
+		}
+		w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum(body)))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		if _, ok := objects[object]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data := f.read(container, object)
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			data = data[start : end+1]
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		if _, ok := objects[object]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(objects, object)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// read returns the content of an object - the concatenated segments for dynamic large objects
+func (f *fakeSwift) read(container string, object string) []byte {
+	manifest, ok := f.manifests[container+"/"+object]
+	if !ok {
+		return f.containers[container][object]
+	}
+	path := strings.SplitN(manifest, "/", 2)
+	var names []string
+	for name := range f.containers[path[0]] {
+		if strings.HasPrefix(name, path[1]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var data []byte
+	for _, name := range names {
+		data = append(data, f.containers[path[0]][name]...)
+	}
+	return data
+}
+
+func newTestSwiftBackend(t *testing.T, config common.SwiftConfiguration) (*swiftBackend, *fakeSwift) {
+	fake := &fakeSwift{containers: map[string]map[string][]byte{}, manifests: map[string]string{}}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+	config.AuthURL = fake.server.URL + config.AuthURL
+	auth, err := newSwiftAuth(config, fake.server.Client())
+	if err != nil {
+		t.Fatalf("newSwiftAuth() error = %v", err)
+	}
+	return newSwiftBackend(common.S3Configuration{Swift: config}, fake.server.Client(), auth), fake
+}
+
+func Test_swiftBackend(t *testing.T) {
+	content := []byte(strings.Repeat("gosbench", 1000))
+	tempAuth := common.SwiftConfiguration{Auth: common.SwiftAuthTempAuth, AuthURL: "/auth/v1.0", User: "test:tester", Key: "testing"}
+	keystone := common.SwiftConfiguration{Auth: common.SwiftAuthKeystone, AuthURL: "/v3", User: "bench", Key: "secret",
+		UserDomain: "Default", Project: "bench", ProjectDomain: "Default", Region: "one"}
+	multipart := TransferOptions{Multipart: true, PartSize: 3000, Concurrency: 2}
+	tests := []struct {
+		name         string
+		config       common.SwiftConfiguration
+		largeObjects string
+		transfer     TransferOptions
+		wantRequests []string
+	}{
+		{"TempAuth", tempAuth, common.SwiftLargeObjectsStatic, TransferOptions{}, []string{"PUT", "GET"}},
+		{"Keystone", keystone, common.SwiftLargeObjectsStatic, TransferOptions{}, []string{"PUT", "GET"}},
+		{"Static large object", tempAuth, common.SwiftLargeObjectsStatic, multipart,
+			[]string{"PUT _segments", "PUT _segments", "PUT _segments", "PUT put", "GET _segments", "GET _segments", "GET _segments", "GET _segments", "HEAD", "GET", "GET", "GET"}},
+		{"Dynamic large object", keystone, common.SwiftLargeObjectsDynamic, multipart,
+			[]string{"PUT _segments", "PUT _segments", "PUT _segments", "PUT", "GET _segments", "GET _segments", "GET _segments", "GET _segments", "HEAD", "GET", "GET", "GET"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.LargeObjects = tt.largeObjects
+			b, fake := newTestSwiftBackend(t, tt.config)
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			fake.requests = nil
+			if err := b.Put(ctx, "bucket", "dir/object", bytes.NewReader(content), int64(len(content)), tt.transfer, nil); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if err := b.Get(ctx, "bucket", "dir/object", tt.transfer, nil); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			sort.Strings(fake.requests)
+			sort.Strings(tt.wantRequests)
+			if !reflect.DeepEqual(fake.requests, tt.wantRequests) {
+				t.Errorf("Put() and Get() sent %v, want %v", fake.requests, tt.wantRequests)
+			}
+
+			b, fake = newTestSwiftBackend(t, tt.config)
+			testBackendContract(t, b, content, tt.transfer, fake.read, "Not Found")
+			if len(fake.containers) != 0 {
+				t.Errorf("DeleteBucket() left %d containers behind", len(fake.containers))
+			}
+			if fake.authCalls != 1 {
+				t.Errorf("The backend authenticated %d times, want 1", fake.authCalls)
+			}
+		})
+	}
+}
+
+func Test_swiftBackend_overwriteLargeObject(t *testing.T) {
+	content := []byte(strings.Repeat("gosbench", 1000))
+	smaller := content[:4000]
+	multipart := TransferOptions{Multipart: true, PartSize: 3000, Concurrency: 2}
+	for _, largeObjects := range []string{common.SwiftLargeObjectsStatic, common.SwiftLargeObjectsDynamic} {
+		t.Run(largeObjects, func(t *testing.T) {
+			b, fake := newTestSwiftBackend(t, common.SwiftConfiguration{Auth: common.SwiftAuthTempAuth, AuthURL: "/auth/v1.0",
+				User: "test:tester", Key: "testing", LargeObjects: largeObjects})
+			ctx := context.Background()
+			if err := b.CreateBucket(ctx, "bucket"); err != nil {
+				t.Fatalf("CreateBucket() error = %v", err)
+			}
+			// Another object whose name starts with the same prefix keeps its segments
+			if err := b.Put(ctx, "bucket", "object/other", bytes.NewReader(smaller), int64(len(smaller)), multipart, nil); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			for _, data := range [][]byte{content, smaller} {
+				if err := b.Put(ctx, "bucket", "object", bytes.NewReader(data), int64(len(data)), multipart, nil); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+			if got := fake.read("bucket", "object"); !bytes.Equal(got, smaller) {
+				t.Errorf("Put() of a smaller object stored %d bytes, want %d", len(got), len(smaller))
+			}
+			if got := len(fake.containers["bucket_segments"]); got != 4 {
+				t.Errorf("Put() of a smaller object left %d segments, want %d", got, 4)
+			}
+			if err := b.Delete(ctx, "bucket", "object"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if got := len(fake.containers["bucket_segments"]); got != 2 {
+				t.Errorf("Delete() left %d segments, want %d", got, 2)
+			}
+			if got := fake.read("bucket", "object/other"); !bytes.Equal(got, smaller) {
+				t.Errorf("Delete() changed another object to %d bytes, want %d", len(got), len(smaller))
+			}
+		})
+	}
+}
+
+func Test_newSwiftAuth_wrongKey(t *testing.T) {
+	fake := &fakeSwift{}
+	fake.server = httptest.NewServer(fake)
+	defer fake.server.Close()
+	config := common.SwiftConfiguration{Auth: common.SwiftAuthTempAuth, AuthURL: fake.server.URL + "/auth/v1.0", User: "test:tester", Key: "wrong"}
+	if _, err := newSwiftAuth(config, fake.server.Client()); err == nil {
+		t.Errorf("newSwiftAuth() with a wrong key succeeded")
+	}
+}
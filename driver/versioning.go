@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// versionTarget is the version of an object that a read or a delete targets by its ID
+type versionTarget struct {
+	// index is the position of the version among the versions that the
+	// preparation writes - the oldest one is 0
+	index int
+	// id is found during the preparation. Deletes prepare their object again
+	// while the deletes of the previous run may still be in progress.
+	id atomic.Value
+}
+
+// newVersionTarget returns the target of a read or a delete of the given
+// mode - or nil if the latest version is targeted
+func newVersionTarget(mode string, versions int, source *rand.Rand) *versionTarget {
+	if mode != common.VersionSpecific {
+		return nil
+	}
+	return &versionTarget{index: source.Intn(versions)}
+}
+
+// versionID returns the ID of the targeted version
+func (v *versionTarget) versionID() string {
+	id, _ := v.id.Load().(string)
+	return id
+}
+
+// putVersions writes the versions of an object during the preparation
+// and finds the ID of the targeted version - if there is one
+func putVersions(bucket string, objectName string, size uint64, versions int, target *versionTarget, transfer TransferOptions, options *objectOptions) error {
+	if versions < 1 {
+		versions = 1
+	}
+	for version := 0; version < versions; version++ {
+		if err := housekeepingBackend.Put(ctx, bucket, objectName, bytes.NewReader(randomData[:size]), int64(size), transfer, options); err != nil {
+			return err
+		}
+	}
+	if target == nil {
+		return nil
+	}
+	listed, err := housekeepingBackend.(VersionedBackend).ListVersionsOf(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	// The versions that were just written are the latest ones of the object
+	var versionIDs []string
+	for _, version := range listed {
+		if !version.DeleteMarker {
+			versionIDs = append(versionIDs, version.VersionID)
+		}
+	}
+	if len(versionIDs) < versions {
+		return fmt.Errorf("Found %d of the %d versions of %s", len(versionIDs), versions, objectName)
+	}
+	target.id.Store(versionIDs[versions-1-target.index])
+	return nil
+}
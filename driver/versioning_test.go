@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+	"github.com/mulbc/gosbench/s3stub"
+)
+
+// useStubBackend runs the work items against a versioned bucket of the stub
+func useStubBackend(t *testing.T, stub *s3stub.Server) *s3Backend {
+	var err error
+	if balancer, err = newEndpointBalancer(common.S3Configuration{Endpoint: "http://localhost:9000"}, 0); err != nil {
+		t.Fatalf("newEndpointBalancer() error = %v", err)
+	}
+	ctx = context.Background()
+	randomData = make([]byte, 64)
+	b := newStubBackend(t, stub, common.S3Configuration{})
+	backend, housekeepingBackend = b, b
+	if err := b.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	if err := b.EnableVersioning(ctx, "bucket"); err != nil {
+		t.Fatalf("EnableVersioning() error = %v", err)
+	}
+	return b
+}
+
+func Test_versionedWorkItems(t *testing.T) {
+	tests := []struct {
+		name string
+		work WorkItem
+		// wantTarget is the index of the version that Do targets - the latest one if negative
+		wantTarget int
+		// wantVersions is the number of versions and delete markers after Do
+		wantVersions int
+		wantMarker   bool
+	}{
+		{"Read latest", ReadOperation{Bucket: "bucket", ObjectName: "obj", ObjectSize: 64, Versions: 3}, -1, 3, false},
+		{"Read oldest", ReadOperation{Bucket: "bucket", ObjectName: "obj", ObjectSize: 64, Versions: 3, Version: &versionTarget{index: 0}}, 0, 3, false},
+		{"Delete with marker", DeleteOperation{Bucket: "bucket", ObjectName: "obj", ObjectSize: 64, Versions: 2}, -1, 3, true},
+		{"Delete specific", DeleteOperation{Bucket: "bucket", ObjectName: "obj", ObjectSize: 64, Versions: 3, Version: &versionTarget{index: 1}}, 1, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := s3stub.New()
+			useStubBackend(t, stub)
+			if err := tt.work.Prepare(); err != nil {
+				t.Fatalf("Prepare() error = %v", err)
+			}
+			prepared := stub.Versions("bucket", "obj")
+			var mutex sync.Mutex
+			var targeted []string
+			stub.SetFaultInjector(func(operation string, r *http.Request) *s3stub.Fault {
+				if operation == "GetObject" || operation == "DeleteObject" || operation == "DeleteObjects" {
+					mutex.Lock()
+					targeted = append(targeted, r.URL.Query().Get("versionId"))
+					mutex.Unlock()
+				}
+				return nil
+			})
+			if err := tt.work.Do(); err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+
+			want := ""
+			if tt.wantTarget >= 0 {
+				// The versions of the stub are ordered from the latest to the oldest one
+				want = prepared[len(prepared)-1-tt.wantTarget].VersionID
+			}
+			if len(targeted) == 0 || targeted[0] != want {
+				t.Errorf("Do() targeted the versions %q, want %q", targeted, want)
+			}
+			versions := stub.Versions("bucket", "obj")
+			if len(versions) != tt.wantVersions || versions[0].DeleteMarker != tt.wantMarker {
+				t.Errorf("Versions after Do() = %+v, want %d versions, delete marker: %v", versions, tt.wantVersions, tt.wantMarker)
+			}
+			if _, isDelete := tt.work.(DeleteOperation); isDelete && tt.wantTarget >= 0 {
+				for _, version := range versions {
+					if version.VersionID == want {
+						t.Errorf("Do() did not delete the version %s", want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_deleteBucketWithVersions(t *testing.T) {
+	stub := s3stub.New()
+	b := useStubBackend(t, stub)
+	for _, objectName := range []string{"a", "b", "c"} {
+		if err := putVersions("bucket", objectName, 64, 3, nil, TransferOptions{}, nil); err != nil {
+			t.Fatalf("putVersions() error = %v", err)
+		}
+	}
+	if err := b.Delete(ctx, "bucket", "b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if versions, err := b.ListVersions(ctx, "bucket", ""); err != nil || len(versions) != 10 {
+		t.Errorf("ListVersions() = %d versions, %v, want 10", len(versions), err)
+	}
+	if err := b.DeleteBucket(ctx, "bucket"); err != nil {
+		t.Fatalf("DeleteBucket() error = %v", err)
+	}
+	if buckets := stub.Buckets(); len(buckets) != 0 {
+		t.Errorf("DeleteBucket() left the buckets %v", buckets)
+	}
+}
+
+func Test_s3Backend_ListVersionsOf(t *testing.T) {
+	stub := s3stub.New()
+	b := useStubBackend(t, stub)
+	if err := putVersions("bucket", "obj", 64, 3, nil, TransferOptions{}, nil); err != nil {
+		t.Fatalf("putVersions() error = %v", err)
+	}
+	// More keys that start with the object name than fit on a listing page
+	for i := 0; i < 1000; i++ {
+		if err := putVersions("bucket", fmt.Sprintf("obj%04d", i), 64, 1, nil, TransferOptions{}, nil); err != nil {
+			t.Fatalf("putVersions() error = %v", err)
+		}
+	}
+	if versions, err := b.ListVersions(ctx, "bucket", "obj"); err != nil || len(versions) != 1003 {
+		t.Errorf("ListVersions() = %d versions, %v, want %d", len(versions), err, 1003)
+	}
+	if got := stub.Requests("ListObjectVersions"); got != 2 {
+		t.Errorf("ListVersions() sent %d requests, want %d", got, 2)
+	}
+	versions, err := b.ListVersionsOf(ctx, "bucket", "obj")
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("ListVersionsOf() = %d versions, %v, want %d", len(versions), err, 3)
+	}
+	for _, version := range versions {
+		if version.Key != "obj" {
+			t.Errorf("ListVersionsOf() returned a version of %s", version.Key)
+		}
+	}
+	if got := stub.Requests("ListObjectVersions"); got != 3 {
+		t.Errorf("ListVersionsOf() sent %d requests, want %d", got-2, 1)
+	}
+}
+
+func Test_fillWorkqueueWithVersions(t *testing.T) {
+	stub := s3stub.New()
+	useStubBackend(t, stub)
+	testConfig := &common.TestCaseConfiguration{Name: "versions", BucketPrefix: "versioned", ObjectPrefix: "obj", WriteWeight: 1, ReadWeight: 1}
+	testConfig.Buckets.NumberMin, testConfig.Buckets.NumberMax, testConfig.Buckets.NumberDistribution = 1, 1, "constant"
+	testConfig.Objects.NumberMin, testConfig.Objects.NumberMax, testConfig.Objects.NumberDistribution = 4, 4, "constant"
+	testConfig.Objects.SizeMin, testConfig.Objects.SizeMax, testConfig.Objects.SizeDistribution = 64, 64, "constant"
+	testConfig.Versioning = common.VersioningConfiguration{Enabled: true, Versions: 3, Read: common.VersionSpecific, Delete: common.VersionMarker}
+	queue := &Workqueue{Queue: &[]WorkItem{}}
+	fillWorkqueue(testConfig, queue, "d1-", true)
+
+	if got := stub.Requests("PutBucketVersioning"); got != 2 {
+		t.Errorf("PutBucketVersioning was sent %d times, want 2", got)
+	}
+	writes, reads := map[string]int{}, 0
+	for _, work := range *queue.Queue {
+		switch op := work.(type) {
+		case WriteOperation:
+			writes[op.ObjectName]++
+		case ReadOperation:
+			reads++
+			if op.Versions != 3 || op.Version == nil || op.Version.index < 0 || op.Version.index >= 3 {
+				t.Errorf("Read of %s targets %+v of %d versions", op.ObjectName, op.Version, op.Versions)
+			}
+		}
+	}
+	// The weights count every version that is written
+	if len(writes) != 1 || reads != 3 {
+		t.Errorf("Got writes of %v and %d reads, want one key with 3 writes and 3 reads", writes, reads)
+	}
+	for objectName, count := range writes {
+		if count != 3 {
+			t.Errorf("%s is written %d times, want once per version", objectName, count)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -30,6 +31,11 @@ type ReadOperation struct {
 	MPUEnabled               bool
 	PartSize                 uint64
 	MPUConcurrency           int
+	Options                  *objectOptions
+	// Versions is the number of versions that the preparation writes
+	Versions int
+	// Version is the version that is read - the latest one if nil
+	Version *versionTarget
 }
 
 // WriteOperation stands for a write operation
@@ -41,6 +47,13 @@ type WriteOperation struct {
 	MPUEnabled     bool
 	PartSize       uint64
 	MPUConcurrency int
+	Options        *objectOptions
+	// ExplicitMPU sends the steps of the multipart upload on their own
+	ExplicitMPU bool
+	PartOrder   string
+	AbortMPU    bool
+	// CopySource is the object that the parts are copied from - if set
+	CopySource string
 }
 
 // ListOperation stands for a list operation
@@ -52,6 +65,9 @@ type ListOperation struct {
 	MPUEnabled     bool
 	PartSize       uint64
 	MPUConcurrency int
+	Options        *objectOptions
+	// Versions is the number of versions that the preparation writes
+	Versions int
 }
 
 // DeleteOperation stands for a delete operation
@@ -63,6 +79,11 @@ type DeleteOperation struct {
 	MPUEnabled     bool
 	PartSize       uint64
 	MPUConcurrency int
+	Options        *objectOptions
+	// Versions is the number of versions that the preparation writes
+	Versions int
+	// Version is the version that is deleted - a delete marker is added if nil
+	Version *versionTarget
 }
 
 // Stopper marks the end of a workqueue when using
@@ -98,6 +119,9 @@ func init() {
 
 var workContext context.Context
 
+// monitor keeps track of the stop conditions of the running test
+var monitor *testMonitor
+
 // WorkCancel is the function to stop the execution of jobs
 var WorkCancel context.CancelFunc
 
@@ -112,23 +136,59 @@ func IncreaseOperationValue(operation string, value float64, Queue *Workqueue) e
 	return fmt.Errorf("Could not find requested operation %s", operation)
 }
 
+// transferOptions returns how the ReadOperation downloads its object.
+// Objects are always downloaded in parts - by default the ones of the S3 SDK.
+func (op ReadOperation) transferOptions() TransferOptions {
+	transfer := TransferOptions{Multipart: op.MPUEnabled, PartSize: op.PartSize, Concurrency: op.MPUConcurrency}
+	if transfer.PartSize == 0 {
+		transfer.PartSize = s3manager.DefaultDownloadPartSize
+	}
+	if transfer.Concurrency == 0 {
+		transfer.Concurrency = s3manager.DefaultDownloadConcurrency
+	}
+	return transfer
+}
+
+// transferOptions returns how the WriteOperation uploads its object
+func (op WriteOperation) transferOptions() TransferOptions {
+	transfer := uploadTransferOptions(op.MPUEnabled, op.PartSize, op.MPUConcurrency)
+	transfer.Explicit = op.ExplicitMPU
+	transfer.PartOrder = op.PartOrder
+	transfer.Abort = op.AbortMPU
+	transfer.CopySource = op.CopySource
+	return transfer
+}
+
+// transferOptions returns how the ListOperation uploads its object
+func (op ListOperation) transferOptions() TransferOptions {
+	return uploadTransferOptions(op.MPUEnabled, op.PartSize, op.MPUConcurrency)
+}
+
+// transferOptions returns how the DeleteOperation uploads its object
+func (op DeleteOperation) transferOptions() TransferOptions {
+	return uploadTransferOptions(op.MPUEnabled, op.PartSize, op.MPUConcurrency)
+}
+
+// uploadTransferOptions returns the TransferOptions of an upload - with the
+// part size and concurrency of the S3 SDK if they are not set
+func uploadTransferOptions(multipart bool, partSize uint64, concurrency int) TransferOptions {
+	transfer := TransferOptions{Multipart: multipart, PartSize: partSize, Concurrency: concurrency}
+	if transfer.PartSize == 0 {
+		transfer.PartSize = uint64(s3manager.DefaultUploadPartSize)
+	}
+	if transfer.Concurrency == 0 {
+		transfer.Concurrency = s3manager.DefaultUploadConcurrency
+	}
+	return transfer
+}
+
 // Prepare prepares the execution of the ReadOperation
 func (op ReadOperation) Prepare() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("Preexisting?", op.WorksOnPreexistingObject).Debug("Preparing ReadOperation")
 	if op.WorksOnPreexistingObject {
 		return nil
 	}
-	if op.MPUEnabled {
-		if op.PartSize == 0 {
-			op.PartSize = s3manager.DefaultDownloadPartSize
-		}
-		if op.MPUConcurrency == 0 {
-			op.MPUConcurrency = s3manager.DefaultDownloadConcurrency
-		}
-		return putObjectMPU(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, op.PartSize, op.MPUConcurrency)
-	} else {
-		return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, int64(op.ObjectSize))
-	}
+	return putVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions, op.Version, op.transferOptions(), op.Options)
 }
 
 // Prepare prepares the execution of the WriteOperation
@@ -140,34 +200,13 @@ func (op WriteOperation) Prepare() error {
 // Prepare prepares the execution of the ListOperation
 func (op ListOperation) Prepare() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing ListOperation")
-
-	if op.MPUEnabled {
-		if op.PartSize == 0 {
-			op.PartSize = uint64(s3manager.DefaultUploadPartSize)
-		}
-		if op.MPUConcurrency == 0 {
-			op.MPUConcurrency = s3manager.DefaultUploadConcurrency
-		}
-		return putObjectMPU(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, op.PartSize, op.MPUConcurrency)
-	} else {
-		return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, int64(op.ObjectSize))
-	}
+	return putVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions, nil, op.transferOptions(), op.Options)
 }
 
 // Prepare prepares the execution of the DeleteOperation
 func (op DeleteOperation) Prepare() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Preparing DeleteOperation")
-	if op.MPUEnabled {
-		if op.PartSize == 0 {
-			op.PartSize = uint64(s3manager.DefaultUploadPartSize)
-		}
-		if op.MPUConcurrency == 0 {
-			op.MPUConcurrency = s3manager.DefaultUploadConcurrency
-		}
-		return putObjectMPU(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, op.PartSize, op.MPUConcurrency)
-	} else {
-		return putObject(housekeepingSvc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, int64(op.ObjectSize))
-	}
+	return putVersions(op.Bucket, op.ObjectName, op.ObjectSize, op.Versions, op.Version, op.transferOptions(), op.Options)
 }
 
 // Prepare does nothing here
@@ -178,82 +217,68 @@ func (op Stopper) Prepare() error {
 // Do executes the actual work of the ReadOperation
 func (op ReadOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("Preexisting?", op.WorksOnPreexistingObject).Debug("Doing ReadOperation")
-	if op.PartSize == 0 {
-		op.PartSize = s3manager.DefaultDownloadPartSize
-	}
-	if op.MPUConcurrency == 0 {
-		op.MPUConcurrency = s3manager.DefaultDownloadConcurrency
-	}
+	opCtx, retries := withRetryCounter(ctx)
+	opCtx, endpoint, release := balancer.acquire(opCtx)
 	start := time.Now()
-	err := getObject(svc, op.ObjectName, op.Bucket, op.PartSize, op.MPUConcurrency)
-	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "GET").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "GET").Inc()
+	var err error
+	if op.Version != nil {
+		err = backend.(VersionedBackend).GetVersion(opCtx, op.Bucket, op.ObjectName, op.Version.versionID(), op.transferOptions(), op.Options)
 	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "GET").Inc()
+		err = backend.Get(opCtx, op.Bucket, op.ObjectName, op.transferOptions(), op.Options)
 	}
-	promDownloadedBytes.WithLabelValues(op.TestName, "GET").Add(float64(op.ObjectSize))
+	duration := time.Since(start)
+	release()
+	promDownloadedBytes.WithLabelValues(op.TestName, "GET", endpoint).Add(float64(op.ObjectSize))
+	observeOperation(op.TestName, "GET", endpoint, op.ObjectSize, duration, *retries, err)
 	return err
 }
 
 // Do executes the actual work of the WriteOperation
 func (op WriteOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing WriteOperation")
-	var err error
-	var duration time.Duration
-	if op.MPUEnabled {
-		if op.PartSize == 0 {
-			op.PartSize = uint64(s3manager.DefaultUploadPartSize)
-		}
-		if op.MPUConcurrency == 0 {
-			op.MPUConcurrency = s3manager.DefaultUploadConcurrency
-		}
-		start := time.Now()
-		err = putObjectMPU(svc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, op.PartSize, op.MPUConcurrency)
-		duration = time.Since(start)
-	} else {
-		start := time.Now()
-		err = putObject(svc, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), op.Bucket, int64(op.ObjectSize))
-		duration = time.Since(start)
-	}
-	promLatency.WithLabelValues(op.TestName, "PUT").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "PUT").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "PUT").Inc()
+	opCtx, retries := withRetryCounter(ctx)
+	opCtx, endpoint, release := balancer.acquire(opCtx)
+	opCtx = withMultipartSteps(opCtx, op.TestName, endpoint)
+	start := time.Now()
+	err := backend.Put(opCtx, op.Bucket, op.ObjectName, bytes.NewReader(randomData[:op.ObjectSize]), int64(op.ObjectSize), op.transferOptions(), op.Options)
+	duration := time.Since(start)
+	release()
+	// Copied parts are not uploaded by the driver
+	if op.CopySource == "" {
+		promUploadedBytes.WithLabelValues(op.TestName, "PUT", endpoint).Add(float64(op.ObjectSize))
 	}
-	promUploadedBytes.WithLabelValues(op.TestName, "PUT").Add(float64(op.ObjectSize))
+	observeOperation(op.TestName, "PUT", endpoint, op.ObjectSize, duration, *retries, err)
 	return err
 }
 
 // Do executes the actual work of the ListOperation
 func (op ListOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing ListOperation")
+	opCtx, retries := withRetryCounter(ctx)
+	opCtx, endpoint, release := balancer.acquire(opCtx)
 	start := time.Now()
-	_, err := listObjects(svc, op.ObjectName, op.Bucket)
+	_, err := backend.List(opCtx, op.Bucket, op.ObjectName)
 	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "LIST").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "LIST").Inc()
-	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "LIST").Inc()
-	}
+	release()
+	observeOperation(op.TestName, "LIST", endpoint, 0, duration, *retries, err)
 	return err
 }
 
 // Do executes the actual work of the DeleteOperation
 func (op DeleteOperation) Do() error {
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).Debug("Doing DeleteOperation")
+	opCtx, retries := withRetryCounter(ctx)
+	opCtx, endpoint, release := balancer.acquire(opCtx)
 	start := time.Now()
-	err := deleteObject(svc, op.ObjectName, op.Bucket)
-	duration := time.Since(start)
-	promLatency.WithLabelValues(op.TestName, "DELETE").Observe(float64(duration.Milliseconds()))
-	if err != nil {
-		promFailedOps.WithLabelValues(op.TestName, "DELETE").Inc()
+	var err error
+	if op.Version != nil {
+		err = backend.(VersionedBackend).DeleteVersion(opCtx, op.Bucket, op.ObjectName, op.Version.versionID())
 	} else {
-		promFinishedOps.WithLabelValues(op.TestName, "DELETE").Inc()
+		err = backend.Delete(opCtx, op.Bucket, op.ObjectName)
 	}
+	duration := time.Since(start)
+	release()
+	observeOperation(op.TestName, "DELETE", endpoint, 0, duration, *retries, err)
 	return err
 }
 
@@ -268,17 +293,17 @@ func (op ReadOperation) Clean() error {
 		return nil
 	}
 	log.WithField("bucket", op.Bucket).WithField("object", op.ObjectName).WithField("Preexisting?", op.WorksOnPreexistingObject).Debug("Cleaning up ReadOperation")
-	return deleteObject(housekeepingSvc, op.ObjectName, op.Bucket)
+	return housekeepingBackend.Delete(ctx, op.Bucket, op.ObjectName)
 }
 
 // Clean removes the objects and buckets left from the previous WriteOperation
 func (op WriteOperation) Clean() error {
-	return deleteObject(housekeepingSvc, op.ObjectName, op.Bucket)
+	return housekeepingBackend.Delete(ctx, op.Bucket, op.ObjectName)
 }
 
 // Clean removes the objects and buckets left from the previous ListOperation
 func (op ListOperation) Clean() error {
-	return deleteObject(housekeepingSvc, op.ObjectName, op.Bucket)
+	return housekeepingBackend.Delete(ctx, op.Bucket, op.ObjectName)
 }
 
 // Clean removes the objects and buckets left from the previous DeleteOperation
@@ -291,6 +316,27 @@ func (op Stopper) Clean() error {
 	return nil
 }
 
+// observeOperation records the outcome of a single operation in
+// Prometheus and in the monitor of the running test
+func observeOperation(testName string, method string, endpoint string, bytes uint64, duration time.Duration, retries uint64, err error) {
+	promLatency.WithLabelValues(testName, method, endpoint).Observe(float64(duration.Milliseconds()))
+	promRetries.WithLabelValues(testName, method, endpoint).Add(float64(retries))
+	if err == nil {
+		promFinishedOps.WithLabelValues(testName, method, endpoint).Inc()
+	} else if errorClass, statusCode := classifyError(err); errorClass == errorClassTimeout {
+		promTimedOutOps.WithLabelValues(testName, method, endpoint).Inc()
+	} else {
+		status := ""
+		if statusCode != 0 {
+			status = strconv.Itoa(statusCode)
+		}
+		promFailedOps.WithLabelValues(testName, method, endpoint, errorClass, status).Inc()
+	}
+	if monitor != nil {
+		monitor.record(bytes, duration, err)
+	}
+}
+
 // DoWork processes the workitems in the workChannel until
 // either the time runs out or a stopper is found
 func DoWork(workChannel chan WorkItem, doneChannel chan bool) {
@@ -315,10 +361,10 @@ func DoWork(workChannel chan WorkItem, doneChannel chan bool) {
 	}
 }
 
-func generateRandomBytes(size uint64) []byte {
+func generateRandomBytes(size uint64, source *rand.Rand) []byte {
 	now := time.Now()
 	random := make([]byte, size)
-	n, err := rand.Read(random)
+	n, err := source.Read(random)
 	if err != nil {
 		log.WithError(err).Fatal("I had issues getting my random bytes initialized")
 	}
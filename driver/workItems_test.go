@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mulbc/gosbench/common"
+)
+
+// recordingBackend is a Backend that records the calls of the work items
+type recordingBackend struct {
+	mutex sync.Mutex
+	calls []string
+	err   error
+}
+
+func (b *recordingBackend) record(call string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = append(b.calls, call)
+	return b.err
+}
+
+func (b *recordingBackend) Put(ctx context.Context, bucket string, objectName string, content io.ReadSeeker, size int64, transfer TransferOptions, options *objectOptions) error {
+	if n, _ := io.Copy(ioutil.Discard, content); n != size {
+		return errors.New("short content")
+	}
+	return b.record("put " + bucket + "/" + objectName)
+}
+
+func (b *recordingBackend) Get(ctx context.Context, bucket string, objectName string, transfer TransferOptions, options *objectOptions) error {
+	return b.record("get " + bucket + "/" + objectName)
+}
+
+func (b *recordingBackend) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	return nil, b.record("list " + bucket + "/" + prefix)
+}
+
+func (b *recordingBackend) Delete(ctx context.Context, bucket string, objectName string) error {
+	return b.record("delete " + bucket + "/" + objectName)
+}
+
+func (b *recordingBackend) Head(ctx context.Context, bucket string, objectName string) (ObjectInfo, error) {
+	return ObjectInfo{}, b.record("head " + bucket + "/" + objectName)
+}
+
+func (b *recordingBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return b.record("create " + bucket)
+}
+
+func (b *recordingBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	return b.record("delete " + bucket)
+}
+
+func Test_WorkItemsUseBackend(t *testing.T) {
+	var err error
+	if balancer, err = newEndpointBalancer(common.S3Configuration{Endpoint: "http://localhost:9000"}, 0); err != nil {
+		t.Fatalf("newEndpointBalancer() error = %v", err)
+	}
+	ctx = context.Background()
+	randomData = make([]byte, 16)
+	tests := []struct {
+		name       string
+		work       WorkItem
+		backendErr error
+		want       []string
+		wantHouse  []string
+	}{
+		{"Read", ReadOperation{Bucket: "b", ObjectName: "o", ObjectSize: 16}, nil, []string{"get b/o"}, []string{"put b/o", "delete b/o"}},
+		{"Existing read", ReadOperation{Bucket: "b", ObjectName: "o", ObjectSize: 16, WorksOnPreexistingObject: true}, nil, []string{"get b/o"}, nil},
+		{"Write", WriteOperation{Bucket: "b", ObjectName: "o", ObjectSize: 16, MPUEnabled: true}, nil, []string{"put b/o"}, []string{"delete b/o"}},
+		{"List", ListOperation{Bucket: "b", ObjectName: "o", ObjectSize: 8}, nil, []string{"list b/o"}, []string{"put b/o", "delete b/o"}},
+		{"Delete", DeleteOperation{Bucket: "b", ObjectName: "o", ObjectSize: 8}, nil, []string{"delete b/o"}, []string{"put b/o"}},
+		{"Failed delete", DeleteOperation{Bucket: "b", ObjectName: "o"}, errors.New("failed"), []string{"delete b/o"}, []string{"put b/o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			measured := &recordingBackend{err: tt.backendErr}
+			house := &recordingBackend{}
+			backend, housekeepingBackend = measured, house
+			if err := tt.work.Prepare(); err != nil {
+				t.Fatalf("Prepare() error = %v", err)
+			}
+			if err := tt.work.Do(); !errors.Is(err, tt.backendErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.backendErr)
+			}
+			if err := tt.work.Clean(); err != nil {
+				t.Errorf("Clean() error = %v", err)
+			}
+			if !reflect.DeepEqual(measured.calls, tt.want) {
+				t.Errorf("Do() called %v, want %v", measured.calls, tt.want)
+			}
+			if !reflect.DeepEqual(house.calls, tt.wantHouse) {
+				t.Errorf("Prepare() and Clean() called %v, want %v", house.calls, tt.wantHouse)
+			}
+		})
+	}
+}
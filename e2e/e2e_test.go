@@ -0,0 +1,247 @@
+// Package e2e runs the gosbench server and driver binaries with real
+// configuration files against the in-memory S3 server of the s3stub package.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mulbc/gosbench/s3stub"
+)
+
+// The columns of the results CSV that the tests check
+const (
+	columnCompletedOperations = 4
+	columnFailedOperations    = 5
+	columnErrorClasses        = 19
+	columnMethod              = 20
+)
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	buildErr  error
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	binDir, err = ioutil.TempDir("", "gosbench-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(binDir)
+	os.Exit(code)
+}
+
+// buildBinaries builds the server and the driver once for all tests
+func buildBinaries(t *testing.T) (string, string) {
+	buildOnce.Do(func() {
+		var output []byte
+		cmd := exec.Command("go", "build", "-o", binDir, "github.com/mulbc/gosbench/server", "github.com/mulbc/gosbench/driver")
+		if output, buildErr = cmd.CombinedOutput(); buildErr != nil {
+			buildErr = fmt.Errorf("%v: %s", buildErr, output)
+		}
+	})
+	if buildErr != nil {
+		t.Fatalf("Unable to build the binaries: %v", buildErr)
+	}
+	return filepath.Join(binDir, "server"), filepath.Join(binDir, "driver")
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// runBenchmark runs the workload with a single driver against the stub
+// and returns the lines of the results CSV
+func runBenchmark(t *testing.T, stub *s3stub.Server, workload string) [][]string {
+	serverBinary, driverBinary := buildBinaries(t)
+	endpoint := httptest.NewServer(stub)
+	defer endpoint.Close()
+
+	dir := t.TempDir()
+	s3Config := fmt.Sprintf(`- access_key: access
+  secret_key: secret
+  region: us-east-1
+  endpoint: %s
+  max_retries: 0
+`, endpoint.URL)
+	for name, content := range map[string]string{"s3.yaml": s3Config, "workload.yaml": workload, "gosbench_results.csv": ""} {
+		// An existing results file is appended to - otherwise the server
+		// would look for one in /tmp first
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	serverPort := freePort(t)
+	var serverOutput, driverOutput bytes.Buffer
+	server := exec.CommandContext(ctx, serverBinary, "-c", "workload.yaml", "-s", "s3.yaml", "-p", strconv.Itoa(serverPort))
+	server.Dir, server.Stdout, server.Stderr = dir, &serverOutput, &serverOutput
+	driver := exec.CommandContext(ctx, driverBinary, "-s", fmt.Sprintf("127.0.0.1:%d", serverPort), "-p", strconv.Itoa(freePort(t)))
+	driver.Dir, driver.Stdout, driver.Stderr = dir, &driverOutput, &driverOutput
+	// The SDK cannot load a CA bundle of the environment into the instrumented
+	// transport of the driver - and the stub does not use TLS anyway
+	driver.Env = withoutVariable(os.Environ(), "AWS_CA_BUNDLE")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Unable to start the server: %v", err)
+	}
+	if err := driver.Start(); err != nil {
+		t.Fatalf("Unable to start the driver: %v", err)
+	}
+	// The driver exits when the server shuts it down after the last test -
+	// a server that still waits for it after that would wait forever
+	driverErr := driver.Wait()
+	time.AfterFunc(30*time.Second, cancel)
+	serverErr := server.Wait()
+	if serverErr != nil || driverErr != nil {
+		t.Fatalf("Benchmark failed - server: %v, driver: %v\nServer output:\n%s\nDriver output:\n%s", serverErr, driverErr, &serverOutput, &driverOutput)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "gosbench_results.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	results, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse the results: %v", err)
+	}
+	return results
+}
+
+// withoutVariable returns the environment without the given variable
+func withoutVariable(environment []string, name string) []string {
+	var filtered []string
+	for _, variable := range environment {
+		if !strings.HasPrefix(variable, name+"=") {
+			filtered = append(filtered, variable)
+		}
+	}
+	return filtered
+}
+
+const workload = `tests:
+  - name: e2e
+    read_weight: 25
+    write_weight: 25
+    list_weight: 25
+    delete_weight: 25
+    objects:
+      size_min: 1
+      size_max: 64
+      size_distribution: random
+      unit: KB
+      number_min: 8
+      number_max: 8
+      number_distribution: constant
+    buckets:
+      number_min: 2
+      number_max: 2
+      number_distribution: constant
+    bucket_prefix: gosbench-
+    object_prefix: obj
+    stop_with_ops: 40
+    workers: 2
+    drivers: 1
+    clean_after: true
+`
+
+// versionedWorkload extends the workload with versioned buckets,
+// which clean_after can only delete together with all versions
+const versionedWorkload = `    versioning:
+      enabled: true
+      versions: 2
+      read: specific
+      delete: specific
+`
+
+// lockedWorkload extends the workload with Object Lock buckets, whose
+// objects clean_after can only delete by bypassing their protection
+const lockedWorkload = `    object_lock:
+      enabled: true
+      mode: governance
+      retention: 1h
+      legal_hold: true
+`
+
+func TestBenchmark(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the end-to-end tests in short mode")
+	}
+	tests := []struct {
+		name           string
+		workload       string
+		injector       s3stub.FaultInjector
+		wantFailed     bool
+		wantErrorClass string
+		wantOperations []string
+	}{
+		{"clean run", workload, nil, false, "", nil},
+		{"throttled reads", workload, s3stub.ForOperations(s3stub.EveryNth(2, s3stub.SlowDown), "GetObject"), true, "SlowDown", nil},
+		{"versioned buckets", workload + versionedWorkload, nil, false, "", []string{"PutBucketVersioning", "ListObjectVersions", "DeleteObject"}},
+		{"locked buckets", workload + lockedWorkload, nil, false, "", []string{"ListObjectVersions", "PutObjectLegalHold", "DeleteObject"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stub := s3stub.New()
+			stub.SetFaultInjector(tt.injector)
+			var results, methods [][]string
+			for _, result := range runBenchmark(t, stub, tt.workload) {
+				if result[columnMethod] == "" {
+					results = append(results, result)
+				} else {
+					methods = append(methods, result)
+				}
+			}
+			if len(results) != 1 {
+				t.Fatalf("Got %d result lines, want 1: %v", len(results), results)
+			}
+			if len(methods) == 0 {
+				t.Errorf("Got no per-operation result lines")
+			}
+			result := results[0]
+			if completed, _ := strconv.ParseFloat(result[columnCompletedOperations], 64); completed == 0 {
+				t.Errorf("No completed operations in %v", result)
+			}
+			if failed, _ := strconv.ParseFloat(result[columnFailedOperations], 64); (failed > 0) != tt.wantFailed {
+				t.Errorf("%v failed operations - want failures: %v", failed, tt.wantFailed)
+			}
+			if !strings.Contains(result[columnErrorClasses], tt.wantErrorClass) {
+				t.Errorf("Error classes = %q, want %q", result[columnErrorClasses], tt.wantErrorClass)
+			}
+			for _, operation := range append([]string{"CreateBucket", "PutObject", "GetObject", "ListObjects", "DeleteObjects", "DeleteBucket"}, tt.wantOperations...) {
+				if stub.Requests(operation) == 0 {
+					t.Errorf("The benchmark did not send any %s request", operation)
+				}
+			}
+			if buckets := stub.Buckets(); len(buckets) != 0 {
+				t.Errorf("clean_after left the buckets %v", buckets)
+			}
+		})
+	}
+}
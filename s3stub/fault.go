@@ -0,0 +1,88 @@
+package s3stub
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Fault describes how the Server misbehaves for a single request
+type Fault struct {
+	// Delay is waited before the request is answered - or handled if no error is set
+	Delay time.Duration
+	// StatusCode, Code and Message are sent as S3 error instead of handling the request
+	StatusCode int
+	Code       string
+	Message    string
+	// Reset closes the connection without sending a response
+	Reset bool
+}
+
+// FaultInjector decides about the fault of a request. The operation is the
+// S3 operation name, e.g. PutObject or UploadPart. It returns nil to handle the
+// request normally.
+type FaultInjector func(operation string, r *http.Request) *Fault
+
+// apply injects the fault into the request.
+// It returns false if the request should be handled anyway.
+func (f *Fault) apply(w http.ResponseWriter, r *http.Request, requestID string) bool {
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			// The client is gone anyway
+			return true
+		}
+	}
+	if f.Reset {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		// Without access to the connection abort the response instead
+		panic(http.ErrAbortHandler)
+	}
+	if f.StatusCode == 0 {
+		return false
+	}
+	(&s3Error{status: f.StatusCode, code: f.Code, message: f.Message}).write(w, r, requestID)
+	return true
+}
+
+// Always injects the fault into every request
+func Always(fault Fault) FaultInjector {
+	return func(string, *http.Request) *Fault {
+		return &fault
+	}
+}
+
+// EveryNth injects the fault into every nth request - starting with the nth one
+func EveryNth(n int, fault Fault) FaultInjector {
+	var count uint64
+	return func(string, *http.Request) *Fault {
+		if n > 0 && atomic.AddUint64(&count, 1)%uint64(n) == 0 {
+			return &fault
+		}
+		return nil
+	}
+}
+
+// ForOperations restricts an injector to the requests of the given operations
+func ForOperations(injector FaultInjector, operations ...string) FaultInjector {
+	return func(operation string, r *http.Request) *Fault {
+		if !contains(operations, operation) {
+			return nil
+		}
+		return injector(operation, r)
+	}
+}
+
+// SlowDown is the fault of an S3 server that throttles the client
+var SlowDown = Fault{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown", Message: "Please reduce your request rate."}
+
+// InternalError is the fault of an S3 server with an internal error
+var InternalError = Fault{StatusCode: http.StatusInternalServerError, Code: "InternalError", Message: "We encountered an internal error. Please try again."}
@@ -0,0 +1,1364 @@
+// Package s3stub is an in-memory S3 compatible server for tests.
+// It implements the bucket, object, versioning, Object Lock and multipart operations that
+// gosbench uses with path-style addressing, and can inject faults into any of them.
+// Signatures are not verified.
+//
+// Start it with httptest:
+//
+//	stub := s3stub.New()
+//	server := httptest.NewServer(stub)
+//	defer server.Close()
+package s3stub
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMinPartSize is the minimum size of all but the last part of a multipart upload - as in AWS S3
+const DefaultMinPartSize = 5 * 1024 * 1024
+
+// Server is an in-memory S3 server. It implements http.Handler.
+type Server struct {
+	// MinPartSize is the minimum size of all but the last part of a multipart upload
+	MinPartSize int64
+
+	mutex         sync.Mutex
+	buckets       map[string]*bucket
+	uploads       map[string]*upload
+	nextID        uint64
+	requests      map[string]int
+	faultInjector FaultInjector
+}
+
+type bucket struct {
+	created time.Time
+	// versioning is Enabled or Suspended - or empty if it was never enabled
+	versioning string
+	// objectLock is set for buckets that were created with Object Lock
+	objectLock bool
+	// objects are the latest versions of all keys without a delete marker
+	objects map[string]*object
+	// versions are all versions of all keys, oldest first - once versioning was enabled
+	versions map[string][]*object
+}
+
+// The versioning states of a bucket and the version ID of unversioned objects
+const (
+	versioningEnabled   = "Enabled"
+	versioningSuspended = "Suspended"
+	nullVersion         = "null"
+)
+
+type object struct {
+	versionID    string
+	deleteMarker bool
+	data         []byte
+	etag         string
+	contentType  string
+	metadata     http.Header
+	lastModified time.Time
+	lock         objectLock
+}
+
+// objectLock is the retention and the legal hold of an object version
+type objectLock struct {
+	// mode is GOVERNANCE or COMPLIANCE - or empty without retention
+	mode        string
+	retainUntil time.Time
+	legalHold   bool
+}
+
+// The Object Lock retention modes
+const (
+	lockGovernance = "GOVERNANCE"
+	lockCompliance = "COMPLIANCE"
+)
+
+// ObjectVersion is a single version of an object
+type ObjectVersion struct {
+	VersionID    string
+	DeleteMarker bool
+	// LockMode is the retention mode of the version - or empty without retention
+	LockMode    string
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+type upload struct {
+	bucket      string
+	key         string
+	contentType string
+	metadata    http.Header
+	lock        objectLock
+	initiated   time.Time
+	parts       map[int]*part
+}
+
+type part struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// New returns an empty Server
+func New() *Server {
+	return &Server{
+		MinPartSize: DefaultMinPartSize,
+		buckets:     map[string]*bucket{},
+		uploads:     map[string]*upload{},
+		requests:    map[string]int{},
+	}
+}
+
+// SetFaultInjector sets the hook that decides about the faults of every request.
+// A nil injector disables the fault injection.
+func (s *Server) SetFaultInjector(injector FaultInjector) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faultInjector = injector
+}
+
+// Requests returns how many requests of the given operation were received -
+// including the ones that failed because of an injected fault
+func (s *Server) Requests(operation string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[operation]
+}
+
+// Buckets returns the names of all buckets in alphabetical order
+func (s *Server) Buckets() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedBucketNames(s.buckets)
+}
+
+// Keys returns the keys of all objects in the given bucket in alphabetical order.
+// It returns false if there is no such bucket.
+func (s *Server) Keys(bucketName string) ([]string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	return b.sortedKeys(), true
+}
+
+// Uploads returns the number of multipart uploads that were neither completed nor aborted
+func (s *Server) Uploads() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.uploads)
+}
+
+// Object returns the content of the given object and whether it exists
+func (s *Server) Object(bucketName string, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), o.data...), true
+}
+
+// Versions returns the versions of the given object, the latest one first.
+// Objects of buckets that were never versioned have a single null version.
+func (s *Server) Versions(bucketName string, key string) []ObjectVersion {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	history := b.history(key)
+	versions := make([]ObjectVersion, len(history))
+	for i, o := range history {
+		versions[len(history)-1-i] = ObjectVersion{
+			VersionID:    o.versionID,
+			DeleteMarker: o.deleteMarker,
+			LockMode:     o.lock.mode,
+			RetainUntil:  o.lock.retainUntil,
+			LegalHold:    o.lock.legalHold,
+		}
+	}
+	return versions
+}
+
+// ServeHTTP handles a single S3 request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key := splitPath(r.URL.Path)
+	operation := operationOf(r, bucketName, key)
+
+	s.mutex.Lock()
+	s.nextID++
+	requestID := fmt.Sprintf("%016X", s.nextID)
+	s.requests[operation]++
+	injector := s.faultInjector
+	s.mutex.Unlock()
+
+	w.Header().Set("x-amz-request-id", requestID)
+	if injector != nil {
+		if fault := injector(operation, r); fault != nil {
+			if handled := fault.apply(w, r, requestID); handled {
+				return
+			}
+		}
+	}
+
+	var err *s3Error
+	switch operation {
+	case "ListBuckets":
+		err = s.listBuckets(w)
+	case "CreateBucket":
+		err = s.createBucket(w, r, bucketName)
+	case "DeleteBucket":
+		err = s.deleteBucket(w, bucketName)
+	case "HeadBucket":
+		err = s.headBucket(w, bucketName)
+	case "PutBucketVersioning":
+		err = s.putBucketVersioning(w, r, bucketName)
+	case "GetBucketVersioning":
+		err = s.getBucketVersioning(w, bucketName)
+	case "ListObjectVersions":
+		err = s.listObjectVersions(w, r, bucketName)
+	case "ListObjects", "ListObjectsV2":
+		err = s.listObjects(w, r, bucketName, operation == "ListObjectsV2")
+	case "DeleteObjects":
+		err = s.deleteObjects(w, r, bucketName)
+	case "PutObject":
+		err = s.putObject(w, r, bucketName, key)
+	case "GetObject", "HeadObject":
+		err = s.getObject(w, r, bucketName, key)
+	case "DeleteObject":
+		err = s.deleteObject(w, r, bucketName, key)
+	case "PutObjectLegalHold":
+		err = s.putObjectLegalHold(w, r, bucketName, key)
+	case "CreateMultipartUpload":
+		err = s.createMultipartUpload(w, r, bucketName, key)
+	case "UploadPart", "UploadPartCopy":
+		err = s.uploadPart(w, r, bucketName, key, operation == "UploadPartCopy")
+	case "CompleteMultipartUpload":
+		err = s.completeMultipartUpload(w, r, bucketName, key)
+	case "AbortMultipartUpload":
+		err = s.abortMultipartUpload(w, r, bucketName, key)
+	case "ListParts":
+		err = s.listParts(w, r, bucketName, key)
+	default:
+		err = &s3Error{http.StatusNotImplemented, "NotImplemented", "The stub does not implement this request"}
+	}
+	if err != nil {
+		err.write(w, r, requestID)
+	}
+}
+
+// splitPath returns the bucket and the key of a path-style request
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// operationOf returns the S3 operation name of the request -
+// or an empty string if the request is not supported
+func operationOf(r *http.Request, bucketName string, key string) string {
+	query := r.URL.Query()
+	has := func(name string) bool {
+		_, ok := query[name]
+		return ok
+	}
+	only := func(names ...string) bool {
+		for name := range query {
+			if !contains(names, name) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case bucketName == "":
+		if r.Method == http.MethodGet && only() {
+			return "ListBuckets"
+		}
+	case key == "":
+		switch r.Method {
+		case http.MethodPut:
+			if only() {
+				return "CreateBucket"
+			}
+			if has("versioning") && only("versioning") {
+				return "PutBucketVersioning"
+			}
+		case http.MethodDelete:
+			if only() {
+				return "DeleteBucket"
+			}
+		case http.MethodHead:
+			if only() {
+				return "HeadBucket"
+			}
+		case http.MethodGet:
+			if only("prefix", "delimiter", "marker", "max-keys", "encoding-type") {
+				return "ListObjects"
+			}
+			if query.Get("list-type") == "2" && only("list-type", "prefix", "delimiter", "continuation-token", "start-after", "max-keys", "encoding-type", "fetch-owner") {
+				return "ListObjectsV2"
+			}
+			if has("versioning") && only("versioning") {
+				return "GetBucketVersioning"
+			}
+			if has("versions") && only("versions", "prefix", "key-marker", "version-id-marker", "max-keys", "encoding-type") {
+				return "ListObjectVersions"
+			}
+		case http.MethodPost:
+			if has("delete") && only("delete") {
+				return "DeleteObjects"
+			}
+		}
+	default:
+		switch r.Method {
+		case http.MethodPut:
+			isUploadPart := has("partNumber") && has("uploadId") && only("partNumber", "uploadId")
+			if r.Header.Get("x-amz-copy-source") != "" {
+				if isUploadPart {
+					return "UploadPartCopy"
+				}
+				return ""
+			}
+			if isUploadPart {
+				return "UploadPart"
+			}
+			if only() {
+				return "PutObject"
+			}
+			if has("legal-hold") && only("legal-hold", "versionId") {
+				return "PutObjectLegalHold"
+			}
+		case http.MethodGet:
+			if has("uploadId") && only("uploadId", "max-parts", "part-number-marker") {
+				return "ListParts"
+			}
+			if only("versionId") {
+				return "GetObject"
+			}
+		case http.MethodHead:
+			if only("versionId") {
+				return "HeadObject"
+			}
+		case http.MethodDelete:
+			if has("uploadId") && only("uploadId") {
+				return "AbortMultipartUpload"
+			}
+			if only("versionId") {
+				return "DeleteObject"
+			}
+		case http.MethodPost:
+			if has("uploads") && only("uploads") {
+				return "CreateMultipartUpload"
+			}
+			if has("uploadId") && only("uploadId") {
+				return "CompleteMultipartUpload"
+			}
+		}
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// history returns all versions of the key, oldest first
+func (b *bucket) history(key string) []*object {
+	if b.versioning == "" {
+		if o, ok := b.objects[key]; ok {
+			return []*object{o}
+		}
+		return nil
+	}
+	return b.versions[key]
+}
+
+// historyKeys returns the keys of all objects with versions in alphabetical order
+func (b *bucket) historyKeys() []string {
+	if b.versioning == "" {
+		return b.sortedKeys()
+	}
+	keys := make([]string, 0, len(b.versions))
+	for key := range b.versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// findVersion returns the given version of the key - or nil if there is no such version
+func (b *bucket) findVersion(key string, versionID string) *object {
+	for _, o := range b.history(key) {
+		if o.versionID == versionID {
+			return o
+		}
+	}
+	return nil
+}
+
+// addVersion makes the object the latest version of the key - the caller
+// must hold the mutex. Without versioning it replaces the object, while
+// suspended versioning only replaces the null version.
+func (s *Server) addVersion(b *bucket, key string, o *object) {
+	o.versionID = nullVersion
+	if b.versioning == "" {
+		if o.deleteMarker {
+			delete(b.objects, key)
+		} else {
+			b.objects[key] = o
+		}
+		return
+	}
+	history := b.versions[key]
+	if b.versioning == versioningEnabled {
+		s.nextID++
+		o.versionID = fmt.Sprintf("v%d", s.nextID)
+	} else {
+		history = withoutVersion(history, nullVersion)
+	}
+	b.versions[key] = append(history, o)
+	b.updateLatest(key)
+}
+
+// deleteVersion removes a single version of the key and returns it -
+// or nil if there is no such version. Versions that Object Lock protects
+// are kept. Only governance retention can be bypassed.
+func (b *bucket) deleteVersion(key string, versionID string, bypassGovernance bool) (*object, *s3Error) {
+	o := b.findVersion(key, versionID)
+	if o == nil {
+		return nil, nil
+	}
+	if o.lock.protects(bypassGovernance) {
+		return nil, errObjectLocked
+	}
+	if b.versioning == "" {
+		delete(b.objects, key)
+		return o, nil
+	}
+	b.versions[key] = withoutVersion(b.versions[key], versionID)
+	b.updateLatest(key)
+	return o, nil
+}
+
+// protects returns whether the lock prevents the deletion of its version
+func (l objectLock) protects(bypassGovernance bool) bool {
+	retained := l.mode != "" && time.Now().Before(l.retainUntil)
+	return l.legalHold || (retained && (l.mode == lockCompliance || !bypassGovernance))
+}
+
+// objectLockOf returns the Object Lock parameters of an upload request
+func objectLockOf(header http.Header) (objectLock, *s3Error) {
+	lock := objectLock{mode: header.Get("x-amz-object-lock-mode")}
+	until := header.Get("x-amz-object-lock-retain-until-date")
+	if (lock.mode == "") != (until == "") {
+		return lock, &s3Error{http.StatusBadRequest, "InvalidArgument", "x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied"}
+	}
+	if lock.mode != "" {
+		if lock.mode != lockGovernance && lock.mode != lockCompliance {
+			return lock, &s3Error{http.StatusBadRequest, "InvalidArgument", "Unknown wormMode directive."}
+		}
+		var err error
+		if lock.retainUntil, err = time.Parse(time.RFC3339, until); err != nil || !lock.retainUntil.After(time.Now()) {
+			return lock, &s3Error{http.StatusBadRequest, "InvalidArgument", "The retain until date must be in the future!"}
+		}
+	}
+	switch header.Get("x-amz-object-lock-legal-hold") {
+	case "", "OFF":
+	case "ON":
+		lock.legalHold = true
+	default:
+		return lock, &s3Error{http.StatusBadRequest, "InvalidArgument", "Legal Hold must be either of 'ON' or 'OFF'"}
+	}
+	return lock, nil
+}
+
+// isSet returns whether the upload has a retention or a legal hold
+func (l objectLock) isSet() bool {
+	return l.mode != "" || l.legalHold
+}
+
+// updateLatest points the objects at the latest version of the key
+func (b *bucket) updateLatest(key string) {
+	history := b.versions[key]
+	if len(history) == 0 {
+		delete(b.versions, key)
+	}
+	if len(history) == 0 || history[len(history)-1].deleteMarker {
+		delete(b.objects, key)
+		return
+	}
+	b.objects[key] = history[len(history)-1]
+}
+
+func withoutVersion(history []*object, versionID string) []*object {
+	filtered := make([]*object, 0, len(history))
+	for _, o := range history {
+		if o.versionID != versionID {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// deleteKey deletes the key like a DELETE without a version ID does and returns
+// the delete marker of versioned buckets - the caller must hold the mutex
+func (s *Server) deleteKey(b *bucket, key string) *object {
+	if b.versioning == "" {
+		delete(b.objects, key)
+		return nil
+	}
+	marker := &object{deleteMarker: true, lastModified: time.Now().UTC()}
+	s.addVersion(b, key, marker)
+	return marker
+}
+
+// getBucket returns the bucket with the given name - the caller must hold the mutex
+func (s *Server) getBucket(bucketName string) (*bucket, *s3Error) {
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, errNoSuchBucket
+	}
+	return b, nil
+}
+
+// getUpload returns the multipart upload of the request - the caller must hold the mutex
+func (s *Server) getUpload(r *http.Request, bucketName string, key string) (*upload, *s3Error) {
+	if _, err := s.getBucket(bucketName); err != nil {
+		return nil, err
+	}
+	u, ok := s.uploads[r.URL.Query().Get("uploadId")]
+	if !ok || u.bucket != bucketName || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter) *s3Error {
+	s.mutex.Lock()
+	result := listAllMyBucketsResult{}
+	for _, name := range sortedBucketNames(s.buckets) {
+		result.Buckets = append(result.Buckets, bucketEntry{Name: name, CreationDate: formatTime(s.buckets[name].created)})
+	}
+	s.mutex.Unlock()
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func sortedBucketNames(buckets map[string]*bucket) []string {
+	names := make([]string, 0, len(buckets))
+	for name := range buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, r *http.Request, bucketName string) *s3Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.buckets[bucketName]; ok {
+		return &s3Error{http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it."}
+	}
+	b := &bucket{created: time.Now().UTC(), objects: map[string]*object{}, versions: map[string][]*object{}}
+	// Object Lock enables versioning for good
+	if r.Header.Get("x-amz-bucket-object-lock-enabled") == "true" {
+		b.objectLock, b.versioning = true, versioningEnabled
+	}
+	s.buckets[bucketName] = b
+	w.Header().Set("Location", "/"+bucketName)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) deleteBucket(w http.ResponseWriter, bucketName string) *s3Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if len(b.objects) > 0 || len(b.versions) > 0 {
+		return &s3Error{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty"}
+	}
+	for id, u := range s.uploads {
+		if u.bucket == bucketName {
+			delete(s.uploads, id)
+		}
+	}
+	delete(s.buckets, bucketName)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) headBucket(w http.ResponseWriter, bucketName string) *s3Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.getBucket(bucketName); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucketName string, v2 bool) *s3Error {
+	query := r.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys, s3err := maxKeysOf(query)
+	if s3err != nil {
+		return s3err
+	}
+	marker := query.Get("marker")
+	if v2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			marker = token
+		}
+	}
+
+	s.mutex.Lock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	var contents []objectEntry
+	var commonPrefixes []commonPrefix
+	var last string
+	truncated := false
+	for _, key := range b.sortedKeys() {
+		if key <= marker || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" && strings.HasSuffix(marker, delimiter) && strings.HasPrefix(key, marker) {
+			// The marker is a common prefix of the previous page
+			continue
+		}
+		entryPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entryPrefix = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entryPrefix != "" && len(commonPrefixes) > 0 && commonPrefixes[len(commonPrefixes)-1].Prefix == entryPrefix {
+			continue
+		}
+		if len(contents)+len(commonPrefixes) == maxKeys {
+			truncated = true
+			break
+		}
+		if entryPrefix != "" {
+			commonPrefixes = append(commonPrefixes, commonPrefix{Prefix: entryPrefix})
+			last = entryPrefix
+			continue
+		}
+		o := b.objects[key]
+		contents = append(contents, objectEntry{
+			Key:          key,
+			LastModified: formatTime(o.lastModified),
+			ETag:         o.etag,
+			Size:         int64(len(o.data)),
+			StorageClass: "STANDARD",
+		})
+		last = key
+	}
+	s.mutex.Unlock()
+
+	if v2 {
+		result := listBucketV2Result{
+			Name:         bucketName,
+			Prefix:       prefix,
+			Delimiter:    delimiter,
+			StartAfter:   query.Get("start-after"),
+			MaxKeys:      maxKeys,
+			KeyCount:     len(contents) + len(commonPrefixes),
+			IsTruncated:  truncated,
+			Contents:     contents,
+			Prefixes:     commonPrefixes,
+			Continuation: query.Get("continuation-token"),
+		}
+		if truncated {
+			result.NextContinuation = last
+		}
+		writeXML(w, http.StatusOK, result)
+		return nil
+	}
+	result := listBucketResult{
+		Name:        bucketName,
+		Prefix:      prefix,
+		Delimiter:   delimiter,
+		Marker:      marker,
+		MaxKeys:     maxKeys,
+		IsTruncated: truncated,
+		Contents:    contents,
+		Prefixes:    commonPrefixes,
+	}
+	if truncated {
+		result.NextMarker = last
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// maxKeysOf returns the max-keys of a listing - 1000 by default
+func maxKeysOf(query url.Values) (int, *s3Error) {
+	value := query.Get("max-keys")
+	if value == "" {
+		return 1000, nil
+	}
+	maxKeys, err := strconv.Atoi(value)
+	if err != nil || maxKeys < 0 {
+		return 0, &s3Error{http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer"}
+	}
+	return maxKeys, nil
+}
+
+func (s *Server) putBucketVersioning(w http.ResponseWriter, r *http.Request, bucketName string) *s3Error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	// Clients do not need to send the namespace of the responses
+	var configuration struct {
+		Status string `xml:"Status"`
+	}
+	if xml.Unmarshal(body, &configuration) != nil ||
+		(configuration.Status != versioningEnabled && configuration.Status != versioningSuspended) {
+		return errMalformedXML
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if b.objectLock && configuration.Status != versioningEnabled {
+		return &s3Error{http.StatusConflict, "InvalidBucketState", "An Object Lock configuration is present on this bucket, so the versioning state cannot be changed."}
+	}
+	if b.versioning == "" {
+		// The existing objects become the null versions
+		for key, o := range b.objects {
+			b.versions[key] = []*object{o}
+		}
+	}
+	b.versioning = configuration.Status
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) getBucketVersioning(w http.ResponseWriter, bucketName string) *s3Error {
+	s.mutex.Lock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	result := versioningConfiguration{Status: b.versioning}
+	s.mutex.Unlock()
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// listObjectVersions lists the versions of all keys in alphabetical order
+// and the versions of every key from the latest to the oldest one
+func (s *Server) listObjectVersions(w http.ResponseWriter, r *http.Request, bucketName string) *s3Error {
+	query := r.URL.Query()
+	prefix, keyMarker, versionMarker := query.Get("prefix"), query.Get("key-marker"), query.Get("version-id-marker")
+	maxKeys, err := maxKeysOf(query)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	result := listVersionsResult{Name: bucketName, Prefix: prefix, KeyMarker: keyMarker, VersionIDMarker: versionMarker, MaxKeys: maxKeys}
+	var lastKey, lastVersion string
+	count := 0
+keys:
+	for _, key := range b.historyKeys() {
+		if key < keyMarker || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		// The versions of the key marker continue after the version marker
+		skip := key == keyMarker
+		history := b.history(key)
+		for i := len(history) - 1; i >= 0; i-- {
+			o := history[i]
+			if skip {
+				// Without a version marker all versions of the key marker were listed before
+				skip = versionMarker == "" || o.versionID != versionMarker
+				continue
+			}
+			if count == maxKeys {
+				result.IsTruncated, result.NextKeyMarker, result.NextVersionIDMarker = true, lastKey, lastVersion
+				break keys
+			}
+			latest := i == len(history)-1
+			if o.deleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, deleteMarkerEntry{
+					Key:          key,
+					VersionID:    o.versionID,
+					IsLatest:     latest,
+					LastModified: formatTime(o.lastModified),
+				})
+			} else {
+				result.Versions = append(result.Versions, versionEntry{
+					Key:          key,
+					VersionID:    o.versionID,
+					IsLatest:     latest,
+					LastModified: formatTime(o.lastModified),
+					ETag:         o.etag,
+					Size:         int64(len(o.data)),
+					StorageClass: "STANDARD",
+				})
+			}
+			count++
+			lastKey, lastVersion = key, o.versionID
+		}
+	}
+	s.mutex.Unlock()
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucketName string) *s3Error {
+	var request deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		return errMalformedXML
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	bypassGovernance := bypassesGovernance(r)
+	result := deleteResult{}
+	for _, entry := range request.Objects {
+		deleted := deletedEntry{Key: entry.Key, VersionID: entry.VersionID}
+		if entry.VersionID != "" {
+			o, err := b.deleteVersion(entry.Key, entry.VersionID, bypassGovernance)
+			if err != nil {
+				// Errors are reported in quiet mode as well
+				result.Errors = append(result.Errors, deleteErrorEntry{Key: entry.Key, VersionID: entry.VersionID, Code: err.code, Message: err.message})
+				continue
+			}
+			if o != nil && o.deleteMarker {
+				deleted.DeleteMarker, deleted.DeleteMarkerVersionID = true, o.versionID
+			}
+		} else if marker := s.deleteKey(b, entry.Key); marker != nil {
+			deleted.DeleteMarker, deleted.DeleteMarkerVersionID = true, marker.versionID
+		}
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted)
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	lock, err := objectLockOf(r.Header)
+	if err != nil {
+		return err
+	}
+	if lock.isSet() && r.Header.Get("Content-MD5") == "" {
+		return &s3Error{http.StatusBadRequest, "InvalidRequest", "Content-MD5 HTTP header is required for Put Object requests with Object Lock parameters"}
+	}
+	data, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if lock.isSet() && !b.objectLock {
+		return errNoObjectLock
+	}
+	o := &object{
+		data:         data,
+		etag:         etag(data),
+		contentType:  r.Header.Get("Content-Type"),
+		metadata:     userMetadata(r.Header),
+		lastModified: time.Now().UTC(),
+		lock:         lock,
+	}
+	s.addVersion(b, key, o)
+	if b.versioning != "" {
+		w.Header().Set("x-amz-version-id", o.versionID)
+	}
+	w.Header().Set("ETag", o.etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	s.mutex.Lock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	versioned := b.versioning != ""
+	versionID := r.URL.Query().Get("versionId")
+	o, ok := b.objects[key]
+	if versionID != "" {
+		o = b.findVersion(key, versionID)
+		ok = o != nil
+	}
+	history := b.history(key)
+	s.mutex.Unlock()
+
+	header := w.Header()
+	switch {
+	case !ok && versionID != "":
+		return errNoSuchVersion
+	case !ok:
+		if len(history) > 0 && history[len(history)-1].deleteMarker {
+			header.Set("x-amz-delete-marker", "true")
+		}
+		return errNoSuchKey
+	case o.deleteMarker:
+		header.Set("x-amz-delete-marker", "true")
+		header.Set("x-amz-version-id", o.versionID)
+		return &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	}
+	if versioned {
+		header.Set("x-amz-version-id", o.versionID)
+	}
+
+	for name, values := range o.metadata {
+		header[name] = values
+	}
+	if o.contentType != "" {
+		header.Set("Content-Type", o.contentType)
+	}
+	header.Set("ETag", o.etag)
+	header.Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	if o.lock.mode != "" {
+		header.Set("x-amz-object-lock-mode", o.lock.mode)
+		header.Set("x-amz-object-lock-retain-until-date", o.lock.retainUntil.Format(time.RFC3339))
+	}
+	if o.lock.legalHold {
+		header.Set("x-amz-object-lock-legal-hold", "ON")
+	}
+
+	data, status := o.data, http.StatusOK
+	if value := r.Header.Get("Range"); value != "" {
+		start, end, ok := parseRange(value, int64(len(o.data)))
+		if !ok {
+			return &s3Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+		}
+		data, status = o.data[start:end+1], http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(o.data)))
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+	return nil
+}
+
+// parseRange returns the inclusive byte range of a single range Range header
+func parseRange(value string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(value, "bytes=")
+	if spec == value || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return 0, 0, false
+	}
+	first, last := spec[:dash], spec[dash+1:]
+	if first == "" {
+		// A suffix range of the last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	// Deleting a version that does not exist succeeds, as in S3
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		o, err := b.deleteVersion(key, versionID, bypassesGovernance(r))
+		if err != nil {
+			return err
+		}
+		if o != nil && o.deleteMarker {
+			w.Header().Set("x-amz-delete-marker", "true")
+		}
+		w.Header().Set("x-amz-version-id", versionID)
+	} else if marker := s.deleteKey(b, key); marker != nil {
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", marker.versionID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// bypassesGovernance returns whether a delete bypasses the governance retention
+func bypassesGovernance(r *http.Request) bool {
+	return r.Header.Get("x-amz-bypass-governance-retention") == "true"
+}
+
+// putObjectLegalHold sets or removes the legal hold of the latest or the given version
+func (s *Server) putObjectLegalHold(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var legalHold struct {
+		Status string `xml:"Status"`
+	}
+	if xml.Unmarshal(body, &legalHold) != nil || (legalHold.Status != "ON" && legalHold.Status != "OFF") {
+		return errMalformedXML
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if !b.objectLock {
+		return errNoObjectLock
+	}
+	o, ok := b.objects[key]
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		if o = b.findVersion(key, versionID); o == nil {
+			return errNoSuchVersion
+		}
+	} else if !ok {
+		return errNoSuchKey
+	}
+	if o.deleteMarker {
+		return &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	}
+	o.lock.legalHold = legalHold.Status == "ON"
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	lock, err := objectLockOf(r.Header)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	b, err := s.getBucket(bucketName)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	if lock.isSet() && !b.objectLock {
+		s.mutex.Unlock()
+		return errNoObjectLock
+	}
+	s.nextID++
+	uploadID := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[uploadID] = &upload{
+		bucket:      bucketName,
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		metadata:    userMetadata(r.Header),
+		lock:        lock,
+		initiated:   time.Now().UTC(),
+		parts:       map[int]*part{},
+	}
+	s.mutex.Unlock()
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Bucket: bucketName, Key: key, UploadID: uploadID})
+	return nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucketName string, key string, copy bool) *s3Error {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		return &s3Error{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive"}
+	}
+	var data []byte
+	var s3err *s3Error
+	if !copy {
+		if data, s3err = readBody(r); s3err != nil {
+			return s3err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	u, s3err := s.getUpload(r, bucketName, key)
+	if s3err != nil {
+		return s3err
+	}
+	if !copy && u.lock.isSet() && r.Header.Get("Content-MD5") == "" {
+		return &s3Error{http.StatusBadRequest, "InvalidRequest", "Content-MD5 HTTP header is required for Put Part requests with Object Lock parameters"}
+	}
+	if copy {
+		if data, s3err = s.copySource(r); s3err != nil {
+			return s3err
+		}
+	}
+	p := &part{data: data, etag: etag(data), lastModified: time.Now().UTC()}
+	u.parts[partNumber] = p
+	if copy {
+		writeXML(w, http.StatusOK, copyPartResult{ETag: p.etag, LastModified: formatTime(p.lastModified)})
+		return nil
+	}
+	w.Header().Set("ETag", p.etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// copySource returns the content of the x-amz-copy-source object of the request -
+// limited to its x-amz-copy-source-range. The caller must hold the mutex.
+func (s *Server) copySource(r *http.Request) ([]byte, *s3Error) {
+	source, err := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+	if err != nil {
+		return nil, &s3Error{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey"}
+	}
+	// Versions of the source are not supported
+	source = strings.SplitN(source, "?", 2)[0]
+	sourceBucket, sourceKey := splitPath(source)
+	if sourceBucket == "" || sourceKey == "" {
+		return nil, &s3Error{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey"}
+	}
+	b, s3err := s.getBucket(sourceBucket)
+	if s3err != nil {
+		return nil, s3err
+	}
+	o, ok := b.objects[sourceKey]
+	if !ok {
+		return nil, errNoSuchKey
+	}
+	value := r.Header.Get("x-amz-copy-source-range")
+	if value == "" {
+		return o.data, nil
+	}
+	start, end, ok := parseCopyRange(value, int64(len(o.data)))
+	if !ok {
+		return nil, &s3Error{http.StatusBadRequest, "InvalidArgument", "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy"}
+	}
+	return o.data[start : end+1], nil
+}
+
+// parseCopyRange returns the inclusive byte range of a copy - unlike
+// Range headers it needs a start and an end within the source object
+func parseCopyRange(value string, size int64) (int64, int64, bool) {
+	var start, end int64
+	if n, err := fmt.Sscanf(value, "bytes=%d-%d", &start, &end); err != nil || n != 2 {
+		return 0, 0, false
+	}
+	if start < 0 || end < start || end >= size {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	var request completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		return errMalformedXML
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	u, err := s.getUpload(r, bucketName, key)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	var checksums []byte
+	for i, completed := range request.Parts {
+		if i > 0 && completed.PartNumber <= request.Parts[i-1].PartNumber {
+			return &s3Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order"}
+		}
+		p, ok := u.parts[completed.PartNumber]
+		if !ok || strings.Trim(completed.ETag, `"`) != strings.Trim(p.etag, `"`) {
+			return &s3Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found"}
+		}
+		if i < len(request.Parts)-1 && int64(len(p.data)) < s.MinPartSize {
+			return &s3Error{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size"}
+		}
+		data = append(data, p.data...)
+		checksum, _ := hex.DecodeString(strings.Trim(p.etag, `"`))
+		checksums = append(checksums, checksum...)
+	}
+	sum := md5.Sum(checksums)
+	o := &object{
+		data:         data,
+		etag:         fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(request.Parts)),
+		contentType:  u.contentType,
+		metadata:     u.metadata,
+		lastModified: time.Now().UTC(),
+		lock:         u.lock,
+	}
+	b := s.buckets[bucketName]
+	s.addVersion(b, key, o)
+	if b.versioning != "" {
+		w.Header().Set("x-amz-version-id", o.versionID)
+	}
+	delete(s.uploads, r.URL.Query().Get("uploadId"))
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: "/" + bucketName + "/" + key,
+		Bucket:   bucketName,
+		Key:      key,
+		ETag:     o.etag,
+	})
+	return nil
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.getUpload(r, bucketName, key); err != nil {
+		return err
+	}
+	delete(s.uploads, r.URL.Query().Get("uploadId"))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) listParts(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	s.mutex.Lock()
+	u, err := s.getUpload(r, bucketName, key)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	numbers := make([]int, 0, len(u.parts))
+	for number := range u.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	result := listPartsResult{Bucket: bucketName, Key: key, UploadID: r.URL.Query().Get("uploadId")}
+	for _, number := range numbers {
+		p := u.parts[number]
+		result.Parts = append(result.Parts, partEntry{
+			PartNumber:   number,
+			LastModified: formatTime(p.lastModified),
+			ETag:         p.etag,
+			Size:         int64(len(p.data)),
+		})
+	}
+	s.mutex.Unlock()
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// readBody reads the body of an upload and verifies its Content-MD5 header
+func readBody(r *http.Request) ([]byte, *s3Error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, &s3Error{http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header"}
+	}
+	if value := r.Header.Get("Content-MD5"); value != "" {
+		sum := md5.Sum(data)
+		if value != base64.StdEncoding.EncodeToString(sum[:]) {
+			return nil, &s3Error{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received"}
+		}
+	}
+	return data, nil
+}
+
+// userMetadata returns the x-amz-meta-* headers of a request
+func userMetadata(header http.Header) http.Header {
+	metadata := http.Header{}
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[name] = values
+		}
+	}
+	return metadata
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func writeXML(w http.ResponseWriter, status int, value interface{}) {
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	if err := xml.NewEncoder(&body).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	w.WriteHeader(status)
+	_, _ = w.Write(body.Bytes())
+}
@@ -0,0 +1,514 @@
+package s3stub
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_operationOf(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		header http.Header
+		want   string
+	}{
+		{http.MethodGet, "/", nil, "ListBuckets"},
+		{http.MethodPut, "/bucket", nil, "CreateBucket"},
+		{http.MethodPut, "/bucket?versioning", nil, "PutBucketVersioning"},
+		{http.MethodGet, "/bucket?versioning", nil, "GetBucketVersioning"},
+		{http.MethodPut, "/bucket?tagging", nil, ""},
+		{http.MethodDelete, "/bucket", nil, "DeleteBucket"},
+		{http.MethodHead, "/bucket", nil, "HeadBucket"},
+		{http.MethodGet, "/bucket?prefix=obj&marker=obj1", nil, "ListObjects"},
+		{http.MethodGet, "/bucket?list-type=2&continuation-token=x", nil, "ListObjectsV2"},
+		{http.MethodGet, "/bucket?uploads", nil, ""},
+		{http.MethodGet, "/bucket?versions&prefix=obj&key-marker=obj1&version-id-marker=v2", nil, "ListObjectVersions"},
+		{http.MethodPost, "/bucket?delete", nil, "DeleteObjects"},
+		{http.MethodPut, "/bucket/dir/obj", nil, "PutObject"},
+		{http.MethodPut, "/bucket/obj", http.Header{"X-Amz-Copy-Source": {"/bucket/other"}}, ""},
+		{http.MethodGet, "/bucket/obj", nil, "GetObject"},
+		{http.MethodHead, "/bucket/obj", nil, "HeadObject"},
+		{http.MethodDelete, "/bucket/obj", nil, "DeleteObject"},
+		{http.MethodGet, "/bucket/obj?versionId=v1", nil, "GetObject"},
+		{http.MethodDelete, "/bucket/obj?versionId=v1", nil, "DeleteObject"},
+		{http.MethodPut, "/bucket/obj?legal-hold&versionId=v1", nil, "PutObjectLegalHold"},
+		{http.MethodPost, "/bucket/obj?uploads", nil, "CreateMultipartUpload"},
+		{http.MethodPut, "/bucket/obj?partNumber=1&uploadId=u", nil, "UploadPart"},
+		{http.MethodPut, "/bucket/obj?partNumber=1&uploadId=u", http.Header{"X-Amz-Copy-Source": {"/bucket/other"}}, "UploadPartCopy"},
+		{http.MethodPost, "/bucket/obj?uploadId=u", nil, "CompleteMultipartUpload"},
+		{http.MethodDelete, "/bucket/obj?uploadId=u", nil, "AbortMultipartUpload"},
+		{http.MethodGet, "/bucket/obj?uploadId=u", nil, "ListParts"},
+		{http.MethodGet, "/bucket/obj?tagging", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			bucketName, key := splitPath(r.URL.Path)
+			if got := operationOf(r, bucketName, key); got != tt.want {
+				t.Errorf("operationOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStart int64
+		wantEnd   int64
+		wantOK    bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=5-", 5, 99, true},
+		{"bytes=90-200", 90, 99, true},
+		{"bytes=-10", 90, 99, true},
+		{"bytes=-200", 0, 99, true},
+		{"bytes=100-", 0, 0, false},
+		{"bytes=9-5", 0, 0, false},
+		{"bytes=0-1,5-6", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, end, ok := parseRange(tt.value, 100)
+			if start != tt.wantStart || end != tt.wantEnd || ok != tt.wantOK {
+				t.Errorf("parseRange() = %d, %d, %v, want %d, %d, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+		})
+	}
+}
+
+// do sends a request to the stub and returns the status and body of the response
+func do(t *testing.T, s *Server, method string, target string, body string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w.Code, w.Body.String()
+}
+
+func Test_ServerObjects(t *testing.T) {
+	s := New()
+	if status, _ := do(t, s, http.MethodPut, "/bucket/obj", "data"); status != http.StatusNotFound {
+		t.Errorf("PutObject without bucket: status = %d, want 404", status)
+	}
+	if status, _ := do(t, s, http.MethodPut, "/bucket", ""); status != http.StatusOK {
+		t.Fatalf("CreateBucket: status = %d", status)
+	}
+	if status, body := do(t, s, http.MethodPut, "/bucket", ""); status != http.StatusConflict || !strings.Contains(body, "BucketAlreadyOwnedByYou") {
+		t.Errorf("CreateBucket again: status = %d, body = %s", status, body)
+	}
+	for _, key := range []string{"a/1", "a/2", "b", "c/1"} {
+		if status, _ := do(t, s, http.MethodPut, "/bucket/"+key, "content of "+key); status != http.StatusOK {
+			t.Fatalf("PutObject %s: status = %d", key, status)
+		}
+	}
+	if data, ok := s.Object("bucket", "b"); !ok || string(data) != "content of b" {
+		t.Errorf("Object() = %q, %v", data, ok)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/bucket/b", nil)
+	r.Header.Set("Range", "bytes=3-6")
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "tent" || w.Header().Get("Content-Range") != "bytes 3-6/12" {
+		t.Errorf("ranged GetObject = %d %q %q", w.Code, w.Body.String(), w.Header().Get("Content-Range"))
+	}
+	if status, body := do(t, s, http.MethodHead, "/bucket/missing", ""); status != http.StatusNotFound || body != "" {
+		t.Errorf("HeadObject of missing object = %d %q", status, body)
+	}
+
+	// Page through the bucket with a delimiter - the common prefixes count as single entries
+	var pages [][]string
+	marker := ""
+	for {
+		_, body := do(t, s, http.MethodGet, "/bucket?delimiter=/&max-keys=2&marker="+marker, "")
+		var result listBucketResult
+		if err := xml.Unmarshal([]byte(body), &result); err != nil {
+			t.Fatalf("Unable to parse list result: %v", err)
+		}
+		var page []string
+		for _, p := range result.Prefixes {
+			page = append(page, p.Prefix)
+		}
+		for _, c := range result.Contents {
+			page = append(page, c.Key)
+		}
+		pages = append(pages, page)
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+	if want := [][]string{{"a/", "b"}, {"c/"}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("list pages = %v, want %v", pages, want)
+	}
+
+	if status, body := do(t, s, http.MethodDelete, "/bucket", ""); status != http.StatusConflict || !strings.Contains(body, "BucketNotEmpty") {
+		t.Errorf("DeleteBucket with objects = %d %s", status, body)
+	}
+	do(t, s, http.MethodPost, "/bucket?delete", "<Delete><Object><Key>a/1</Key></Object><Object><Key>a/2</Key></Object></Delete>")
+	do(t, s, http.MethodDelete, "/bucket/b", "")
+	if keys, _ := s.Keys("bucket"); !reflect.DeepEqual(keys, []string{"c/1"}) {
+		t.Errorf("Keys() after deletion = %v", keys)
+	}
+	do(t, s, http.MethodDelete, "/bucket/c/1", "")
+	if status, _ := do(t, s, http.MethodDelete, "/bucket", ""); status != http.StatusNoContent {
+		t.Errorf("DeleteBucket: status = %d", status)
+	}
+	if buckets := s.Buckets(); len(buckets) != 0 {
+		t.Errorf("Buckets() = %v after deletion", buckets)
+	}
+}
+
+func Test_ServerMultipartUpload(t *testing.T) {
+	s := New()
+	s.MinPartSize = 4
+	do(t, s, http.MethodPut, "/bucket", "")
+	_, body := do(t, s, http.MethodPost, "/bucket/obj?uploads", "")
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal([]byte(body), &initiated); err != nil || initiated.UploadID == "" {
+		t.Fatalf("Unable to parse upload ID from %s: %v", body, err)
+	}
+	upload := "/bucket/obj?uploadId=" + initiated.UploadID
+	etags := map[string]string{}
+	for number, content := range map[string]string{"1": "abcd", "2": "ef"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPut, upload+"&partNumber="+number, strings.NewReader(content)))
+		etags[number] = w.Header().Get("ETag")
+	}
+	// The third part is copied from another object
+	do(t, s, http.MethodPut, "/bucket/source", "wxyz")
+	r := httptest.NewRequest(http.MethodPut, upload+"&partNumber=3", nil)
+	r.Header.Set("x-amz-copy-source", "bucket/source")
+	r.Header.Set("x-amz-copy-source-range", "bytes=2-3")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	var copied copyPartResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &copied); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("UploadPartCopy = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	etags["3"] = copied.ETag
+	if s.Uploads() != 1 {
+		t.Errorf("Uploads() = %d, want 1", s.Uploads())
+	}
+	complete := func(numbers ...string) string {
+		body := "<CompleteMultipartUpload>"
+		for _, number := range numbers {
+			body += "<Part><PartNumber>" + number + "</PartNumber><ETag>" + etags[number] + "</ETag></Part>"
+		}
+		return body + "</CompleteMultipartUpload>"
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"repeated part", complete("1", "1"), "InvalidPartOrder"},
+		{"unknown part", complete("1", "4"), "InvalidPart"},
+		{"small part", complete("2", "3"), "EntityTooSmall"},
+		{"skipped part", complete("1", "3"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, s, http.MethodPost, upload, tt.body)
+			if tt.wantCode != "" {
+				if status != http.StatusBadRequest || !strings.Contains(body, tt.wantCode) {
+					t.Errorf("status = %d, body = %s, want %s", status, body, tt.wantCode)
+				}
+				return
+			}
+			var result completeMultipartUploadResult
+			if err := xml.Unmarshal([]byte(body), &result); err != nil || !strings.HasSuffix(result.ETag, `-2"`) {
+				t.Errorf("Unexpected result %s: %v", body, err)
+			}
+			if data, _ := s.Object("bucket", "obj"); string(data) != "abcdyz" {
+				t.Errorf("Object() = %q, want abcdyz", data)
+			}
+			if s.Uploads() != 0 {
+				t.Errorf("Uploads() = %d after the completion", s.Uploads())
+			}
+		})
+	}
+	if status, body := do(t, s, http.MethodDelete, upload, ""); status != http.StatusNotFound || !strings.Contains(body, "NoSuchUpload") {
+		t.Errorf("Abort of completed upload = %d %s", status, body)
+	}
+}
+
+func Test_ServerVersioning(t *testing.T) {
+	s := New()
+	do(t, s, http.MethodPut, "/bucket", "")
+	do(t, s, http.MethodPut, "/bucket/obj", "unversioned")
+	if status, _ := do(t, s, http.MethodPut, "/bucket?versioning", "<VersioningConfiguration><Status>On</Status></VersioningConfiguration>"); status != http.StatusBadRequest {
+		t.Errorf("PutBucketVersioning with invalid status = %d, want 400", status)
+	}
+	if status, _ := do(t, s, http.MethodPut, "/bucket?versioning", "<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>"); status != http.StatusOK {
+		t.Fatalf("PutBucketVersioning = %d", status)
+	}
+	if _, body := do(t, s, http.MethodGet, "/bucket?versioning", ""); !strings.Contains(body, "<Status>Enabled</Status>") {
+		t.Errorf("GetBucketVersioning = %s", body)
+	}
+
+	var versionIDs []string
+	for _, content := range []string{"first", "second"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/bucket/obj", strings.NewReader(content)))
+		versionIDs = append(versionIDs, w.Header().Get("x-amz-version-id"))
+	}
+	if _, body := do(t, s, http.MethodGet, "/bucket/obj", ""); body != "second" {
+		t.Errorf("GetObject of the latest version = %q", body)
+	}
+	if _, body := do(t, s, http.MethodGet, "/bucket/obj?versionId="+versionIDs[0], ""); body != "first" {
+		t.Errorf("GetObject of the first version = %q", body)
+	}
+	if _, body := do(t, s, http.MethodGet, "/bucket/obj?versionId=null", ""); body != "unversioned" {
+		t.Errorf("GetObject of the null version = %q", body)
+	}
+
+	// Deleting the key leaves a delete marker in front of the versions
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/bucket/obj", nil))
+	marker := w.Header().Get("x-amz-version-id")
+	if w.Header().Get("x-amz-delete-marker") != "true" || marker == "" {
+		t.Errorf("DeleteObject did not create a delete marker: %v", w.Header())
+	}
+	if status, _ := do(t, s, http.MethodGet, "/bucket/obj", ""); status != http.StatusNotFound {
+		t.Errorf("GetObject behind the delete marker = %d, want 404", status)
+	}
+	if status, _ := do(t, s, http.MethodGet, "/bucket/obj?versionId="+marker, ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("GetObject of the delete marker = %d, want 405", status)
+	}
+	if status, _ := do(t, s, http.MethodGet, "/bucket/obj?versionId=missing", ""); status != http.StatusNotFound {
+		t.Errorf("GetObject of a missing version = %d, want 404", status)
+	}
+	want := []ObjectVersion{{VersionID: marker, DeleteMarker: true}, {VersionID: versionIDs[1]}, {VersionID: versionIDs[0]}, {VersionID: "null"}}
+	if got := s.Versions("bucket", "obj"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Versions() = %v, want %v", got, want)
+	}
+
+	// Page through all versions, as the cleanup does
+	do(t, s, http.MethodPut, "/bucket/other", "other")
+	var listed []string
+	keyMarker, versionMarker := "", ""
+	for {
+		_, body := do(t, s, http.MethodGet, "/bucket?versions&max-keys=2&key-marker="+keyMarker+"&version-id-marker="+versionMarker, "")
+		var result listVersionsResult
+		if err := xml.Unmarshal([]byte(body), &result); err != nil {
+			t.Fatalf("Unable to parse the versions: %v", err)
+		}
+		for _, m := range result.DeleteMarkers {
+			listed = append(listed, m.Key+"@"+m.VersionID)
+		}
+		for _, v := range result.Versions {
+			listed = append(listed, v.Key+"@"+v.VersionID)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		keyMarker, versionMarker = result.NextKeyMarker, result.NextVersionIDMarker
+	}
+	if len(listed) != 5 || !strings.HasPrefix(listed[4], "other@") {
+		t.Errorf("Listed versions = %v", listed)
+	}
+
+	if status, _ := do(t, s, http.MethodDelete, "/bucket", ""); status != http.StatusConflict {
+		t.Errorf("DeleteBucket with versions = %d, want 409", status)
+	}
+	// Removing the delete marker restores the latest version
+	do(t, s, http.MethodDelete, "/bucket/obj?versionId="+marker, "")
+	if _, body := do(t, s, http.MethodGet, "/bucket/obj", ""); body != "second" {
+		t.Errorf("GetObject after removing the delete marker = %q", body)
+	}
+	body := "<Delete>"
+	for _, versionID := range append(versionIDs, "null") {
+		body += "<Object><Key>obj</Key><VersionId>" + versionID + "</VersionId></Object>"
+	}
+	do(t, s, http.MethodPost, "/bucket?delete", body+"<Object><Key>other</Key><VersionId>null</VersionId></Object></Delete>")
+	if status, _ := do(t, s, http.MethodGet, "/bucket/other", ""); status != http.StatusOK {
+		t.Errorf("GetObject after deleting a missing version = %d", status)
+	}
+	other := s.Versions("bucket", "other")
+	do(t, s, http.MethodDelete, "/bucket/other?versionId="+other[0].VersionID, "")
+	if status, _ := do(t, s, http.MethodDelete, "/bucket", ""); status != http.StatusNoContent {
+		t.Errorf("DeleteBucket without versions = %d", status)
+	}
+}
+
+func Test_ServerObjectLock(t *testing.T) {
+	s := New()
+	serve := func(method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	lockHeader := func(mode string, retention time.Duration, legalHold string) http.Header {
+		header := http.Header{"Content-Md5": {"TO8vMKx9M0GdAMHZOgkAlQ=="}}
+		if mode != "" {
+			header.Set("x-amz-object-lock-mode", mode)
+			header.Set("x-amz-object-lock-retain-until-date", time.Now().Add(retention).UTC().Format(time.RFC3339))
+		}
+		if legalHold != "" {
+			header.Set("x-amz-object-lock-legal-hold", legalHold)
+		}
+		return header
+	}
+
+	do(t, s, http.MethodPut, "/plain", "")
+	if w := serve(http.MethodPut, "/plain/obj", "locked", lockHeader(lockGovernance, time.Hour, "")); w.Code != http.StatusBadRequest {
+		t.Errorf("PutObject with Object Lock into a bucket without it = %d, want 400", w.Code)
+	}
+	serve(http.MethodPut, "/bucket", "", http.Header{"X-Amz-Bucket-Object-Lock-Enabled": {"true"}})
+	if _, body := do(t, s, http.MethodGet, "/bucket?versioning", ""); !strings.Contains(body, "<Status>Enabled</Status>") {
+		t.Errorf("GetBucketVersioning of a locked bucket = %s", body)
+	}
+	if status, _ := do(t, s, http.MethodPut, "/bucket?versioning", "<VersioningConfiguration><Status>Suspended</Status></VersioningConfiguration>"); status != http.StatusConflict {
+		t.Errorf("Suspending the versioning of a locked bucket = %d, want 409", status)
+	}
+	withoutMD5 := lockHeader(lockGovernance, time.Hour, "")
+	withoutMD5.Del("Content-Md5")
+	if w := serve(http.MethodPut, "/bucket/obj", "locked", withoutMD5); w.Code != http.StatusBadRequest {
+		t.Errorf("PutObject with Object Lock without Content-MD5 = %d, want 400", w.Code)
+	}
+	if w := serve(http.MethodPut, "/bucket/obj", "locked", lockHeader(lockGovernance, -time.Hour, "")); w.Code != http.StatusBadRequest {
+		t.Errorf("PutObject with a retention in the past = %d, want 400", w.Code)
+	}
+
+	versionIDs := map[string]string{}
+	for name, header := range map[string]http.Header{
+		"governance": lockHeader(lockGovernance, time.Hour, ""),
+		"compliance": lockHeader(lockCompliance, time.Hour, ""),
+		"held":       lockHeader("", 0, "ON"),
+		"expired":    lockHeader(lockCompliance, time.Second, ""),
+	} {
+		w := serve(http.MethodPut, "/bucket/"+name, "locked", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PutObject of %s = %d", name, w.Code)
+		}
+		versionIDs[name] = w.Header().Get("x-amz-version-id")
+	}
+	if w := serve(http.MethodHead, "/bucket/governance", "", nil); w.Header().Get("x-amz-object-lock-mode") != lockGovernance {
+		t.Errorf("HeadObject of a retained object = %v", w.Header())
+	}
+	if versions := s.Versions("bucket", "held"); len(versions) != 1 || !versions[0].LegalHold {
+		t.Errorf("Versions() of a held object = %+v", versions)
+	}
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(2 * time.Second)))
+
+	tests := []struct {
+		name   string
+		key    string
+		bypass bool
+		want   int
+	}{
+		{"governance", "governance", false, http.StatusForbidden},
+		{"governance with bypass", "governance", true, http.StatusNoContent},
+		{"compliance with bypass", "compliance", true, http.StatusForbidden},
+		{"legal hold with bypass", "held", true, http.StatusForbidden},
+		{"expired retention", "expired", false, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.bypass {
+			header.Set("x-amz-bypass-governance-retention", "true")
+		}
+		if w := serve(http.MethodDelete, "/bucket/"+tt.key+"?versionId="+versionIDs[tt.key], "", header); w.Code != tt.want {
+			t.Errorf("DeleteObject of the version with %s = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	// Deleting the key only adds a delete marker in front of the retained version
+	if status, _ := do(t, s, http.MethodDelete, "/bucket/compliance", ""); status != http.StatusNoContent {
+		t.Errorf("DeleteObject of a retained key = %d", status)
+	}
+
+	w := serve(http.MethodPost, "/bucket?delete", "<Delete><Quiet>true</Quiet><Object><Key>held</Key><VersionId>"+versionIDs["held"]+"</VersionId></Object></Delete>", nil)
+	var result deleteResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil || len(result.Errors) != 1 || result.Errors[0].Code != "AccessDenied" {
+		t.Errorf("DeleteObjects of a held version = %s", w.Body.String())
+	}
+	if status, _ := do(t, s, http.MethodPut, "/bucket/held?legal-hold", "<LegalHold><Status>OFF</Status></LegalHold>"); status != http.StatusOK {
+		t.Errorf("PutObjectLegalHold = %d", status)
+	}
+	if status, _ := do(t, s, http.MethodDelete, "/bucket/held?versionId="+versionIDs["held"], ""); status != http.StatusNoContent {
+		t.Errorf("DeleteObject after removing the legal hold = %d", status)
+	}
+	if status, _ := do(t, s, http.MethodPut, "/plain/obj?legal-hold", "<LegalHold><Status>ON</Status></LegalHold>"); status != http.StatusBadRequest {
+		t.Errorf("PutObjectLegalHold in a bucket without Object Lock = %d, want 400", status)
+	}
+}
+
+func Test_FaultInjection(t *testing.T) {
+	s := New()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	do(t, s, http.MethodPut, "/bucket", "")
+	s.SetFaultInjector(ForOperations(EveryNth(2, SlowDown), "PutObject"))
+
+	var statuses []int
+	for i := 0; i < 4; i++ {
+		status, _ := do(t, s, http.MethodPut, "/bucket/obj", "data")
+		statuses = append(statuses, status)
+	}
+	if want := []int{200, 503, 200, 503}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("PutObject statuses = %v, want %v", statuses, want)
+	}
+	if status, _ := do(t, s, http.MethodGet, "/bucket/obj", ""); status != http.StatusOK {
+		t.Errorf("GetObject status = %d, operation should not be affected", status)
+	}
+	if got := s.Requests("PutObject"); got != 4 {
+		t.Errorf("Requests(PutObject) = %d, want 4", got)
+	}
+
+	s.SetFaultInjector(Always(Fault{Reset: true}))
+	if _, err := http.Get(server.URL + "/bucket/obj"); err == nil {
+		t.Error("Expected an error from a reset connection")
+	}
+
+	s.SetFaultInjector(Always(Fault{Delay: 50 * time.Millisecond}))
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/bucket/obj")
+	if err != nil {
+		t.Fatalf("Delayed request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || string(body) != "data" {
+		t.Errorf("Delayed request took %v and returned %q", elapsed, body)
+	}
+}
+
+func Test_parseCopyRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStart int64
+		wantEnd   int64
+		wantOK    bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=90-99", 90, 99, true},
+		{"bytes=90-100", 0, 0, false},
+		{"bytes=5-", 0, 0, false},
+		{"bytes=-10", 0, 0, false},
+		{"bytes=9-5", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, end, ok := parseCopyRange(tt.value, 100)
+			if start != tt.wantStart || end != tt.wantEnd || ok != tt.wantOK {
+				t.Errorf("parseCopyRange() = %d, %d, %v, want %d, %d, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+		})
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"net"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -32,18 +36,6 @@ func init() {
 	flag.IntVar(&serverPort, "p", 2000, "Port on which the server will be available for clients. Default: 2000")
 	flag.BoolVar(&debug, "d", false, "enable debug log output")
 	flag.BoolVar(&trace, "t", false, "enable trace log output")
-	flag.Parse()
-	// Only demand this flag if we are not running go test
-	if configFileLocation == "" && flag.Lookup("test.v") == nil {
-		log.Fatal("-c is a mandatory parameter - please specify the config file")
-	}
-	if debug {
-		log.SetLevel(log.DebugLevel)
-	} else if trace {
-		log.SetLevel(log.TraceLevel)
-	} else {
-		log.SetLevel(log.InfoLevel)
-	}
 }
 
 var configFileLocation string
@@ -95,6 +87,18 @@ func loadConfigFromFile(configFileContent []byte) common.Workloadconf {
 }
 
 func main() {
+	// Parse the flags here instead of in init() so that go test can register its own flags first
+	flag.Parse()
+	if configFileLocation == "" {
+		log.Fatal("-c is a mandatory parameter - please specify the config file")
+	}
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else if trace {
+		log.SetLevel(log.TraceLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
 
 	configFileContent, err := ioutil.ReadFile(configFileLocation)
 	if err != nil {
@@ -113,6 +117,7 @@ func main() {
 	config := common.Testconf{
 		S3Config:      s3Config,
 		GrafanaConfig: workload.GrafanaConfig,
+		Seed:          workload.Seed,
 		Tests:         workload.Tests,
 	}
 
@@ -172,6 +177,7 @@ func scheduleTests(config common.Testconf) {
 		doneChannel := make(chan bool, test.Drivers)
 		resultChannel := make(chan common.BenchmarkResult, test.Drivers)
 		continueDrivers := make(chan bool, test.Drivers)
+		run := newTestRun(test)
 
 		maxDrivers = int(math.Max(float64(test.Drivers), float64(maxDrivers)))
 
@@ -183,7 +189,7 @@ func scheduleTests(config common.Testconf) {
 			}
 			driverConnection := <-readyDrivers
 			log.WithField("Driver", (*driverConnection).RemoteAddr()).Infof("We found driver %d / %d for test %d", driver+1, test.Drivers, testNumber)
-			go executeTestOnDriver(driverConnection, driverConfig, doneChannel, continueDrivers, resultChannel)
+			go executeTestOnDriver(driverConnection, driverConfig, run, doneChannel, continueDrivers, resultChannel)
 		}
 		for driver := 0; driver < test.Drivers; driver++ {
 			// Will halt until all driverss are done with preparations
@@ -209,12 +215,19 @@ func scheduleTests(config common.Testconf) {
 		benchResult.StartTime = startTime
 		benchResult.StopTime = stopTime
 		benchResult.Duration = stopTime.Sub(startTime)
+		benchResult.Seed = test.Seed
+		if reason, driverID := run.reason(); reason != "" {
+			benchResult.StopReason = fmt.Sprintf("%s on driver %s", reason, driverID)
+		}
 		log.WithField("test", test.Name).
 			WithField("Operation Name", benchResult.OperationName).
 			WithField("Drivers", benchResult.Workers).
 			WithField("Object Size", benchResult.ObjectSize).
 			WithField("Completed Operations", benchResult.Operations).
 			WithField("Failed Operations", benchResult.FailedOperations).
+			WithField("Timed Out Operations", benchResult.TimedOutOperations).
+			WithField("Retries", benchResult.Retries).
+			WithField("Error Classes", formatErrorClasses(benchResult.ErrorClasses)).
 			WithField("Ops Per Second", benchResult.OpsPerSecond).
 			WithField("Total Bytes", benchResult.Bytes).
 			WithField("Average BW in Byte/s", benchResult.Bandwidth).
@@ -223,6 +236,8 @@ func scheduleTests(config common.Testconf) {
 			WithField("Start Time", benchResult.StartTime).
 			WithField("Stop Time", benchResult.StopTime).
 			WithField("Test runtime on server", benchResult.Duration).
+			WithField("Seed", benchResult.Seed).
+			WithField("Stop Reason", benchResult.StopReason).
 			Infof("PERF RESULTS")
 		writeResultToCSV(benchResult)
 		writeResultToConsole(benchResults, benchResult)
@@ -239,11 +254,123 @@ func scheduleTests(config common.Testconf) {
 	listener.Close()
 }
 
-func executeTestOnDriver(conn *net.Conn, config *common.DriverConf, doneChannel chan bool, continueDrivers chan bool, resultChannel chan common.BenchmarkResult) {
+// testRun coordinates the drivers of a running test, so that all drivers
+// stop as soon as one of them reaches an abort condition. It also hands
+// out the global ops budget and the byte budget of the test.
+type testRun struct {
+	stopOnce   sync.Once
+	stopReason string
+	stopDriver string
+	stopped    chan struct{}
+
+	opsMutex     sync.Mutex
+	opsRemaining uint64
+	opsLeaseSize uint64
+
+	bytesMutex     sync.Mutex
+	bytesRemaining uint64
+	bytesLeaseSize uint64
+}
+
+func newTestRun(test *common.TestCaseConfiguration) *testRun {
+	run := &testRun{stopped: make(chan struct{})}
+	if test.OpsDeadlineGlobal {
+		run.opsRemaining = test.OpsDeadline
+		run.opsLeaseSize = test.OpsLeaseSize
+		if run.opsLeaseSize == 0 {
+			run.opsLeaseSize = defaultOpsLeaseSize(test)
+		}
+	}
+	if test.BytesDeadline != 0 {
+		run.bytesRemaining = uint64(test.BytesDeadline)
+		run.bytesLeaseSize = defaultBytesLeaseSize(test)
+	}
+	return run
+}
+
+// defaultOpsLeaseSize splits the global ops budget into about 10 leases
+// per driver, but never hands out more than 1000 operations at once
+func defaultOpsLeaseSize(test *common.TestCaseConfiguration) uint64 {
+	leaseSize := test.OpsDeadline / uint64(10*test.Drivers)
+	if leaseSize > 1000 {
+		leaseSize = 1000
+	}
+	if leaseSize == 0 {
+		leaseSize = 1
+	}
+	return leaseSize
+}
+
+// leaseOps takes the next lease from the global ops budget.
+// It returns 0 once the budget is used up.
+func (run *testRun) leaseOps() uint64 {
+	run.opsMutex.Lock()
+	defer run.opsMutex.Unlock()
+	lease := run.opsLeaseSize
+	if lease > run.opsRemaining {
+		lease = run.opsRemaining
+	}
+	run.opsRemaining -= lease
+	return lease
+}
+
+// defaultBytesLeaseSize splits the byte budget into about 10 leases per driver
+func defaultBytesLeaseSize(test *common.TestCaseConfiguration) uint64 {
+	leaseSize := uint64(test.BytesDeadline) / uint64(10*test.Drivers)
+	if leaseSize == 0 {
+		leaseSize = 1
+	}
+	return leaseSize
+}
+
+// leaseBytes takes the next lease from the byte budget.
+// It returns 0 once the budget is used up.
+func (run *testRun) leaseBytes() uint64 {
+	run.bytesMutex.Lock()
+	defer run.bytesMutex.Unlock()
+	lease := run.bytesLeaseSize
+	if lease > run.bytesRemaining {
+		lease = run.bytesRemaining
+	}
+	run.bytesRemaining -= lease
+	return lease
+}
+
+// stop records why the test was aborted and stops all drivers.
+// Only the first reported reason is kept.
+func (run *testRun) stop(driverID string, reason string) {
+	run.stopOnce.Do(func() {
+		log.WithField("driver", driverID).WithField("reason", reason).Warn("Driver reached a stop condition - stopping all drivers")
+		run.stopReason = reason
+		run.stopDriver = driverID
+		close(run.stopped)
+	})
+}
+
+// reason returns why and by which driver the test was aborted - or empty
+// strings if no driver reached a stop condition
+func (run *testRun) reason() (string, string) {
+	select {
+	case <-run.stopped:
+		return run.stopReason, run.stopDriver
+	default:
+		return "", ""
+	}
+}
+
+func executeTestOnDriver(conn *net.Conn, config *common.DriverConf, run *testRun, doneChannel chan bool, continueDrivers chan bool, resultChannel chan common.BenchmarkResult) {
 	encoder := json.NewEncoder(*conn)
 	decoder := json.NewDecoder(*conn)
-	_ = encoder.Encode(common.DriverMessage{Message: "init", Config: config})
+	var encoderMutex sync.Mutex
+	send := func(message common.DriverMessage) {
+		encoderMutex.Lock()
+		defer encoderMutex.Unlock()
+		_ = encoder.Encode(message)
+	}
+	send(common.DriverMessage{Message: "init", Config: config})
 
+	workDone := make(chan struct{})
+	defer close(workDone)
 	var response common.DriverMessage
 	for {
 		err := decoder.Decode(&response)
@@ -257,7 +384,22 @@ func executeTestOnDriver(conn *net.Conn, config *common.DriverConf, doneChannel
 		case "preparations done":
 			doneChannel <- true
 			<-continueDrivers
-			_ = encoder.Encode(common.DriverMessage{Message: "start work"})
+			send(common.DriverMessage{Message: "start work"})
+			go func() {
+				select {
+				case <-run.stopped:
+					if reason, driverID := run.reason(); driverID != config.DriverID {
+						send(common.DriverMessage{Message: "stop work", StopReason: reason})
+					}
+				case <-workDone:
+				}
+			}()
+		case "stop condition reached":
+			run.stop(config.DriverID, response.StopReason)
+		case "ops lease request":
+			send(common.DriverMessage{Message: "ops lease", OpsLease: run.leaseOps()})
+		case "bytes lease request":
+			send(common.DriverMessage{Message: "bytes lease", BytesLease: run.leaseBytes()})
 		case "work done":
 			doneChannel <- true
 			resultChannel <- response.BenchResult
@@ -274,7 +416,7 @@ func shutdownDriver(conn *net.Conn) {
 }
 
 func sumBenchmarkResults(results []common.BenchmarkResult) common.BenchmarkResult {
-	sum := common.BenchmarkResult{}
+	sum := common.BenchmarkResult{ErrorClasses: map[string]float64{}}
 	bandwidthAverages := float64(0)
 	latencyAverages := float64(0)
 	objectSizeAverages := float64(0)
@@ -282,22 +424,135 @@ func sumBenchmarkResults(results []common.BenchmarkResult) common.BenchmarkResul
 		sum.Bytes += result.Bytes
 		sum.Operations += result.Operations
 		sum.FailedOperations += result.FailedOperations
+		sum.TimedOutOperations += result.TimedOutOperations
+		sum.Retries += result.Retries
+		for errorClass, operations := range result.ErrorClasses {
+			sum.ErrorClasses[errorClass] += operations
+		}
 		latencyAverages += result.LatencyAvg
 		bandwidthAverages += result.Bandwidth
 		objectSizeAverages += result.ObjectSize
 		sum.OpsPerSecond += result.OpsPerSecond
 		sum.Workers += result.Workers
 	}
-	sum.SuccessRatio = sum.Operations / (sum.Operations + sum.FailedOperations)
+	sum.SuccessRatio = sum.Operations / (sum.Operations + sum.FailedOperations + sum.TimedOutOperations)
 	sum.LatencyAvg = latencyAverages / float64(len(results))
 	sum.ObjectSize = objectSizeAverages / float64(len(results))
 	sum.TestName = results[0].TestName
 	sum.OperationName = results[0].OperationName
 	sum.Options = results[0].Options
 	sum.Bandwidth = bandwidthAverages
+	sum.OperationResults = sumOperationResults(results)
+	var stopReasons []string
+	for _, result := range results {
+		if !containsString(stopReasons, result.StopReason) {
+			stopReasons = append(stopReasons, result.StopReason)
+		}
+	}
+	sum.StopReason = strings.Join(stopReasons, ",")
 	return sum
 }
 
+// sortedErrorClasses returns the error classes ordered by their number of operations
+func sortedErrorClasses(errorClasses map[string]float64) []string {
+	classes := make([]string, 0, len(errorClasses))
+	for errorClass := range errorClasses {
+		classes = append(classes, errorClass)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if errorClasses[classes[i]] == errorClasses[classes[j]] {
+			return classes[i] < classes[j]
+		}
+		return errorClasses[classes[i]] > errorClasses[classes[j]]
+	})
+	return classes
+}
+
+// formatErrorClasses returns the error classes in a single line like SlowDown (503)=12;timeout=3
+func formatErrorClasses(errorClasses map[string]float64) string {
+	var classes []string
+	for _, errorClass := range sortedErrorClasses(errorClasses) {
+		classes = append(classes, fmt.Sprintf("%s=%.0f", errorClass, errorClasses[errorClass]))
+	}
+	return strings.Join(classes, ";")
+}
+
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sumOperationResults merges the per-method results of all drivers
+func sumOperationResults(results []common.BenchmarkResult) []common.OperationResult {
+	var sums []common.OperationResult
+	for _, result := range results {
+		for _, operationResult := range result.OperationResults {
+			index := -1
+			for i := range sums {
+				if sums[i].Method == operationResult.Method {
+					index = i
+				}
+			}
+			if index == -1 {
+				sums = append(sums, common.OperationResult{
+					Method:           operationResult.Method,
+					ObjectSizeMin:    operationResult.ObjectSizeMin,
+					ObjectSizeMax:    operationResult.ObjectSizeMax,
+					SizeDistribution: operationResult.SizeDistribution,
+				})
+				index = len(sums) - 1
+			}
+			sum := &sums[index]
+			// Weight the latency by the number of operations of each driver
+			sum.LatencyAvg = (sum.LatencyAvg*sum.Operations + operationResult.LatencyAvg*operationResult.Operations) / math.Max(sum.Operations+operationResult.Operations, 1)
+			sum.Operations += operationResult.Operations
+			sum.FailedOperations += operationResult.FailedOperations
+			sum.TimedOutOperations += operationResult.TimedOutOperations
+			sum.Retries += operationResult.Retries
+			sum.Bytes += operationResult.Bytes
+		}
+	}
+	for i := range sums {
+		sums[i].ObjectSize = sums[i].Bytes / (sums[i].Operations + sums[i].FailedOperations + sums[i].TimedOutOperations)
+	}
+	return sums
+}
+
+// csvHeader are the columns of the results CSV
+var csvHeader = []string{
+	"TestName",
+	"Operation Name",
+	"Workers",
+	"Object Size",
+	"Completed Operations",
+	"Failed Operations",
+	"Ops/Second",
+	"Total Bytes",
+	"Bandwidth in Bytes/s",
+	"Average Latency in ms",
+	"Success Ratio",
+	"Start Time",
+	"Stop Time",
+	"Test duration seen by server in seconds",
+	"Test Options",
+	"Seed",
+	"Stop Reason",
+	"Timed Out Operations",
+	"Retries",
+	"Error Classes",
+	"Method",
+	"Object Size Min",
+	"Object Size Max",
+	"Size Distribution",
+}
+
+// csvFileLocations are the results CSV files in the order they are tried
+var csvFileLocations = []string{"gosbench_results.csv", "/tmp/gosbench_results.csv"}
+
 func writeResultToCSV(benchResult common.BenchmarkResult) {
 	file, created, err := getCSVFileHandle()
 	if err != nil {
@@ -309,23 +564,7 @@ func writeResultToCSV(benchResult common.BenchmarkResult) {
 	csvwriter := csv.NewWriter(file)
 
 	if created {
-		err = csvwriter.Write([]string{
-			"TestName",
-			"Operation Name",
-			"Workers",
-			"Object Size",
-			"Completed Operations",
-			"Failed Operations",
-			"Ops/Second",
-			"Total Bytes",
-			"Bandwidth in Bytes/s",
-			"Average Latency in ms",
-			"Success Ratio",
-			"Start Time",
-			"Stop Time",
-			"Test duration seen by server in seconds",
-			"Test Options",
-		})
+		err = csvwriter.Write(csvHeader)
 		if err != nil {
 			log.WithError(err).Error("Failed writing line to results csv")
 			return
@@ -348,33 +587,90 @@ func writeResultToCSV(benchResult common.BenchmarkResult) {
 		fmt.Sprintf("%d", benchResult.StopTime.Unix()),
 		fmt.Sprintf("%f", benchResult.Duration.Seconds()),
 		benchResult.Options,
+		fmt.Sprintf("%d", benchResult.Seed),
+		benchResult.StopReason,
+		fmt.Sprintf("%.0f", benchResult.TimedOutOperations),
+		fmt.Sprintf("%.0f", benchResult.Retries),
+		formatErrorClasses(benchResult.ErrorClasses),
+		"",
+		"",
+		"",
+		"",
 	})
 	if err != nil {
 		log.WithError(err).Error("Failed writing line to results csv")
 		return
 	}
 
+	// One row per method with the columns of the per-operation table on the console
+	for _, result := range benchResult.OperationResults {
+		err = csvwriter.Write([]string{
+			benchResult.TestName,
+			benchResult.OperationName,
+			fmt.Sprintf("%d", benchResult.Workers),
+			fmt.Sprintf("%.0f", result.ObjectSize),
+			fmt.Sprintf("%.0f", result.Operations),
+			fmt.Sprintf("%.0f", result.FailedOperations),
+			"",
+			fmt.Sprintf("%.0f", result.Bytes),
+			"",
+			fmt.Sprintf("%f", result.LatencyAvg),
+			"",
+			fmt.Sprintf("%d", benchResult.StartTime.Unix()),
+			fmt.Sprintf("%d", benchResult.StopTime.Unix()),
+			fmt.Sprintf("%f", benchResult.Duration.Seconds()),
+			benchResult.Options,
+			fmt.Sprintf("%d", benchResult.Seed),
+			benchResult.StopReason,
+			fmt.Sprintf("%.0f", result.TimedOutOperations),
+			fmt.Sprintf("%.0f", result.Retries),
+			"",
+			result.Method,
+			fmt.Sprintf("%d", result.ObjectSizeMin),
+			fmt.Sprintf("%d", result.ObjectSizeMax),
+			result.SizeDistribution,
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed writing line to results csv")
+			return
+		}
+	}
+
 	csvwriter.Flush()
 
 }
 
+// getCSVFileHandle opens the results CSV for appending and reports whether
+// it needs a header. A file with the columns of an older gosbench version is
+// moved aside, so that the new rows do not end up below the wrong header.
 func getCSVFileHandle() (*os.File, bool, error) {
-	file, err := os.OpenFile("gosbench_results.csv", os.O_APPEND|os.O_WRONLY, 0755)
-	if err == nil {
-		return file, false, nil
-	}
-	file, err = os.OpenFile("/tmp/gosbench_results.csv", os.O_APPEND|os.O_WRONLY, 0755)
-	if err == nil {
-		return file, false, nil
+	for _, location := range csvFileLocations {
+		file, err := os.OpenFile(location, os.O_APPEND|os.O_RDWR, 0755)
+		if err != nil {
+			continue
+		}
+		header, err := csv.NewReader(file).Read()
+		if err == io.EOF {
+			return file, true, nil
+		}
+		if err == nil && reflect.DeepEqual(header, csvHeader) {
+			return file, false, nil
+		}
+		file.Close()
+		oldLocation := strings.TrimSuffix(location, ".csv") + time.Now().Format("-20060102-150405") + ".csv"
+		if err := os.Rename(location, oldLocation); err != nil {
+			log.WithError(err).Warningf("%s has other columns than this gosbench version writes and could not be moved aside", location)
+			continue
+		}
+		log.Warningf("%s has other columns than this gosbench version writes - moved it to %s", location, oldLocation)
+		break
 	}
 
-	file, err = os.OpenFile("gosbench_results.csv", os.O_WRONLY|os.O_CREATE, 0755)
-	if err == nil {
-		return file, true, nil
-	}
-	file, err = os.OpenFile("/tmp/gosbench_results.csv", os.O_WRONLY|os.O_CREATE, 0755)
-	if err == nil {
-		return file, true, nil
+	for _, location := range csvFileLocations {
+		file, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+		if err == nil {
+			return file, true, nil
+		}
 	}
 
 	return nil, false, errors.New("Could not find previous CSV for appending and could not write new CSV file to current dir and /tmp/ giving up")
@@ -383,17 +679,39 @@ func getCSVFileHandle() (*os.File, bool, error) {
 
 func writeResultToConsole(driverResult []common.BenchmarkResult, summedResults common.BenchmarkResult) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.AlignRight)
-	fmt.Fprintln(w, "HOST\tTEST NAME\tOP NAME\tWORKERS\tOBJECT SIZE\tCOMPLETED OPS\tFAILED OPS\tOPS PER SECOND\tTOTAL MB\tBANDWIDTH (MB)\tLATENCY\tSUCCESS RATIO\tDURATION\t")
+	fmt.Fprintln(w, "HOST\tTEST NAME\tOP NAME\tWORKERS\tOBJECT SIZE\tCOMPLETED OPS\tFAILED OPS\tTIMED OUT OPS\tRETRIES\tOPS PER SECOND\tTOTAL MB\tBANDWIDTH (MB)\tLATENCY\tSUCCESS RATIO\tDURATION\tSEED\tSTOPPED BY\t")
 	for _, result := range driverResult {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f\t%.0f\t%.0f\t%.2f ops/sec\t%.2f MB\t%.2f MB/s\t%.2f ms\t%.2f%%\t%.2f s\t\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.2f ops/sec\t%.2f MB\t%.2f MB/s\t%.2f ms\t%.2f%%\t%.2f s\t%d\t%s\t\n",
 			result.Host, result.TestName, result.OperationName, result.Workers, result.ObjectSize, result.Operations,
-			result.FailedOperations, result.OpsPerSecond, result.Bytes/(1024*1024), result.Bandwidth/(1024*1024),
-			result.LatencyAvg, result.SuccessRatio*100, result.Duration.Seconds())
+			result.FailedOperations, result.TimedOutOperations, result.Retries, result.OpsPerSecond, result.Bytes/(1024*1024), result.Bandwidth/(1024*1024),
+			result.LatencyAvg, result.SuccessRatio*100, result.Duration.Seconds(), result.Seed, result.StopReason)
 	}
-	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f\t%.0f\t%.0f\t%.2f ops/sec\t%.2f MB\t%.2f MB/s\t%.2f ms\t%.2f%%\t%.2f s\t\n",
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.2f ops/sec\t%.2f MB\t%.2f MB/s\t%.2f ms\t%.2f%%\t%.2f s\t%d\t%s\t\n",
 		"Totals", summedResults.TestName, summedResults.OperationName, summedResults.Workers, summedResults.ObjectSize,
-		summedResults.Operations, summedResults.FailedOperations, summedResults.OpsPerSecond, summedResults.Bytes/(1024*1024),
-		summedResults.Bandwidth/(1024*1024), summedResults.LatencyAvg, summedResults.SuccessRatio*100, summedResults.Duration.Seconds())
+		summedResults.Operations, summedResults.FailedOperations, summedResults.TimedOutOperations, summedResults.Retries, summedResults.OpsPerSecond, summedResults.Bytes/(1024*1024),
+		summedResults.Bandwidth/(1024*1024), summedResults.LatencyAvg, summedResults.SuccessRatio*100, summedResults.Duration.Seconds(),
+		summedResults.Seed, summedResults.StopReason)
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "METHOD\tOBJECT SIZE MIN\tOBJECT SIZE MAX\tSIZE DISTRIBUTION\tAVG OBJECT SIZE\tCOMPLETED OPS\tFAILED OPS\tTIMED OUT OPS\tRETRIES\tTOTAL MB\tLATENCY\t")
+	for _, result := range summedResults.OperationResults {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%.2f MB\t%.2f ms\t\n",
+			result.Method, result.ObjectSizeMin, result.ObjectSizeMax, result.SizeDistribution, result.ObjectSize,
+			result.Operations, result.FailedOperations, result.TimedOutOperations, result.Retries, result.Bytes/(1024*1024), result.LatencyAvg)
+	}
+
+	if len(summedResults.ErrorClasses) != 0 {
+		failures := float64(0)
+		for _, operations := range summedResults.ErrorClasses {
+			failures += operations
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ERROR CLASS\tOPERATIONS\tSHARE OF ERRORS\t")
+		for _, errorClass := range sortedErrorClasses(summedResults.ErrorClasses) {
+			fmt.Fprintf(w, "%s\t%.0f\t%.2f%%\t\n", errorClass, summedResults.ErrorClasses[errorClass],
+				summedResults.ErrorClasses[errorClass]/failures*100)
+		}
+	}
 
 	w.Flush()
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/mulbc/gosbench/common"
@@ -15,21 +20,21 @@ func Test_loadConfigFromFile(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want common.Testconf
+		want common.Workloadconf
 	}{
-		{"empty file", args{[]byte{}}, common.Testconf{}},
+		{"empty file", args{[]byte{}}, common.Workloadconf{}},
 		// TODO discover how to handle log.Fatal with logrus here
 		// https://github.com/sirupsen/logrus#fatal-handlers
-		// {"unparsable", args{[]byte(`corrupt!`)}, common.Testconf{}},
-		{"S3Config", args{[]byte(`s3_config:
-  - access_key: secretKey
-    secret_key: secretSecret
-    endpoint: test`)}, common.Testconf{
-			S3Config: []*common.S3Configuration{{
-				Endpoint:  "test",
-				AccessKey: "secretKey",
-				SecretKey: "secretSecret",
-			}},
+		// {"unparsable", args{[]byte(`corrupt!`)}, common.Workloadconf{}},
+		{"Grafana config", args{[]byte(`grafana_config:
+  endpoint: http://grafana
+  username: admin
+  password: grafana`)}, common.Workloadconf{
+			GrafanaConfig: &common.GrafanaConfiguration{
+				Endpoint: "http://grafana",
+				Username: "admin",
+				Password: "grafana",
+			},
 		}},
 	}
 	for _, tt := range tests {
@@ -45,3 +50,198 @@ func Test_loadConfigFromFile(t *testing.T) {
 		})
 	}
 }
+
+func Test_loadS3ConfigFromFile(t *testing.T) {
+	s3FileLocation = "test.yaml"
+	type args struct {
+		s3FileContent []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want []*common.S3Configuration
+	}{
+		{"empty file", args{[]byte{}}, nil},
+		{"S3Config", args{[]byte(`- access_key: secretKey
+  secret_key: secretSecret
+  endpoint: test`)}, []*common.S3Configuration{{
+			Endpoint:  "test",
+			AccessKey: "secretKey",
+			SecretKey: "secretSecret",
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadS3ConfigFromFile(tt.args.s3FileContent); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadS3ConfigFromFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sumOperationResults(t *testing.T) {
+	results := []common.BenchmarkResult{
+		{OperationResults: []common.OperationResult{
+			{Method: "GET", Operations: 10, Retries: 1, Bytes: 1000, LatencyAvg: 2},
+			{Method: "PUT", Operations: 10, Bytes: 5000, LatencyAvg: 10},
+		}},
+		{OperationResults: []common.OperationResult{
+			{Method: "GET", Operations: 30, Retries: 2, Bytes: 3000, LatencyAvg: 4},
+		}},
+	}
+	want := []common.OperationResult{
+		{Method: "GET", Operations: 40, Retries: 3, Bytes: 4000, ObjectSize: 100, LatencyAvg: 3.5},
+		{Method: "PUT", Operations: 10, Bytes: 5000, ObjectSize: 500, LatencyAvg: 10},
+	}
+	if got := sumOperationResults(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("sumOperationResults() = %v, want %v", got, want)
+	}
+}
+
+func Test_writeResultToCSV(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "gosbench_results.csv")
+	defer func(locations []string) { csvFileLocations = locations }(csvFileLocations)
+	csvFileLocations = []string{location}
+
+	writeResultToCSV(common.BenchmarkResult{TestName: "test", OperationName: "read", OperationResults: []common.OperationResult{
+		{Method: "GET", ObjectSizeMin: 1, ObjectSizeMax: 2, SizeDistribution: "random", Operations: 10},
+		{Method: "PUT", ObjectSizeMin: 3, ObjectSizeMax: 4, SizeDistribution: "constant", Operations: 5},
+	}})
+	file, err := os.Open(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("writeResultToCSV() wrote %d lines, want a header, the summary and 2 methods", len(records))
+	}
+	var methods []string
+	for _, record := range records[1:] {
+		methods = append(methods, strings.Join(record[len(record)-4:], " "))
+	}
+	if want := []string{"   ", "GET 1 2 random", "PUT 3 4 constant"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("writeResultToCSV() wrote the methods %q, want %q", methods, want)
+	}
+}
+
+func Test_getCSVFileHandle(t *testing.T) {
+	tests := []struct {
+		name        string
+		exists      bool
+		content     string
+		wantCreated bool
+		wantMoved   bool
+	}{
+		{"No file", false, "", true, false},
+		{"Empty file", true, "", true, false},
+		{"Same columns", true, strings.Join(csvHeader, ",") + "\n", false, false},
+		{"Old columns", true, "TestName,Operation Name,Workers\n", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			location := filepath.Join(dir, "gosbench_results.csv")
+			defer func(locations []string) { csvFileLocations = locations }(csvFileLocations)
+			csvFileLocations = []string{location}
+			if tt.exists {
+				if err := ioutil.WriteFile(location, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			file, created, err := getCSVFileHandle()
+			if err != nil {
+				t.Fatalf("getCSVFileHandle() error = %v", err)
+			}
+			file.Close()
+			if created != tt.wantCreated {
+				t.Errorf("getCSVFileHandle() created = %v, want %v", created, tt.wantCreated)
+			}
+			moved, _ := filepath.Glob(filepath.Join(dir, "gosbench_results-*.csv"))
+			if (len(moved) == 1) != tt.wantMoved {
+				t.Errorf("getCSVFileHandle() moved the old file to %v, want moved %v", moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func Test_formatErrorClasses(t *testing.T) {
+	tests := []struct {
+		name         string
+		errorClasses map[string]float64
+		want         string
+	}{
+		{"No errors", map[string]float64{}, ""},
+		{"Sorted by operations", map[string]float64{"timeout": 3, "SlowDown (503)": 12, "dns": 1}, "SlowDown (503)=12;timeout=3;dns=1"},
+		{"Same operations sorted by name", map[string]float64{"timeout": 2, "InternalError (500)": 2}, "InternalError (500)=2;timeout=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatErrorClasses(tt.errorClasses); got != tt.want {
+				t.Errorf("formatErrorClasses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_testRun_leaseOps(t *testing.T) {
+	test := &common.TestCaseConfiguration{OpsDeadline: 1005, OpsDeadlineGlobal: true, Drivers: 3}
+	run := newTestRun(test)
+	total := uint64(0)
+	leases := 0
+	for lease := run.leaseOps(); lease != 0; lease = run.leaseOps() {
+		if lease > 33 {
+			t.Errorf("leaseOps() = %v, want at most %v", lease, 33)
+		}
+		total += lease
+		leases++
+	}
+	if total != test.OpsDeadline {
+		t.Errorf("leaseOps() handed out %v operations, want %v", total, test.OpsDeadline)
+	}
+	if leases != 31 {
+		t.Errorf("leaseOps() handed out %v leases, want %v", leases, 31)
+	}
+}
+
+func Test_defaultOpsLeaseSize(t *testing.T) {
+	tests := []struct {
+		name string
+		test *common.TestCaseConfiguration
+		want uint64
+	}{
+		{"ten leases per driver", &common.TestCaseConfiguration{OpsDeadline: 1000, Drivers: 2}, 50},
+		{"at most 1000 operations", &common.TestCaseConfiguration{OpsDeadline: 1000000, Drivers: 2}, 1000},
+		{"at least one operation", &common.TestCaseConfiguration{OpsDeadline: 5, Drivers: 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultOpsLeaseSize(tt.test); got != tt.want {
+				t.Errorf("defaultOpsLeaseSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_testRun_leaseBytes(t *testing.T) {
+	test := &common.TestCaseConfiguration{BytesDeadline: 1005, Drivers: 3}
+	run := newTestRun(test)
+	total := uint64(0)
+	leases := 0
+	for lease := run.leaseBytes(); lease != 0; lease = run.leaseBytes() {
+		if lease > 33 {
+			t.Errorf("leaseBytes() = %v, want at most %v", lease, 33)
+		}
+		total += lease
+		leases++
+	}
+	if total != uint64(test.BytesDeadline) {
+		t.Errorf("leaseBytes() handed out %v bytes, want %v", total, test.BytesDeadline)
+	}
+	if leases != 31 {
+		t.Errorf("leaseBytes() handed out %v leases, want %v", leases, 31)
+	}
+}